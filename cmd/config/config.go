@@ -0,0 +1,54 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	appconfig "github.com/keevingness/image-shipper/internal/config"
+)
+
+// Run 执行config命令，显示最终生效的配置及每项的来源
+func Run() {
+	fs := flag.NewFlagSet("config", flag.ExitOnError)
+	configFile := fs.String("config", "", "指定配置文件路径")
+
+	// 检查是否请求帮助
+	for _, arg := range os.Args[2:] {
+		if arg == "--help" || arg == "-h" {
+			printUsage()
+			return
+		}
+	}
+
+	fs.Parse(os.Args[2:])
+
+	// 仅查看配置时不做必填项校验，方便排查缺失的配置
+	cfg, err := appconfig.Load(appconfig.Options{ConfigFile: *configFile, SkipValidation: true})
+	if err != nil {
+		fmt.Printf("加载配置失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("当前生效的配置:")
+	for _, entry := range cfg.Entries() {
+		fmt.Printf("  %-24s = %-30q %s\n", entry.Key, entry.Value, entry.Origin)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		fmt.Printf("\n⚠️  配置不完整: %v\n", err)
+	}
+}
+
+// printUsage 打印使用说明
+func printUsage() {
+	fmt.Println("ImageShipper Config - 配置查看工具")
+	fmt.Println("")
+	fmt.Println("用法:")
+	fmt.Println("  ./app config [选项]")
+	fmt.Println("")
+	fmt.Println("选项:")
+	fmt.Println("  --config <路径> 指定配置文件，不再搜索默认路径")
+	fmt.Println("")
+	fmt.Println("  每个配置项会标明来源: default(默认值)、file(配置文件)、env(环境变量) 或 flag(命令行参数)")
+}
@@ -0,0 +1,93 @@
+package pull
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/keevingness/image-shipper/pkg/docker"
+)
+
+// pullNative 使用内置的仓库客户端拉取镜像
+// 指定ociLayout时写入OCI布局目录，否则以docker-archive格式导入容器运行时并直接标记为targetImage。
+func pullNative(ctx context.Context, sourceImage, targetImage, containerRuntime, ociLayout string) error {
+	ref, err := docker.ParseNormalizedReference(sourceImage)
+	if err != nil {
+		return err
+	}
+
+	client := docker.NewRegistryClient(docker.WithCredentials(docker.DockerConfigCredentials()))
+
+	platform := docker.DefaultPlatform()
+	fmt.Printf("获取镜像清单: %s (%s)\n", ref.WithDefaultTag(), platform)
+	img, err := client.FetchImage(ctx, ref.Domain, ref.Path, ref.Identifier(), platform)
+	if err != nil {
+		return err
+	}
+	if ref.Digest != "" {
+		fmt.Printf("✔ 清单摘要已校验: %s\n", ref.Digest)
+	}
+	fmt.Printf("镜像摘要: %s，共 %d 层\n", img.Digest, len(img.Manifest.Layers))
+
+	if ociLayout != "" {
+		fmt.Printf("写入OCI布局目录: %s\n", ociLayout)
+		return client.WriteOCILayout(ctx, img, ociLayout, targetImage)
+	}
+
+	return loadIntoRuntime(ctx, client, img, targetImage, containerRuntime)
+}
+
+// loadIntoRuntime 将镜像通过标准输入导入容器运行时
+func loadIntoRuntime(ctx context.Context, client *docker.RegistryClient, img *docker.Image, targetImage, containerRuntime string) error {
+	args := loadCommand(containerRuntime)
+	fmt.Printf("执行: %s\n", strings.Join(args, " "))
+
+	pr, pw := io.Pipe()
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = pr
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("启动导入命令失败: %w", err)
+	}
+
+	writeErr := make(chan error, 1)
+	go func() {
+		err := client.WriteDockerArchive(ctx, img, pw, targetImage)
+		pw.CloseWithError(err)
+		writeErr <- err
+	}()
+
+	waitErr := cmd.Wait()
+	// 导入命令提前退出时让写入协程尽快结束
+	pr.Close()
+	if err := <-writeErr; err != nil {
+		return fmt.Errorf("下载镜像失败: %w", err)
+	}
+	if waitErr != nil {
+		return fmt.Errorf("导入镜像失败: %w", waitErr)
+	}
+	return nil
+}
+
+// loadCommand 返回从标准输入导入docker-archive的运行时命令
+// docker、podman、nerdctl使用load子命令；crictl没有导入功能，改用同一发行版中的ctr
+// 导入到Kubernetes使用的k8s.io命名空间，如 "k3s crictl" 对应 "k3s ctr"。
+func loadCommand(containerRuntime string) []string {
+	parts := strings.Fields(containerRuntime)
+	if len(parts) == 0 {
+		parts = []string{"docker"}
+	}
+
+	prefix := parts[: len(parts)-1 : len(parts)-1]
+	switch parts[len(parts)-1] {
+	case "crictl", "ctr":
+		return append(prefix, "ctr", "-n", "k8s.io", "images", "import", "-")
+	default:
+		return append(parts, "load")
+	}
+}
@@ -1,6 +1,7 @@
 package pull
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
@@ -8,6 +9,7 @@ import (
 	"strings"
 
 	"github.com/keevingness/image-shipper/internal/config"
+	"github.com/keevingness/image-shipper/internal/flagutil"
 	"github.com/keevingness/image-shipper/pkg/docker"
 	"github.com/keevingness/image-shipper/pkg/yamlparser"
 )
@@ -16,11 +18,22 @@ import (
 func Run() {
 	// 创建flag集合
 	fs := flag.NewFlagSet("pull", flag.ExitOnError)
-	filePath := fs.String("f", "", "指定Docker Compose或Kubernetes YAML文件路径")
+	var filePaths flagutil.StringList
+	fs.Var(&filePaths, "f", "指定Docker Compose、Kubernetes YAML文件、Dockerfile、Helm Chart、kustomization、目录、通配符、URL或 -（标准输入），可重复指定")
+	var profiles flagutil.StringList
+	fs.Var(&profiles, "profile", "解析Compose文件时启用的profile，可重复指定")
+	var includes, excludes flagutil.StringList
+	fs.Var(&includes, "include", "扫描目录时包含的文件模式，可重复指定（默认 YAML 文件和 Dockerfile）")
+	fs.Var(&excludes, "exclude", "扫描目录时排除的文件或目录模式，可重复指定")
+	fileType := fs.String("type", "", "强制使用的解析器：compose、k8s、helm、kustomize、dockerfile，默认按内容判断")
 	dryRun := fs.Bool("dry-run", false, "仅解析文件并显示镜像，不执行实际拉取操作")
 	podmanFlag := fs.Bool("podman", false, "使用Podman而不是Docker")
 	dockerFlag := fs.Bool("docker", false, "使用Docker（默认）")
 	customRuntime := fs.String("e", "", "使用自定义容器运行时命令")
+	configFile := fs.String("config", "", "指定配置文件路径")
+	cliMode := fs.Bool("cli", false, "只使用容器运行时命令拉取，不使用内置的仓库客户端")
+	ociLayout := fs.String("oci-layout", "", "将镜像写入指定的OCI布局目录，而不是导入容器运行时")
+	valuesFiles := fs.String("values", "", "渲染Helm Chart时使用的values文件，多个文件用逗号分隔")
 
 	// 解析参数
 	if len(os.Args) <= 2 {
@@ -38,59 +51,90 @@ func Run() {
 
 	fs.Parse(os.Args[2:])
 
+	// 文件解析选项：Helm Chart的values文件和配置中的附加镜像路径
+	// 这里只读取配置不做校验，dry-run时不要求GitHub配置完整
+	var parseOpts yamlparser.ParseOptions
+	if len(filePaths) > 0 {
+		parseCfg, err := config.Load(config.Options{ConfigFile: *configFile, SkipValidation: true})
+		if err != nil {
+			fmt.Printf("加载配置失败: %v\n", err)
+			os.Exit(1)
+		}
+		parseOpts.ImagePaths = parseCfg.Parse.ImagePaths
+		parseOpts.Profiles = profiles
+		parseOpts.Include = includes
+		parseOpts.Exclude = excludes
+		if *valuesFiles != "" {
+			parseOpts.ValuesFiles = strings.Split(*valuesFiles, ",")
+		}
+		if *fileType != "" {
+			parseOpts.Type, err = yamlparser.ParseFileType(*fileType)
+			if err != nil {
+				fmt.Printf("错误: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		// dry-run时显示每个文件的类型判断结果，便于确认是否需要 --type
+		if *dryRun {
+			parseOpts.OnDetect = func(name string, detection yamlparser.Detection) {
+				fmt.Printf("🔍 %s: %s\n", name, detection)
+			}
+		}
+	}
+
 	// 如果是文件模式且处于dry-run模式，不需要加载完整配置
-	if *filePath != "" && *dryRun {
+	if len(filePaths) > 0 && *dryRun {
 		// 直接解析文件并显示镜像
-		images, err := yamlparser.ParseFile(*filePath)
+		images, err := yamlparser.ParseFilesWithOptions(filePaths, parseOpts)
 		if err != nil {
 			fmt.Printf("解析文件失败: %v\n", err)
 			os.Exit(1)
 		}
 
 		// 显示解析出的镜像
-		fmt.Printf("从文件 %s 中解析出以下镜像:\n", *filePath)
-		for i, image := range images {
-			fmt.Printf("%d. %s\n", i+1, image)
-		}
+		fmt.Printf("从文件 %s 中解析出以下镜像:\n", strings.Join(filePaths, ", "))
+		yamlparser.PrintFoundImages(os.Stdout, images)
 
 		fmt.Println("\n📝 注意: 运行在dry-run模式下，未执行实际拉取操作")
 		return
 	}
 
+	// 命令行参数优先级最高，作为覆盖项传给配置加载器
+	overrides := map[string]string{}
+	if *podmanFlag {
+		overrides["pull.container_runtime"] = "podman"
+	} else if *dockerFlag {
+		overrides["pull.container_runtime"] = "docker"
+	} else if *customRuntime != "" {
+		overrides["pull.container_runtime"] = *customRuntime
+	}
+	if *cliMode {
+		overrides["pull.mode"] = config.PullModeCLI
+	}
+
 	// 加载配置
-	cfg, err := config.LoadWithDefaults()
+	cfg, err := config.Load(config.Options{ConfigFile: *configFile, Flags: overrides})
 	if err != nil {
 		fmt.Printf("加载配置失败: %v\n", err)
 		os.Exit(1)
 	}
 
-	// 确定容器运行时
+	// 确定容器运行时和拉取方式
 	containerRuntime := cfg.Pull.ContainerRuntime
-	if *podmanFlag {
-		containerRuntime = "podman"
-	} else if *dockerFlag {
-		containerRuntime = "docker"
-	} else if *customRuntime != "" {
-		containerRuntime = *customRuntime
-	}
-
-	// 从配置中获取源镜像仓库地址
-	sourceRegistry := cfg.Pull.SourceRegistry
+	opts := pullOptions{runtime: containerRuntime, mode: cfg.Pull.Mode, ociLayout: *ociLayout}
 
 	// 检查是否指定了文件路径
-	if *filePath != "" {
+	if len(filePaths) > 0 {
 		// 从文件中解析镜像
-		images, err := yamlparser.ParseFile(*filePath)
+		images, err := yamlparser.ParseFilesWithOptions(filePaths, parseOpts)
 		if err != nil {
 			fmt.Printf("解析文件失败: %v\n", err)
 			os.Exit(1)
 		}
 
 		// 显示解析出的镜像
-		fmt.Printf("从文件 %s 中解析出以下镜像:\n", *filePath)
-		for i, image := range images {
-			fmt.Printf("%d. %s\n", i+1, image)
-		}
+		fmt.Printf("从文件 %s 中解析出以下镜像:\n", strings.Join(filePaths, ", "))
+		yamlparser.PrintFoundImages(os.Stdout, images)
 
 		// 由于我们已经在前面处理了dry-run模式，这里不需要再检查
 
@@ -98,33 +142,33 @@ func Run() {
 		successCount := 0
 		errorCount := 0
 
-		for i, image := range images {
+		for i, found := range images {
+			image := found.Image
 			fmt.Printf("\n正在处理镜像 %d/%d: %s\n", i+1, len(images), image)
 
 			// 解析镜像地址
-			_, _, tag, err := docker.ParseImageReference(image)
+			ref, err := docker.ParseReference(image)
 			if err != nil {
 				fmt.Printf("❌ 跳过无效的镜像地址 %s: %v\n", image, err)
 				errorCount++
 				continue
 			}
 
-			// 如果没有指定标签，默认使用latest
-			currentImage := image
-			if tag == "" {
-				currentImage = image + ":latest"
-			}
+			// 如果没有指定标签和摘要，默认使用latest
+			currentImage := ref.WithDefaultTag().String()
 
-			// 构建源镜像地址
-			sourceImage := sourceRegistry + "/" + currentImage
+			// 按改写规则确定源镜像地址，带摘要时按摘要拉取
+			sourceImage := cfg.PullSource(ref)
+			localImage := localImageName(ref)
+			fmt.Printf("源镜像: %s\n", sourceImage)
 
 			// 拉取镜像
-			err = pullAndRetagImage(sourceImage, currentImage, containerRuntime)
+			err = pullImage(sourceImage, localImage, opts)
 			if err != nil {
 				fmt.Printf("❌ 拉取镜像 %s 失败: %v\n", currentImage, err)
 				errorCount++
 			} else {
-				fmt.Printf("✅ 成功拉取并重新标记镜像: %s\n", currentImage)
+				fmt.Printf("✅ 成功拉取并重新标记镜像: %s\n", localImage)
 				successCount++
 			}
 		}
@@ -147,39 +191,65 @@ func Run() {
 			os.Exit(1)
 		}
 
-		// 如果是dry-run模式，只显示镜像信息
-		if *dryRun {
-			fmt.Printf("📝 注意: 运行在dry-run模式下，将从 %s 拉取镜像: %s\n", sourceRegistry, imageName)
-			return
-		}
-
 		// 解析镜像地址
-		_, _, tag, err := docker.ParseImageReference(imageName)
+		ref, err := docker.ParseReference(imageName)
 		if err != nil {
 			fmt.Printf("错误: 无效的镜像地址格式: %v\n", err)
 			os.Exit(1)
 		}
 
-		// 如果没有指定标签，默认使用latest
-		if tag == "" {
-			imageName = imageName + ":latest"
-		}
+		// 如果没有指定标签和摘要，默认使用latest
+		imageName = ref.WithDefaultTag().String()
 
-		// 构建源镜像地址
-		sourceImage := sourceRegistry + "/" + imageName
+		// 按改写规则确定源镜像地址，带摘要时按摘要拉取
+		sourceImage := cfg.PullSource(ref)
+		localImage := localImageName(ref)
+
+		// 如果是dry-run模式，只显示镜像信息
+		if *dryRun {
+			fmt.Printf("📝 注意: 运行在dry-run模式下，将从 %s 拉取镜像: %s\n", sourceImage, imageName)
+			return
+		}
 
 		// 拉取镜像
-		fmt.Printf("正在从 %s 拉取镜像 %s (使用 %s)...\n", sourceRegistry, imageName, containerRuntime)
-		err = pullAndRetagImage(sourceImage, imageName, containerRuntime)
+		fmt.Printf("正在从 %s 拉取镜像 %s (使用 %s)...\n", sourceImage, imageName, containerRuntime)
+		err = pullImage(sourceImage, localImage, opts)
 		if err != nil {
 			fmt.Printf("错误: %v\n", err)
 			os.Exit(1)
 		}
 
-		fmt.Printf("✅ 成功拉取并重新标记镜像: %s\n", imageName)
+		fmt.Printf("✅ 成功拉取并重新标记镜像: %s\n", localImage)
 	}
 }
 
+// localImageName 返回镜像在本地使用的名称
+// 容器运行时不能用摘要作为本地名称，带摘要的引用使用其标签，没有标签时使用 sha256-<摘要>。
+func localImageName(ref docker.Reference) string {
+	return ref.Name() + ":" + ref.LocalTag()
+}
+
+// pullOptions 拉取镜像的方式
+type pullOptions struct {
+	runtime   string
+	mode      string
+	ociLayout string
+}
+
+// pullImage 拉取镜像并标记为targetImage
+// 默认使用内置的仓库客户端，失败时回退到容器运行时命令；写入OCI布局目录时没有回退。
+func pullImage(sourceImage, targetImage string, opts pullOptions) error {
+	if opts.mode == config.PullModeNative || opts.ociLayout != "" {
+		err := pullNative(context.Background(), sourceImage, targetImage, opts.runtime, opts.ociLayout)
+		if err == nil || opts.ociLayout != "" {
+			return err
+		}
+		fmt.Printf("⚠️  内置客户端拉取失败: %v\n", err)
+		fmt.Printf("改用 %s 命令拉取\n", opts.runtime)
+	}
+	return pullAndRetagImage(sourceImage, targetImage, opts.runtime)
+}
+
 // pullAndRetagImage 拉取镜像并重新标记
 func pullAndRetagImage(sourceImage, targetImage, containerRuntime string) error {
 	// 分割容器运行时命令，支持多词命令如 "k3s crictl"
@@ -233,11 +303,21 @@ func printUsage() {
 	fmt.Println("  ./app pull -f <docker-compose.yaml或k8s yaml文件路径> --dry-run  # 仅解析文件并显示镜像，不执行实际拉取")
 	fmt.Println("")
 	fmt.Println("选项:")
-	fmt.Println("  -f <文件路径>   指定Docker Compose或Kubernetes YAML文件路径")
+	fmt.Println("  -f <文件路径>   指定Docker Compose、Kubernetes YAML文件、Dockerfile、Helm Chart或kustomization目录，可重复指定")
+	fmt.Println("                  也可以是目录或通配符（如 'deploy/**/*.yaml'），递归扫描并遵循.gitignore")
+	fmt.Println("                  - 表示从标准输入读取，http(s) URL 会先下载，两者都按内容判断类型")
 	fmt.Println("  --dry-run       仅解析文件并显示镜像，不执行实际拉取操作")
 	fmt.Println("  --podman        使用Podman而不是Docker")
 	fmt.Println("  --docker        使用Docker（默认）")
 	fmt.Println("  -e <命令>       使用自定义容器运行时命令，如 'k3s crictl'")
+	fmt.Println("  --cli           只使用容器运行时命令拉取，不使用内置的仓库客户端")
+	fmt.Println("  --oci-layout <目录> 将镜像写入OCI布局目录，而不是导入容器运行时")
+	fmt.Println("  --values <文件> 渲染Helm Chart时使用的values文件，多个文件用逗号分隔")
+	fmt.Println("  --profile <名称> 解析Compose文件时启用的profile，可重复指定")
+	fmt.Println("  --include <模式> 扫描目录时包含的文件，可重复指定（默认 YAML 文件和 Dockerfile）")
+	fmt.Println("  --exclude <模式> 扫描目录时排除的文件或目录，可重复指定")
+	fmt.Println("  --type <类型>   强制使用的解析器：compose、k8s、helm、kustomize、dockerfile（默认按内容判断）")
+	fmt.Println("  --config <路径> 指定配置文件，不再搜索默认路径")
 	fmt.Println("")
 	fmt.Println("示例:")
 	fmt.Println("  ./app pull nginx:latest")
@@ -247,6 +327,15 @@ func printUsage() {
 	fmt.Println("  ./app pull -f deployment.yaml              # 从Kubernetes deployment文件中拉取所有镜像")
 	fmt.Println("  ./app pull -f docker-compose.yaml --dry-run  # 仅解析docker-compose文件中的镜像")
 	fmt.Println("  ./app pull -f k8s-deployment.yaml --podman  # 使用Podman从K8s文件中拉取镜像")
+	fmt.Println("  ./app pull -f ./charts/myapp --values prod.yaml  # 渲染Helm Chart并拉取其中的镜像")
+	fmt.Println("  ./app pull -f overlays/prod                # 构建kustomization并拉取最终的镜像")
+	fmt.Println("  ./app pull -f Dockerfile                   # 拉取构建所需的基础镜像")
+	fmt.Println("  ./app pull -f compose.yaml -f compose.prod.yaml --profile debug  # 合并多个Compose文件")
+	fmt.Println("  ./app pull -f ./deploy --exclude 'test/**'  # 扫描目录中的所有清单")
+	fmt.Println("  helm template myapp ./chart | ./app pull -f -  # 从标准输入读取清单")
+	fmt.Println("")
+	fmt.Println("  ./app pull --oci-layout ./images nginx:latest  # 写入OCI布局目录，无需容器运行时")
 	fmt.Println("")
-	fmt.Println("  镜像将从配置的源仓库拉取，并重新标记为指定的镜像名称（不添加前缀）")
+	fmt.Println("  镜像按配置中的改写规则（pull.rewrites）从镜像仓库拉取，并重新标记为指定的镜像名称（不添加前缀）")
+	fmt.Println("  默认使用内置的仓库客户端下载并导入容器运行时，失败时回退到运行时的 pull/tag 命令")
 }
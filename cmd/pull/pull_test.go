@@ -0,0 +1,199 @@
+package pull
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/keevingness/image-shipper/internal/config"
+	"github.com/keevingness/image-shipper/pkg/docker"
+)
+
+// fakeRuntime 创建记录调用参数的容器运行时脚本，load命令的标准输入保存到 load.tar
+func fakeRuntime(t *testing.T) (command, dir string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake runtime is a shell script")
+	}
+	dir = t.TempDir()
+	script := `#!/bin/sh
+echo "$*" >> "$(dirname "$0")/calls.log"
+if [ "$1" = "load" ]; then
+	cat > "$(dirname "$0")/load.tar"
+fi
+`
+	command = filepath.Join(dir, "runtime")
+	if err := os.WriteFile(command, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return command, dir
+}
+
+// runtimeCalls 返回脚本被调用时的参数
+func runtimeCalls(t *testing.T, dir string) []string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, "calls.log"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+// newImageRegistry 启动只提供一个单平台镜像 app:v1 的仓库，返回仓库地址和收到的请求数
+func newImageRegistry(t *testing.T) (string, *atomic.Int32) {
+	t.Helper()
+	configBlob := []byte(`{"os":"linux","architecture":"amd64"}`)
+	layer := []byte("layer content")
+	manifest, _ := json.Marshal(docker.Manifest{
+		SchemaVersion: 2,
+		MediaType:     docker.MediaTypeOCIManifest,
+		Config:        docker.Descriptor{MediaType: docker.MediaTypeOCIConfig, Digest: docker.Digest(configBlob), Size: int64(len(configBlob))},
+		Layers:        []docker.Descriptor{{MediaType: docker.MediaTypeOCILayer, Digest: docker.Digest(layer), Size: int64(len(layer))}},
+	})
+	content := map[string][]byte{
+		"/v2/app/manifests/v1":                       manifest,
+		"/v2/app/blobs/" + docker.Digest(configBlob): configBlob,
+		"/v2/app/blobs/" + docker.Digest(layer):      layer,
+	}
+
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		data, ok := content[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if strings.Contains(r.URL.Path, "/manifests/") {
+			w.Header().Set("Content-Type", docker.MediaTypeOCIManifest)
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+	return strings.TrimPrefix(srv.URL, "http://"), &requests
+}
+
+func TestPullImageNative(t *testing.T) {
+	host, _ := newImageRegistry(t)
+	command, dir := fakeRuntime(t)
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+
+	err := pullImage(host+"/app:v1", "mirror.example.com/app:v1", pullOptions{runtime: command, mode: config.PullModeNative})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls := runtimeCalls(t, dir); !slices.Equal(calls, []string{"load"}) {
+		t.Fatalf("runtime calls = %q, want only load", calls)
+	}
+
+	// 导入的docker-archive应直接标记为目标镜像
+	f, err := os.Open(filepath.Join(dir, "load.tar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			t.Fatal("manifest.json not found in loaded archive")
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Name != "manifest.json" {
+			continue
+		}
+		var entries []struct{ RepoTags []string }
+		if err := json.NewDecoder(tr).Decode(&entries); err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 || !slices.Equal(entries[0].RepoTags, []string{"mirror.example.com/app:v1"}) {
+			t.Errorf("manifest.json = %+v, want RepoTags [mirror.example.com/app:v1]", entries)
+		}
+		return
+	}
+}
+
+func TestPullImageFallback(t *testing.T) {
+	host, _ := newImageRegistry(t)
+	command, dir := fakeRuntime(t)
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+
+	// 仓库中没有该镜像，内置客户端失败后改用运行时命令
+	source := host + "/app:missing"
+	err := pullImage(source, "mirror.example.com/app:missing", pullOptions{runtime: command, mode: config.PullModeNative})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"pull " + source,
+		"tag " + source + " mirror.example.com/app:missing",
+		"rmi " + source,
+	}
+	if calls := runtimeCalls(t, dir); !slices.Equal(calls, want) {
+		t.Errorf("runtime calls = %q, want %q", calls, want)
+	}
+}
+
+func TestPullImageOCILayoutNoFallback(t *testing.T) {
+	host, _ := newImageRegistry(t)
+	command, dir := fakeRuntime(t)
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+
+	err := pullImage(host+"/app:missing", "app:missing", pullOptions{runtime: command, mode: config.PullModeCLI, ociLayout: t.TempDir()})
+	if err == nil {
+		t.Fatal("pullImage() succeeded for a missing image")
+	}
+	if calls := runtimeCalls(t, dir); len(calls) != 0 {
+		t.Errorf("runtime calls = %q, want none", calls)
+	}
+}
+
+func TestPullImageCLIMode(t *testing.T) {
+	host, requests := newImageRegistry(t)
+	command, dir := fakeRuntime(t)
+
+	source := host + "/app:v1"
+	if err := pullImage(source, "app:v1", pullOptions{runtime: command, mode: config.PullModeCLI}); err != nil {
+		t.Fatal(err)
+	}
+	if requests.Load() != 0 {
+		t.Errorf("registry received %d requests in cli mode, want 0", requests.Load())
+	}
+	if calls := runtimeCalls(t, dir); len(calls) == 0 || calls[0] != "pull "+source {
+		t.Errorf("runtime calls = %q, want pull first", calls)
+	}
+}
+
+func TestLoadCommand(t *testing.T) {
+	tests := []struct {
+		runtime string
+		want    string
+	}{
+		{"", "docker load"},
+		{"docker", "docker load"},
+		{"podman", "podman load"},
+		{"nerdctl --namespace k8s.io", "nerdctl --namespace k8s.io load"},
+		{"crictl", "ctr -n k8s.io images import -"},
+		{"k3s crictl", "k3s ctr -n k8s.io images import -"},
+		{"k3s ctr", "k3s ctr -n k8s.io images import -"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(loadCommand(tt.runtime), " "); got != tt.want {
+			t.Errorf("loadCommand(%q) = %q, want %q", tt.runtime, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package rewrite
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pmezard/go-difflib/difflib"
+
+	"github.com/keevingness/image-shipper/internal/config"
+	"github.com/keevingness/image-shipper/internal/flagutil"
+	"github.com/keevingness/image-shipper/pkg/docker"
+	"github.com/keevingness/image-shipper/pkg/yamlparser"
+)
+
+// Run 执行rewrite命令，将文件中的镜像地址改写为转存后的地址
+func Run() {
+	fs := flag.NewFlagSet("rewrite", flag.ExitOnError)
+	var filePaths flagutil.StringList
+	fs.Var(&filePaths, "f", "要改写的Docker Compose、Kubernetes YAML文件、Dockerfile、kustomization、目录或通配符，可重复指定")
+	var includes, excludes flagutil.StringList
+	fs.Var(&includes, "include", "扫描目录时包含的文件模式，可重复指定（默认 YAML 文件和 Dockerfile）")
+	fs.Var(&excludes, "exclude", "扫描目录时排除的文件或目录模式，可重复指定")
+	fileType := fs.String("type", "", "强制使用的解析器：compose、k8s、kustomize、dockerfile，默认按内容判断")
+	showDiff := fs.Bool("diff", false, "以统一diff格式显示改写内容")
+	inPlace := fs.Bool("in-place", false, "直接修改文件")
+	targetName := fs.String("target", "", "目标仓库名称，对应配置文件targets中的配置")
+	configFile := fs.String("config", "", "指定配置文件路径")
+
+	// 检查是否请求帮助
+	for _, arg := range os.Args[2:] {
+		if arg == "--help" || arg == "-h" {
+			printUsage()
+			return
+		}
+	}
+
+	fs.Parse(os.Args[2:])
+
+	if len(filePaths) == 0 {
+		printUsage()
+		os.Exit(1)
+	}
+
+	// 只用到目标仓库和改写规则，不要求GitHub配置完整
+	cfg, err := config.Load(config.Options{ConfigFile: *configFile, SkipValidation: true})
+	if err != nil {
+		fmt.Printf("加载配置失败: %v\n", err)
+		os.Exit(1)
+	}
+	target, err := cfg.ResolveTarget(*targetName)
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(1)
+	}
+	mirror, err := cfg.MirrorRewriter(target)
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(1)
+	}
+	rewriteImage := func(image string) (string, bool) {
+		ref, err := docker.ParseReference(image)
+		if err != nil {
+			return "", false
+		}
+		return mirror(ref)
+	}
+
+	opts := yamlparser.ParseOptions{ImagePaths: cfg.Parse.ImagePaths, Include: includes, Exclude: excludes}
+	if *fileType != "" {
+		opts.Type, err = yamlparser.ParseFileType(*fileType)
+		if err != nil {
+			fmt.Printf("错误: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	files, err := yamlparser.ExpandPaths(filePaths, opts)
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(1)
+	}
+
+	// 扫描目录得到的文件不一定是清单，无法解析时只给出警告
+	explicit := map[string]bool{}
+	for _, filePath := range filePaths {
+		if !yamlparser.IsScanPath(filePath) {
+			explicit[filepath.Clean(filePath)] = true
+		}
+	}
+
+	failed, changed := 0, 0
+	for _, filePath := range files {
+		result, err := yamlparser.RewriteFile(filePath, opts, rewriteImage)
+		if err != nil && !explicit[filepath.Clean(filePath)] {
+			fmt.Printf("警告: 跳过 %s: %v\n", filePath, err)
+			continue
+		}
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			failed++
+			continue
+		}
+		if !result.Changed() {
+			fmt.Printf("%s: 没有需要改写的镜像\n", result.File)
+			continue
+		}
+		changed++
+
+		if *showDiff {
+			diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+				A:        difflib.SplitLines(string(result.Original)),
+				B:        difflib.SplitLines(string(result.Content)),
+				FromFile: "a/" + result.File,
+				ToFile:   "b/" + result.File,
+				Context:  3,
+			})
+			if err != nil {
+				fmt.Printf("❌ 生成 %s 的diff失败: %v\n", result.File, err)
+				failed++
+				continue
+			}
+			fmt.Print(diff)
+		} else {
+			for _, edit := range result.Edits {
+				fmt.Printf("%s: %s -> %s\n", edit.Source(), edit.Image, edit.NewImage)
+			}
+		}
+
+		if *inPlace {
+			info, err := os.Stat(result.File)
+			if err != nil {
+				fmt.Printf("❌ %v\n", err)
+				failed++
+				continue
+			}
+			if err := os.WriteFile(result.File, result.Content, info.Mode().Perm()); err != nil {
+				fmt.Printf("❌ 写入 %s 失败: %v\n", result.File, err)
+				failed++
+				continue
+			}
+			fmt.Printf("✅ 已改写 %s 中的 %d 处镜像\n", result.File, len(result.Edits))
+		}
+	}
+
+	if changed > 0 && !*inPlace {
+		fmt.Println("\n📝 注意: 未修改文件，使用 --in-place 写入改写结果")
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// printUsage 打印使用说明
+func printUsage() {
+	fmt.Println("ImageShipper Rewrite - 清单镜像改写工具")
+	fmt.Println("")
+	fmt.Println("用法:")
+	fmt.Println("  ./app rewrite -f <文件路径> [选项]")
+	fmt.Println("")
+	fmt.Println("选项:")
+	fmt.Println("  -f <文件路径>   要改写的Docker Compose、Kubernetes YAML文件、Dockerfile或kustomization目录，可重复指定")
+	fmt.Println("                  也可以是目录或通配符（如 'deploy/**/*.yaml'），递归扫描并遵循.gitignore")
+	fmt.Println("  --include <模式> 扫描目录时包含的文件，可重复指定（默认 YAML 文件和 Dockerfile）")
+	fmt.Println("  --exclude <模式> 扫描目录时排除的文件或目录，可重复指定")
+	fmt.Println("  --type <类型>   强制使用的解析器：compose、k8s、kustomize、dockerfile（默认按内容判断）")
+	fmt.Println("  --diff          以统一diff格式显示改写内容")
+	fmt.Println("  --in-place      直接修改文件，只替换镜像地址，注释和格式保持不变")
+	fmt.Println("  --target <名称> 目标仓库，对应配置文件targets中的配置（默认使用ship.target）")
+	fmt.Println("  --config <路径> 指定配置文件，不再搜索默认路径")
+	fmt.Println("")
+	fmt.Println("  配置了目标仓库时，镜像改写为转存工作流推送到的地址；否则按pull.rewrites和pull.source_registry改写")
+	fmt.Println("")
+	fmt.Println("示例:")
+	fmt.Println("  ./app rewrite -f deployment.yaml                    # 列出需要改写的镜像")
+	fmt.Println("  ./app rewrite -f docker-compose.yaml --diff         # 显示改写前后的差异")
+	fmt.Println("  ./app rewrite -f overlays/prod --in-place           # 在kustomization的images中改写镜像")
+	fmt.Println("  ./app rewrite -f ./deploy --exclude 'test/**' --in-place  # 改写目录中的所有清单")
+	fmt.Println("  ./app rewrite -f deployment.yaml --target harbor --in-place  # 改写为harbor中的地址")
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/keevingness/image-shipper/cmd/config"
 	"github.com/keevingness/image-shipper/cmd/pull"
+	"github.com/keevingness/image-shipper/cmd/rewrite"
 	"github.com/keevingness/image-shipper/cmd/ship"
 )
 
@@ -20,6 +22,10 @@ func Run() {
 		ship.Run()
 	case "pull":
 		pull.Run()
+	case "rewrite":
+		rewrite.Run()
+	case "config":
+		config.Run()
 	case "help", "-h", "--help":
 		printUsage()
 	default:
@@ -37,10 +43,14 @@ func printUsage() {
 	fmt.Println("可用命令:")
 	fmt.Println("  ship    转存 Docker 镜像")
 	fmt.Println("  pull    获取并重新标记 Docker 镜像")
+	fmt.Println("  rewrite 将清单中的镜像改写为转存后的地址")
+	fmt.Println("  config  显示当前生效的配置及其来源")
 	fmt.Println("  help    显示帮助信息")
 	fmt.Println("")
 	fmt.Println("示例:")
 	fmt.Println("  ./app ship nginx:latest  # 转存 nginx:latest 镜像")
 	fmt.Println("  ./app pull nginx:latest  # 获取并重新标记 nginx:latest 镜像")
+	fmt.Println("  ./app rewrite -f deployment.yaml --in-place  # 改写清单中的镜像地址")
+	fmt.Println("  ./app config    # 显示当前配置及每项的来源")
 	fmt.Println("  ./app help      # 显示帮助信息")
 }
@@ -0,0 +1,393 @@
+package ship
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/term"
+	"golang.org/x/text/width"
+
+	"github.com/keevingness/image-shipper/internal/shipper"
+	"github.com/keevingness/image-shipper/internal/types"
+)
+
+// 批量转存中单个镜像的状态
+const (
+	itemQueued    = "排队中"
+	itemTriggered = "已触发"
+	itemSucceeded = "成功"
+	itemFailed    = "失败"
+)
+
+// batchItem 批量转存中的单个镜像
+type batchItem struct {
+	Image     string
+	Target    string
+	Digest    string
+	Platforms []string
+	State     string
+	Detail    string
+	URL       string
+	Started   time.Time
+	Finished  time.Time
+}
+
+// batchExecutor 并发提交并跟踪多个转存请求
+type batchExecutor struct {
+	backend     shipper.Shipper
+	logger      *zap.Logger
+	target      *types.Target
+	platforms   []string
+	parallelism int
+
+	mu    sync.Mutex
+	items []*batchItem
+}
+
+// newBatchExecutor 创建批量转存执行器
+func newBatchExecutor(backend shipper.Shipper, logger *zap.Logger, target *types.Target, platforms []string, parallelism int) *batchExecutor {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	return &batchExecutor{
+		backend:     backend,
+		logger:      logger,
+		target:      target,
+		platforms:   platforms,
+		parallelism: parallelism,
+	}
+}
+
+// Run 转存所有镜像，全部结束后返回每个镜像的最终状态
+// 单个镜像失败不会影响其他镜像；ctx被取消时尚未开始的镜像直接标记为失败。
+func (b *batchExecutor) Run(ctx context.Context, images []string) []batchItem {
+	b.items = make([]*batchItem, len(images))
+	for i, image := range images {
+		b.items[i] = &batchItem{Image: image, State: itemQueued}
+	}
+
+	renderer := newProgressTable(os.Stdout)
+	stopRender := make(chan struct{})
+	renderDone := make(chan struct{})
+	go func() {
+		defer close(renderDone)
+		ticker := time.NewTicker(500 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			renderer.Render(b.snapshot())
+			select {
+			case <-ticker.C:
+			case <-stopRender:
+				renderer.Render(b.snapshot())
+				return
+			}
+		}
+	}()
+
+	sem := make(chan struct{}, b.parallelism)
+	var wg sync.WaitGroup
+	for _, item := range b.items {
+		wg.Add(1)
+		go func(item *batchItem) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				b.finish(item, itemFailed, "已取消", "")
+				return
+			}
+			b.ship(ctx, item)
+		}(item)
+	}
+	wg.Wait()
+
+	close(stopRender)
+	<-renderDone
+
+	return b.snapshot()
+}
+
+// ship 提交单个镜像的转存并等待运行结束
+func (b *batchExecutor) ship(ctx context.Context, item *batchItem) {
+	if ctx.Err() != nil {
+		b.finish(item, itemFailed, "已取消", "")
+		return
+	}
+	if err := validateImage(item.Image); err != nil {
+		b.finish(item, itemFailed, err.Error(), "")
+		return
+	}
+
+	request, err := b.backend.Submit(ctx, []string{item.Image}, b.target, b.platforms)
+	if err != nil {
+		b.finish(item, itemFailed, fmt.Sprintf("提交转存失败: %v", err), "")
+		return
+	}
+	b.update(item, func(i *batchItem) {
+		i.State = itemTriggered
+		i.Detail = "等待运行记录出现"
+		i.Started = time.Now()
+	})
+
+	response, err := waitForWorkflow(ctx, b.backend, b.logger, request, func(status string) {
+		b.update(item, func(i *batchItem) { i.Detail = status })
+	})
+	if err != nil {
+		b.finish(item, itemFailed, err.Error(), "")
+		return
+	}
+
+	// 读取运行结果中的目标地址和摘要，失败时的具体原因也记录在其中
+	results, resultsErr := b.backend.Results(ctx, request)
+	if response.Conclusion != "success" {
+		detail := response.Conclusion
+		if resultsErr == nil && len(results) > 0 && results[0].Error != "" {
+			detail = results[0].Error
+		}
+		b.finish(item, itemFailed, detail, response.URL)
+		return
+	}
+	b.finish(item, itemSucceeded, "", response.URL)
+
+	if resultsErr != nil || len(results) == 0 {
+		b.logger.Warn("获取转存结果失败", zap.String("request_id", request.ID), zap.Error(resultsErr))
+		return
+	}
+	b.update(item, func(i *batchItem) {
+		i.Target = results[0].Target
+		i.Digest = results[0].Digest
+		i.Platforms = results[0].Platforms
+	})
+}
+
+// update 在锁保护下修改镜像状态
+func (b *batchExecutor) update(item *batchItem, fn func(*batchItem)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	fn(item)
+}
+
+// finish 标记镜像处理结束
+func (b *batchExecutor) finish(item *batchItem, state, detail, url string) {
+	b.update(item, func(i *batchItem) {
+		i.State = state
+		i.Detail = detail
+		i.URL = url
+		i.Finished = time.Now()
+	})
+}
+
+// snapshot 复制当前所有镜像的状态，供渲染和汇总使用
+func (b *batchExecutor) snapshot() []batchItem {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	items := make([]batchItem, len(b.items))
+	for i, item := range b.items {
+		items[i] = *item
+	}
+	return items
+}
+
+// progressTable 在终端中渲染多行进度表
+// 输出为终端时原地刷新整张表；否则只在镜像状态变化时追加一行，便于写入日志文件。
+type progressTable struct {
+	out      *os.File
+	tty      bool
+	lines    int
+	lastSeen []string
+	spinner  int
+}
+
+// newProgressTable 创建进度表
+func newProgressTable(out *os.File) *progressTable {
+	tty := false
+	if info, err := out.Stat(); err == nil {
+		tty = info.Mode()&os.ModeCharDevice != 0
+	}
+	return &progressTable{out: out, tty: tty}
+}
+
+// Render 渲染当前状态
+func (p *progressTable) Render(items []batchItem) {
+	if !p.tty {
+		p.renderChanges(items)
+		return
+	}
+
+	spinners := []string{"|", "/", "-", "\\"}
+	p.spinner = (p.spinner + 1) % len(spinners)
+
+	var sb strings.Builder
+	// 回到上次输出的表格起始位置
+	if p.lines > 0 {
+		fmt.Fprintf(&sb, "\033[%dA", p.lines)
+	}
+
+	// 超出终端宽度的行会折行，上移的行数就对不上了，因此每行截断到终端宽度
+	columns := 0
+	if cols, _, err := term.GetSize(int(p.out.Fd())); err == nil {
+		columns = cols
+	}
+
+	imageWidth := 0
+	for _, item := range items {
+		if len(item.Image) > imageWidth {
+			imageWidth = len(item.Image)
+		}
+	}
+
+	finished := 0
+	for _, item := range items {
+		icon := spinners[p.spinner]
+		switch item.State {
+		case itemQueued:
+			icon = "·"
+		case itemSucceeded:
+			icon = "✅"
+			finished++
+		case itemFailed:
+			icon = "❌"
+			finished++
+		}
+		line := fmt.Sprintf("%s %-*s  %-4s %s%s", icon, imageWidth, item.Image, item.State, item.Detail, elapsed(item))
+		fmt.Fprintf(&sb, "\033[2K%s\n", truncateLine(line, columns))
+	}
+	fmt.Fprintf(&sb, "\033[2K%s\n", truncateLine(fmt.Sprintf("进度: %d/%d", finished, len(items)), columns))
+
+	p.lines = len(items) + 1
+	fmt.Fprint(p.out, sb.String())
+}
+
+// truncateLine 将一行截断到终端的显示宽度，columns为0时不截断
+// 中文和emoji按两列计算；换行等控制字符替换为空格，保证每项只占一行。
+func truncateLine(line string, columns int) string {
+	line = strings.Map(func(r rune) rune {
+		if r < ' ' || r == 0x7f {
+			return ' '
+		}
+		return r
+	}, line)
+	if columns <= 0 {
+		return line
+	}
+
+	// 留出最后一列，避免写满一行时终端提前换行
+	limit := columns - 1
+	const ellipsis = "..."
+	used := 0
+	cut := -1
+	for i, r := range line {
+		w := runeWidth(r)
+		if cut < 0 && used+w > limit-len(ellipsis) {
+			cut = i
+		}
+		if used+w > limit {
+			if cut < 0 || limit < len(ellipsis) {
+				return line[:i]
+			}
+			return line[:cut] + ellipsis
+		}
+		used += w
+	}
+	return line
+}
+
+// runeWidth 返回字符在终端中占用的列数
+func runeWidth(r rune) int {
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return 2
+	}
+	return 1
+}
+
+// renderChanges 非终端输出时逐行打印状态变化
+func (p *progressTable) renderChanges(items []batchItem) {
+	if p.lastSeen == nil {
+		p.lastSeen = make([]string, len(items))
+	}
+	for i, item := range items {
+		key := item.State + "|" + item.Detail
+		if p.lastSeen[i] == key {
+			continue
+		}
+		p.lastSeen[i] = key
+		fmt.Fprintf(p.out, "[%d/%d] %s: %s %s\n", i+1, len(items), item.Image, item.State, item.Detail)
+	}
+}
+
+// elapsed 返回镜像已耗费的时间描述
+func elapsed(item batchItem) string {
+	if item.Started.IsZero() {
+		return ""
+	}
+	end := item.Finished
+	if end.IsZero() {
+		end = time.Now()
+	}
+	return fmt.Sprintf(" (%s)", end.Sub(item.Started).Round(time.Second))
+}
+
+// printSummary 打印批量转存汇总，返回失败的镜像数量
+func printSummary(items []batchItem) int {
+	var failed []batchItem
+	succeeded := 0
+	for _, item := range items {
+		if item.State == itemSucceeded {
+			succeeded++
+		} else {
+			failed = append(failed, item)
+		}
+	}
+
+	fmt.Println("\n📊 转存结果:")
+	for _, item := range items {
+		if item.State == itemSucceeded && item.Target != "" {
+			fmt.Printf("  ✅ %s -> %s\n", item.Image, item.result().PinnedTarget())
+		} else if item.State == itemSucceeded {
+			fmt.Printf("  ✅ %s\n", item.Image)
+		} else {
+			fmt.Printf("  ❌ %s: %s\n", item.Image, item.Detail)
+		}
+		if len(item.Platforms) > 0 {
+			fmt.Printf("     平台: %s\n", strings.Join(item.Platforms, ", "))
+		}
+		if item.URL != "" {
+			fmt.Printf("     运行详情: %s\n", item.URL)
+		}
+	}
+
+	fmt.Printf("\n总结: 成功 %d 个，失败 %d 个\n", succeeded, len(failed))
+	return len(failed)
+}
+
+// result 转换为与运行结果相同结构的转存结果，用于写入 --results 指定的文件
+func (i batchItem) result() types.ImageResult {
+	result := types.ImageResult{
+		Image:     i.Image,
+		Target:    i.Target,
+		Digest:    i.Digest,
+		Platforms: i.Platforms,
+		Status:    "success",
+	}
+	if i.State != itemSucceeded {
+		result.Status = "failed"
+		result.Error = i.Detail
+	}
+	return result
+}
+
+// itemResults 转换所有镜像的转存结果
+func itemResults(items []batchItem) []types.ImageResult {
+	results := make([]types.ImageResult, len(items))
+	for i, item := range items {
+		results[i] = item.result()
+	}
+	return results
+}
@@ -0,0 +1,69 @@
+package ship
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTruncateLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		columns int
+		want    string
+	}{
+		{name: "fits", line: "nginx:1.25 成功", columns: 20, want: "nginx:1.25 成功"},
+		{name: "no terminal width", line: strings.Repeat("a", 200), columns: 0, want: strings.Repeat("a", 200)},
+		{name: "ascii", line: "nginx:1.25  失败 manifest unknown", columns: 20, want: "nginx:1.25  失败..."},
+		// 中文按两列计算，截断时不会拆开宽字符
+		{name: "wide", line: "❌ app  失败 转存失败，详见运行日志", columns: 16, want: "❌ app  失败..."},
+		// 错误信息中的换行会让表格多占一行
+		{name: "newlines", line: "❌ app  失败 line one\nline two\r\n", columns: 0, want: "❌ app  失败 line one line two  "},
+		{name: "narrow", line: "progress", columns: 3, want: "pr"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncateLine(tt.line, tt.columns)
+			if got != tt.want {
+				t.Errorf("truncateLine() = %q, want %q", got, tt.want)
+			}
+			if tt.columns > 0 {
+				used := 0
+				for _, r := range got {
+					used += runeWidth(r)
+				}
+				if used >= tt.columns {
+					t.Errorf("truncateLine() uses %d columns, terminal has %d", used, tt.columns)
+				}
+			}
+		})
+	}
+}
+
+func TestProgressTableNotTerminal(t *testing.T) {
+	out, err := os.Create(filepath.Join(t.TempDir(), "progress.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+
+	// 输出到文件时只追加状态变化，不截断
+	table := newProgressTable(out)
+	items := []batchItem{{Image: "nginx:1.25", State: itemQueued}, {Image: "redis:7", State: itemQueued}}
+	table.Render(items)
+	items[1].State = itemFailed
+	items[1].Detail = strings.Repeat("x", 300)
+	table.Render(items)
+	table.Render(items)
+
+	data, err := os.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "[1/2] nginx:1.25: 排队中 \n[2/2] redis:7: 排队中 \n[2/2] redis:7: 失败 " + strings.Repeat("x", 300) + "\n"
+	if string(data) != want {
+		t.Errorf("output =\n%s\nwant\n%s", data, want)
+	}
+}
@@ -1,261 +1,546 @@
 package ship
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
 	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"go.uber.org/zap"
 
 	"github.com/keevingness/image-shipper/internal/config"
-	"github.com/keevingness/image-shipper/internal/github"
+	"github.com/keevingness/image-shipper/internal/flagutil"
+	"github.com/keevingness/image-shipper/internal/shipper"
+	"github.com/keevingness/image-shipper/internal/types"
+	"github.com/keevingness/image-shipper/pkg/docker"
 	"github.com/keevingness/image-shipper/pkg/yamlparser"
 )
 
+// workflowTimeout 单个运行的最长等待时间
+const workflowTimeout = 30 * time.Minute
+
 // Run 执行ship命令
 func Run() {
 	// 解析命令行参数
 	fs := flag.NewFlagSet("ship", flag.ExitOnError)
-	filePath := fs.String("f", "", "指定Docker Compose或Kubernetes YAML文件路径")
+	var filePaths flagutil.StringList
+	fs.Var(&filePaths, "f", "指定Docker Compose、Kubernetes YAML文件、Dockerfile、Helm Chart、kustomization、目录、通配符、URL或 -（标准输入），可重复指定")
+	var profiles flagutil.StringList
+	fs.Var(&profiles, "profile", "解析Compose文件时启用的profile，可重复指定")
+	var includes, excludes flagutil.StringList
+	fs.Var(&includes, "include", "扫描目录时包含的文件模式，可重复指定（默认 YAML 文件和 Dockerfile）")
+	fs.Var(&excludes, "exclude", "扫描目录时排除的文件或目录模式，可重复指定")
+	fileType := fs.String("type", "", "强制使用的解析器：compose、k8s、helm、kustomize、dockerfile，默认按内容判断")
 	dryRun := fs.Bool("dry-run", false, "仅解析文件并显示镜像，不执行实际推送操作")
-	
+	configFile := fs.String("config", "", "指定配置文件路径")
+	parallel := fs.Int("parallel", 0, "批量转存时同时运行的工作流数量上限")
+	singleRun := fs.Bool("single-run", false, "在单个工作流运行中转存文件中的全部镜像")
+	backendName := fs.String("backend", "", "执行转存的后端：github、gitlab、gitea、local，默认使用配置项ship.backend")
+	local := fs.Bool("local", false, "在本机直接从源仓库复制到目标仓库，等同于 --backend local")
+	resultsFile := fs.String("results", "", "将每个镜像的转存结果以JSON Lines格式追加到指定文件")
+	targetName := fs.String("target", "", "目标仓库名称，对应配置文件targets中的配置")
+	valuesFiles := fs.String("values", "", "渲染Helm Chart时使用的values文件，多个文件用逗号分隔")
+	var platforms platformList
+	fs.Var(&platforms, "platform", "只复制指定的平台，如 linux/arm64，可重复指定或用逗号分隔")
+
 	// 解析参数
 	if len(os.Args) < 3 {
 		printUsage()
 		os.Exit(1)
 	}
-	
+
 	// 解析标志
-	fs.Parse(os.Args[2:])
-	
+	fs.Parse(splitLegacyPlatform(os.Args[2:]))
+
+	// 文件解析选项：Helm Chart的values文件和配置中的附加镜像路径
+	// 这里只读取配置不做校验，dry-run时不要求GitHub配置完整
+	var parseOpts yamlparser.ParseOptions
+	if len(filePaths) > 0 {
+		parseCfg, err := config.Load(config.Options{ConfigFile: *configFile, SkipValidation: true})
+		if err != nil {
+			fmt.Printf("加载配置失败: %v\n", err)
+			os.Exit(1)
+		}
+		parseOpts.ImagePaths = parseCfg.Parse.ImagePaths
+		parseOpts.Profiles = profiles
+		parseOpts.Include = includes
+		parseOpts.Exclude = excludes
+		if *valuesFiles != "" {
+			parseOpts.ValuesFiles = strings.Split(*valuesFiles, ",")
+		}
+		if *fileType != "" {
+			parseOpts.Type, err = yamlparser.ParseFileType(*fileType)
+			if err != nil {
+				fmt.Printf("错误: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		// dry-run时显示每个文件的类型判断结果，便于确认是否需要 --type
+		if *dryRun {
+			parseOpts.OnDetect = func(name string, detection yamlparser.Detection) {
+				fmt.Printf("🔍 %s: %s\n", name, detection)
+			}
+		}
+	}
+
+	// 命令行参数优先级最高，作为覆盖项传给配置加载器
+	overrides := map[string]string{}
+	if *parallel > 0 {
+		overrides["ship.parallelism"] = strconv.Itoa(*parallel)
+	}
+	if *singleRun {
+		overrides["ship.single_run"] = "true"
+	}
+	if *targetName != "" {
+		overrides["ship.target"] = *targetName
+	}
+	if *backendName != "" {
+		overrides["ship.backend"] = *backendName
+	}
+	if *local {
+		overrides["ship.backend"] = config.ShipBackendLocal
+	}
+
 	// 检查是否指定了文件路径
-	if *filePath != "" {
+	if len(filePaths) > 0 {
 		// 从文件中解析镜像
-		images, err := yamlparser.ParseFile(*filePath)
+		images, err := yamlparser.ParseFilesWithOptions(filePaths, parseOpts)
 		if err != nil {
 			fmt.Printf("解析文件失败: %v\n", err)
 			os.Exit(1)
 		}
-		
+
 		// 显示解析出的镜像
-		fmt.Printf("从文件 %s 中解析出以下镜像:\n", *filePath)
-		for i, image := range images {
-			fmt.Printf("%d. %s\n", i+1, image)
-		}
-		
+		fmt.Printf("从文件 %s 中解析出以下镜像:\n", strings.Join(filePaths, ", "))
+		yamlparser.PrintFoundImages(os.Stdout, images)
+
 		// 如果是dry-run模式，则不执行实际推送
 		if *dryRun {
 			fmt.Println("\n📝 注意: 运行在dry-run模式下，未执行实际推送操作")
 			return
 		}
-		
-		// 加载配置
-		cfg, err := config.LoadWithDefaults()
-		if err != nil {
-			fmt.Printf("加载配置失败: %v\n", err)
-			os.Exit(1)
-		}
 
-		// 初始化日志
-		logger, err := initLogger()
-		if err != nil {
-			fmt.Printf("初始化日志失败: %v\n", err)
-			os.Exit(1)
+		if len(images) == 0 {
+			fmt.Println("在文件中未找到任何镜像")
+			return
 		}
+
+		cfg, target, backend, logger := setup(*configFile, overrides)
 		defer logger.Sync()
 
-		// 创建GitHub客户端
-		githubClient := github.NewClient(
-			cfg.GitHub.Token,
-			cfg.GitHub.Owner,
-			cfg.GitHub.Repo,
-			cfg.GitHub.Workflow,
-			logger,
-		)
-		
-		// 设置信号处理
-		sigChan := make(chan os.Signal, 1)
-		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-		
-		// 逐个处理镜像
-		for i, image := range images {
-			fmt.Printf("\n正在处理镜像 %d/%d: %s\n", i+1, len(images), image)
-			shipSingleImage(image, githubClient, logger, sigChan)
+		// 收到中断信号时取消所有正在等待的运行
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
+		var results []batchItem
+		if cfg.Ship.SingleRun {
+			// 所有镜像在同一个运行中转存，省去每个镜像单独启动运行器的开销
+			results = shipInSingleRun(ctx, yamlparser.ImageNames(images), target, platforms, backend, logger)
+		} else {
+			// 并发转存所有镜像，全部结束后统一汇总
+			fmt.Printf("\n开始批量转存，并发数: %d\n\n", cfg.Ship.Parallelism)
+			executor := newBatchExecutor(backend, logger, target, platforms, cfg.Ship.Parallelism)
+			results = executor.Run(ctx, yamlparser.ImageNames(images))
+		}
+
+		if err := appendResults(*resultsFile, itemResults(results)); err != nil {
+			fmt.Printf("写入转存结果失败: %v\n", err)
+		}
+		if failed := printSummary(results); failed > 0 {
+			stop()
+			logger.Sync()
+			os.Exit(1)
 		}
-		
-		fmt.Println("\n✅ 所有镜像处理完成!")
 		return
 	}
-	
+
 	// 如果没有指定文件，则使用传统方式处理单个镜像
 	if len(fs.Args()) == 0 {
 		printUsage()
 		os.Exit(1)
 	}
-	
+
 	imageURL := fs.Args()[0]
 	if imageURL == "" {
 		fmt.Println("错误: 镜像地址不能为空")
 		os.Exit(1)
 	}
-	
+
+	if err := validateImage(imageURL); err != nil {
+		fmt.Printf("错误: 无效的镜像地址格式: %v\n", err)
+		os.Exit(1)
+	}
+
 	// 如果是dry-run模式，则不执行实际推送
 	if *dryRun {
 		fmt.Printf("📝 注意: 运行在dry-run模式下，将处理镜像: %s\n", imageURL)
 		return
 	}
-	
+
+	_, target, backend, logger := setup(*configFile, overrides)
+	defer logger.Sync()
+
+	// 设置信号处理，允许用户中断轮询
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// 转存单个镜像
+	result, err := shipSingleImage(ctx, imageURL, target, platforms, backend, logger)
+	if writeErr := appendResults(*resultsFile, []types.ImageResult{result}); writeErr != nil {
+		fmt.Printf("写入转存结果失败: %v\n", writeErr)
+	}
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		stop()
+		logger.Sync()
+		os.Exit(1)
+	}
+}
+
+// setup 加载配置、解析目标仓库并创建日志记录器和转存后端，失败时直接退出
+func setup(configFile string, overrides map[string]string) (*config.Config, *types.Target, shipper.Shipper, *zap.Logger) {
 	// 加载配置
-	cfg, err := config.LoadWithDefaults()
+	cfg, err := config.Load(config.Options{ConfigFile: configFile, Flags: overrides})
 	if err != nil {
 		fmt.Printf("加载配置失败: %v\n", err)
 		os.Exit(1)
 	}
 
+	// 解析目标仓库，未配置时由工作流使用默认的阿里云配置
+	target, err := cfg.ResolveTarget("")
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(1)
+	}
+	if target != nil {
+		fmt.Printf("目标仓库: %s (%s %s/%s)\n", target.Name, target.Type, target.Registry, target.Namespace)
+	}
+
 	// 初始化日志
 	logger, err := initLogger()
 	if err != nil {
 		fmt.Printf("初始化日志失败: %v\n", err)
 		os.Exit(1)
 	}
-	defer logger.Sync()
 
-	// 创建GitHub客户端
-	githubClient := github.NewClient(
-		cfg.GitHub.Token,
-		cfg.GitHub.Owner,
-		cfg.GitHub.Repo,
-		cfg.GitHub.Workflow,
-		logger,
-	)
-	
-	// 设置信号处理，允许用户中断轮询
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	
-	// 触发单个镜像的工作流
-	shipSingleImage(imageURL, githubClient, logger, sigChan)
-	return
+	// 按配置创建转存后端
+	backend, err := shipper.New(cfg, logger)
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(1)
+	}
+
+	return cfg, target, backend, logger
 }
 
-// shipSingleImage 处理单个镜像的转存
-func shipSingleImage(imageURL string, githubClient *github.Client, logger *zap.Logger, sigChan chan os.Signal) {
-	// 触发工作流
-	fmt.Printf("正在触发镜像转存工作流: %s\n", imageURL)
-	request, err := githubClient.TriggerMirrorWorkflow(imageURL, "")
+// shipSingleImage 处理单个镜像的转存，并在终端显示进度指示器
+// 返回的结果在失败时也会记录镜像和错误信息。
+func shipSingleImage(ctx context.Context, imageURL string, target *types.Target, platforms []string, backend shipper.Shipper, logger *zap.Logger) (types.ImageResult, error) {
+	failed := types.ImageResult{Image: imageURL, Status: "failed"}
+	fail := func(err error) (types.ImageResult, error) {
+		failed.Error = err.Error()
+		return failed, err
+	}
+
+	// 提交转存请求
+	fmt.Printf("正在提交镜像转存: %s\n", imageURL)
+	request, err := backend.Submit(ctx, []string{imageURL}, target, platforms)
 	if err != nil {
-		fmt.Printf("触发工作流失败: %v\n", err)
-		os.Exit(1)
+		return fail(fmt.Errorf("提交转存失败: %w", err))
 	}
 
-	fmt.Printf("工作流已触发，请求ID: %s\n", request.ID)
-	fmt.Println("正在等待工作流执行完成...")
+	fmt.Printf("已提交，请求ID: %s\n", request.ID)
+	fmt.Println("正在等待运行完成...")
 
-	// 轮询工作流状态
-	ticker := time.NewTicker(10 * time.Second)
-	defer ticker.Stop()
+	response, err := watchWorkflow(ctx, backend, logger, request)
+	if err != nil {
+		return fail(err)
+	}
+
+	results, resultsErr := backend.Results(ctx, request)
+	if response.Conclusion != "success" {
+		printURL(response.URL)
+		// 运行结果中有具体原因时优先显示，否则显示运行日志的末尾
+		if resultsErr == nil && len(results) > 0 && results[0].Error != "" {
+			return fail(fmt.Errorf("镜像转存失败: %s", results[0].Error))
+		}
+		printLogTail(ctx, backend, logger, request)
+		return fail(fmt.Errorf("镜像转存失败: %s", response.Conclusion))
+	}
+	fmt.Println("✅ 镜像转存成功!")
+	printURL(response.URL)
+
+	// 输出按摘要固定的目标地址，便于写入部署清单
+	if resultsErr != nil || len(results) == 0 {
+		logger.Warn("获取转存结果失败", zap.String("request_id", request.ID), zap.Error(resultsErr))
+		return types.ImageResult{Image: imageURL, Status: "success"}, nil
+	}
+	fmt.Printf("目标镜像: %s\n", results[0].PinnedTarget())
+	if len(results[0].Platforms) > 0 {
+		fmt.Printf("已复制平台: %s\n", strings.Join(results[0].Platforms, ", "))
+	}
+	return results[0], nil
+}
+
+// printURL 显示运行详情地址，本地转存没有详情页面
+func printURL(url string) {
+	if url != "" {
+		fmt.Printf("运行详情: %s\n", url)
+	}
+}
+
+// printLogTail 显示运行日志的最后几行，获取失败时只记录日志
+func printLogTail(ctx context.Context, backend shipper.Shipper, logger *zap.Logger, request *types.MirrorRequest) {
+	const tailLines = 20
+	logs, err := backend.Logs(ctx, request)
+	if err != nil {
+		logger.Warn("获取运行日志失败", zap.String("request_id", request.ID), zap.Error(err))
+		return
+	}
+	lines := strings.Split(strings.TrimRight(logs, "\n"), "\n")
+	if len(lines) > tailLines {
+		lines = lines[len(lines)-tailLines:]
+	}
+	fmt.Printf("运行日志（最后 %d 行）:\n", len(lines))
+	for _, line := range lines {
+		fmt.Printf("  %s\n", line)
+	}
+}
+
+// appendResults 将转存结果以JSON Lines格式追加到文件，path为空时不写入
+func appendResults(path string, results []types.ImageResult) error {
+	if path == "" {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, result := range results {
+		if err := enc.Encode(result); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// shipInSingleRun 在单个运行中转存所有镜像，并从运行结果中解析每个镜像的结果
+func shipInSingleRun(ctx context.Context, images []string, target *types.Target, platforms []string, backend shipper.Shipper, logger *zap.Logger) []batchItem {
+	// 无效的镜像地址不提交给后端，直接记为失败
+	var items, invalid []batchItem
+	var valid []string
+	for _, image := range images {
+		if err := validateImage(image); err != nil {
+			invalid = append(invalid, batchItem{Image: image, State: itemFailed, Detail: err.Error()})
+			continue
+		}
+		valid = append(valid, image)
+		items = append(items, batchItem{Image: image, State: itemFailed})
+	}
+	if len(valid) == 0 {
+		return invalid
+	}
+
+	fmt.Printf("\n正在提交批量转存，共 %d 个镜像\n", len(valid))
+	request, err := backend.Submit(ctx, valid, target, platforms)
+	if err != nil {
+		return append(failAll(items, fmt.Sprintf("提交转存失败: %v", err), ""), invalid...)
+	}
+
+	fmt.Printf("已提交，请求ID: %s\n", request.ID)
+	fmt.Println("正在等待运行完成...")
+
+	response, err := watchWorkflow(ctx, backend, logger, request)
+	if err != nil {
+		return append(failAll(items, err.Error(), ""), invalid...)
+	}
+
+	// 即使运行整体失败，运行结果中也记录了每个镜像各自的结果
+	results, err := backend.Results(ctx, request)
+	if err != nil {
+		logger.Error("获取转存结果失败", zap.String("request_id", request.ID), zap.Error(err))
+		return append(failAll(items, fmt.Sprintf("获取转存结果失败 (%s): %v", response.Conclusion, err), response.URL), invalid...)
+	}
+
+	byImage := make(map[string]types.ImageResult, len(results))
+	for _, result := range results {
+		byImage[result.Image] = result
+	}
+	for i := range items {
+		items[i].URL = response.URL
+		result, ok := byImage[items[i].Image]
+		switch {
+		case !ok:
+			items[i].Detail = "运行结果中缺少该镜像"
+		case result.Status == "success":
+			items[i].State = itemSucceeded
+			items[i].Target = result.Target
+			items[i].Digest = result.Digest
+			items[i].Platforms = result.Platforms
+		default:
+			items[i].Detail = result.Error
+		}
+	}
+	return append(items, invalid...)
+}
 
+// splitLegacyPlatform 兼容旧版写在镜像地址中的平台，如 "--platform=linux/arm64 nginx:latest"
+// 这样的参数拆分为 --platform 参数和镜像地址，转存结果与直接使用 --platform 相同。
+func splitLegacyPlatform(args []string) []string {
+	var out []string
+	for _, arg := range args {
+		fields := strings.Fields(arg)
+		if len(fields) > 1 && strings.HasPrefix(fields[0], "--platform") {
+			fmt.Printf("提示: 镜像地址中的 --platform 写法已过时，已按 %s 处理\n", strings.Join(fields, " "))
+			out = append(out, fields...)
+			continue
+		}
+		out = append(out, arg)
+	}
+	return out
+}
+
+// validateImage 校验镜像地址
+func validateImage(image string) error {
+	_, err := docker.ParseReference(strings.TrimSpace(image))
+	return err
+}
+
+// platformList 可重复指定的 --platform 参数，每个值也可以是逗号分隔的多个平台
+type platformList []string
+
+func (l *platformList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *platformList) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		platform, err := docker.ParsePlatform(strings.TrimSpace(item))
+		if err != nil {
+			return err
+		}
+		name := platform.String()
+		if !slices.Contains(*l, name) {
+			*l = append(*l, name)
+		}
+	}
+	return nil
+}
+
+// failAll 将所有镜像标记为失败
+func failAll(items []batchItem, detail, url string) []batchItem {
+	for i := range items {
+		items[i].State = itemFailed
+		items[i].Detail = detail
+		items[i].URL = url
+	}
+	return items
+}
+
+// watchWorkflow 等待运行结束，并在终端显示进度指示器
+func watchWorkflow(ctx context.Context, backend shipper.Shipper, logger *zap.Logger, request *types.MirrorRequest) (*types.GitHubWorkflowResponse, error) {
 	// 快速更新进度指示器的定时器
 	spinnerTicker := time.NewTicker(200 * time.Millisecond)
 	defer spinnerTicker.Stop()
 
-	timeout := time.After(30 * time.Minute) // 30分钟超时
-
 	// 进度指示器字符
 	spinners := []string{"|", "/", "-", "\\"}
 	spinnerIndex := 0
 
-	// 当前状态信息
-	currentStatus := "in_progress"
-	currentConclusion := "unknown"
+	// 当前状态信息，由轮询协程更新
+	updates := make(chan string, 1)
+	currentStatus := "in_progress, 结论: unknown"
+
+	done := make(chan struct{})
+	var response *types.GitHubWorkflowResponse
+	var waitErr error
+	go func() {
+		defer close(done)
+		response, waitErr = waitForWorkflow(ctx, backend, logger, request, func(status string) {
+			select {
+			case updates <- status:
+			default:
+			}
+		})
+	}()
 
 	// 初始状态显示
-	fmt.Printf("\r工作流状态: %s %s, 结论: %s", spinners[0], currentStatus, currentConclusion)
+	fmt.Printf("\r运行状态: %s %s", spinners[0], currentStatus)
 
 	for {
 		select {
 		case <-spinnerTicker.C:
 			// 更新进度指示器
 			spinnerIndex = (spinnerIndex + 1) % len(spinners)
-			fmt.Printf("\r工作流状态: %s %s, 结论: %s", spinners[spinnerIndex], currentStatus, currentConclusion)
+			fmt.Printf("\r\033[K运行状态: %s %s", spinners[spinnerIndex], currentStatus)
+
+		case currentStatus = <-updates:
+
+		case <-done:
+			// 清除当前行，由调用方显示最终结果
+			fmt.Printf("\r\033[K")
+			return response, waitErr
+		}
+	}
+}
+
+// waitForWorkflow 轮询运行状态直到运行结束、超时或ctx被取消，超时或取消时一并取消运行
+// 每次查询到新状态时调用onUpdate，参数为可直接显示的状态描述
+func waitForWorkflow(ctx context.Context, backend shipper.Shipper, logger *zap.Logger, request *types.MirrorRequest, onUpdate func(status string)) (*types.GitHubWorkflowResponse, error) {
+	ticker := time.NewTicker(shipper.PollInterval(backend))
+	defer ticker.Stop()
+
+	timeout := time.After(workflowTimeout)
 
+	for {
+		select {
 		case <-ticker.C:
-			// 检查工作流状态
-			response, err := githubClient.GetWorkflowStatus(request.ID)
+			// 检查运行状态
+			response, err := backend.Status(ctx, request)
 			if err != nil {
-				logger.Error("获取工作流状态失败", zap.Error(err))
-				currentStatus = "查询失败"
-				currentConclusion = "未知"
+				logger.Error("获取运行状态失败", zap.String("request_id", request.ID), zap.Error(err))
+				onUpdate("查询失败, 结论: 未知")
 				continue
 			}
 
-			// 更新状态信息
-			currentStatus = response.Status
-			currentConclusion = response.Conclusion
-
-			// 检查工作流是否完成
-			if response.Status == "completed" {
-				// 清除当前行并显示最终结果
-				fmt.Printf("\r")
-				if response.Conclusion == "success" {
-					fmt.Println("✅ 镜像转存成功!")
-					fmt.Printf("工作流详情: %s\n", response.URL)
-					return
-				} else {
-					fmt.Printf("❌ 镜像转存失败: %s\n", response.Conclusion)
-					fmt.Printf("工作流详情: %s\n", response.URL)
-					os.Exit(1)
-				}
+			// 运行记录尚未出现，继续等待
+			if response.Status == types.WorkflowStatusNotVisible {
+				onUpdate("等待运行记录出现")
+				continue
 			}
 
-		case <-sigChan:
-			fmt.Printf("\r")
-			fmt.Println("收到中断信号，停止轮询")
-			os.Exit(1)
+			// 检查运行是否完成
+			if response.Status == types.WorkflowStatusCompleted {
+				return response, nil
+			}
+			onUpdate(fmt.Sprintf("%s, 结论: %s", response.Status, response.Conclusion))
+
+		case <-ctx.Done():
+			cancelRun(backend, logger, request)
+			return nil, errors.New("收到中断信号，停止轮询")
 
 		case <-timeout:
-			fmt.Printf("\r")
-			fmt.Println("⏰ 等待工作流完成超时")
-			os.Exit(1)
+			cancelRun(backend, logger, request)
+			return nil, errors.New("⏰ 等待运行完成超时")
 		}
 	}
 }
 
-// shipImagesFromFile 从YAML文件中解析镜像并转存
-func shipImagesFromFile(filePath string, githubClient *github.Client, logger *zap.Logger) {
-	fmt.Printf("正在解析文件: %s\n", filePath)
-	
-	// 解析YAML文件
-	images, err := yamlparser.ParseFile(filePath)
-	if err != nil {
-		fmt.Printf("解析文件失败: %v\n", err)
-		os.Exit(1)
+// cancelRun 取消不再等待的运行，避免其继续占用运行器，失败时只记录日志
+func cancelRun(backend shipper.Shipper, logger *zap.Logger, request *types.MirrorRequest) {
+	if err := backend.Cancel(context.Background(), request); err != nil {
+		logger.Warn("取消运行失败", zap.String("request_id", request.ID), zap.Error(err))
 	}
-	
-	if len(images) == 0 {
-		fmt.Println("在文件中未找到任何镜像")
-		os.Exit(0)
-	}
-	
-	fmt.Printf("从文件中找到 %d 个镜像\n", len(images))
-	for i, image := range images {
-		fmt.Printf("%d. %s\n", i+1, image)
-	}
-	
-	// 设置信号处理
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	
-	// 逐个处理镜像
-	for i, image := range images {
-		fmt.Printf("\n正在处理镜像 %d/%d: %s\n", i+1, len(images), image)
-		shipSingleImage(image, githubClient, logger, sigChan)
-	}
-	
-	fmt.Println("\n✅ 所有镜像处理完成!")
 }
 
 // initLogger 初始化日志记录器
@@ -279,16 +564,46 @@ func printUsage() {
 	fmt.Println("  ./app ship -f <docker-compose.yaml或k8s yaml文件路径> --dry-run  # 仅解析文件并显示镜像，不执行实际推送")
 	fmt.Println("")
 	fmt.Println("选项:")
-	fmt.Println("  -f <文件路径>   指定Docker Compose或Kubernetes YAML文件路径")
+	fmt.Println("  -f <文件路径>   指定Docker Compose、Kubernetes YAML文件、Dockerfile、Helm Chart或kustomization目录，可重复指定")
+	fmt.Println("                  也可以是目录或通配符（如 'deploy/**/*.yaml'），递归扫描并遵循.gitignore")
+	fmt.Println("                  - 表示从标准输入读取，http(s) URL 会先下载，两者都按内容判断类型")
 	fmt.Println("  --dry-run       仅解析文件并显示镜像，不执行实际推送操作")
+	fmt.Println("  --parallel <N>  批量转存时同时运行的工作流数量上限（默认4）")
+	fmt.Println("  --single-run    在单个工作流运行中转存文件中的全部镜像")
+	fmt.Println("  --backend <名称> 执行转存的后端：github、gitlab、gitea、local（默认github，也可用配置项ship.backend设置）")
+	fmt.Println("  --local         在本机直接从源仓库复制到目标仓库，等同于 --backend local，需要指定目标仓库")
+	fmt.Println("  --results <文件> 将每个镜像的转存结果以JSON Lines格式追加到文件")
+	fmt.Println("  --target <名称> 目标仓库，对应配置文件targets中的配置")
+	fmt.Println("  --values <文件> 渲染Helm Chart时使用的values文件，多个文件用逗号分隔")
+	fmt.Println("  --profile <名称> 解析Compose文件时启用的profile，可重复指定")
+	fmt.Println("  --include <模式> 扫描目录时包含的文件，可重复指定（默认 YAML 文件和 Dockerfile）")
+	fmt.Println("  --exclude <模式> 扫描目录时排除的文件或目录，可重复指定")
+	fmt.Println("  --type <类型>   强制使用的解析器：compose、k8s、helm、kustomize、dockerfile（默认按内容判断）")
+	fmt.Println("  --platform <平台> 只复制指定的平台，如 linux/arm64，可重复指定（默认复制全部平台）")
+	fmt.Println("                   旧版写在镜像地址中的 \"--platform=<平台> <镜像>\" 会按此参数处理，目标地址不再带平台前缀")
+	fmt.Println("  --config <路径> 指定配置文件，不再搜索默认路径")
 	fmt.Println("")
 	fmt.Println("示例:")
 	fmt.Println("  ./app ship nginx:latest                     # 转存单个镜像")
 	fmt.Println("  ./app ship docker.io/library/nginx:latest   # 转存单个镜像（完整路径）")
 	fmt.Println("  ./app ship -f docker-compose.yaml           # 从docker-compose文件中转存所有镜像")
 	fmt.Println("  ./app ship -f deployment.yaml              # 从Kubernetes deployment文件中转存所有镜像")
+	fmt.Println("  ./app ship -f ./charts/myapp --values prod.yaml  # 渲染Helm Chart并转存其中的镜像")
+	fmt.Println("  ./app ship -f myapp-1.0.0.tgz              # 从打包的Helm Chart中转存所有镜像")
+	fmt.Println("  ./app ship -f Dockerfile                   # 转存构建所需的基础镜像")
+	fmt.Println("  ./app ship -f overlays/prod                # 构建kustomization并转存最终的镜像")
+	fmt.Println("  ./app ship -f compose.yaml -f compose.prod.yaml --profile debug  # 合并多个Compose文件")
+	fmt.Println("  ./app ship -f ./deploy --exclude 'test/**'  # 扫描目录中的所有清单")
+	fmt.Println("  helm template myapp ./chart | ./app ship -f -  # 从标准输入读取清单")
+	fmt.Println("  ./app ship -f docker-compose.yaml --parallel 8  # 同时运行8个工作流")
+	fmt.Println("  ./app ship -f docker-compose.yaml --single-run  # 所有镜像共用一个工作流运行")
+	fmt.Println("  ./app ship --target harbor nginx:latest      # 转存到配置中名为harbor的目标仓库")
+	fmt.Println("  ./app ship --platform linux/amd64 --platform linux/arm64 nginx:latest  # 只复制两个平台")
+	fmt.Println("  ./app ship --local --target harbor nginx:latest  # 在本机直接复制到harbor，不使用GitHub Actions")
+	fmt.Println("  ./app ship --backend gitlab nginx:latest      # 通过GitLab CI流水线转存")
 	fmt.Println("  ./app ship -f docker-compose.yaml --dry-run  # 仅解析docker-compose文件中的镜像")
 	fmt.Println("")
 	fmt.Println("环境变量:")
 	fmt.Println("  GITHUB_TOKEN  GitHub访问令牌 (可选，也可在配置文件中设置)")
+	fmt.Println("  <前缀>_USER, <前缀>_PASSWORD  本地转存时目标仓库的登录凭据，前缀与工作流Secrets相同，未设置时读取 ~/.docker/config.json")
 }
@@ -2,88 +2,317 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/keevingness/image-shipper/pkg/yamlparser"
 )
 
 // Config 应用程序配置结构
 type Config struct {
-	GitHub GitHubConfig `mapstructure:"github"`
-	Pull   PullConfig   `mapstructure:"pull"`
+	GitHub GitHubConfig `yaml:"github"`
+	GitLab GitLabConfig `yaml:"gitlab"`
+	Gitea  GiteaConfig  `yaml:"gitea"`
+	Pull   PullConfig   `yaml:"pull"`
+	Ship   ShipConfig   `yaml:"ship"`
+	Parse  ParseConfig  `yaml:"parse"`
+	// Targets 命名的目标仓库配置，ship --target 按名称选择
+	Targets map[string]TargetProfile `yaml:"targets"`
+
+	// origins 记录每个配置项的来源，键为配置项路径，如 "github.token"
+	origins map[string]Origin
 }
 
 // GitHubConfig GitHub相关配置
 type GitHubConfig struct {
-	Token    string `mapstructure:"token"`
-	Owner    string `mapstructure:"owner"`
-	Repo     string `mapstructure:"repo"`
-	Workflow string `mapstructure:"workflow"`
+	Token    string `yaml:"token" secret:"true"`
+	Owner    string `yaml:"owner"`
+	Repo     string `yaml:"repo"`
+	Workflow string `yaml:"workflow"`
+	// Ref 触发工作流使用的分支
+	Ref string `yaml:"ref"`
+	// APIURL GitHub Enterprise Server的地址，如 https://github.example.com，留空时使用github.com
+	APIURL string `yaml:"api_url"`
+	// UploadURL GitHub Enterprise Server的上传地址，留空时与APIURL相同
+	UploadURL string `yaml:"upload_url"`
+	// CACert 校验服务器证书时额外信任的CA证书文件（PEM格式），用于自签名证书的GitHub Enterprise Server
+	CACert string `yaml:"ca_cert"`
+	// Proxy 访问GitHub使用的HTTP(S)代理地址，留空时读取HTTPS_PROXY等环境变量
+	Proxy string `yaml:"proxy"`
+	// AppID GitHub App的ID，与AppPrivateKey同时设置时以GitHub App身份认证，不再需要Token
+	AppID int64 `yaml:"app_id"`
+	// AppPrivateKey GitHub App私钥，可以是PEM文件路径，也可以直接是PEM内容
+	AppPrivateKey string `yaml:"app_private_key" secret:"true"`
+	// AppInstallationID 应用在仓库所有者下的安装ID，留空时按仓库查找
+	AppInstallationID int64 `yaml:"app_installation_id"`
+}
+
+// GitLabConfig GitLab CI后端配置
+type GitLabConfig struct {
+	// URL GitLab实例地址
+	URL   string `yaml:"url"`
+	Token string `yaml:"token" secret:"true"`
+	// Project 运行流水线的项目路径（如 group/image-shipper）或数字ID
+	Project string `yaml:"project"`
+	// Ref 触发流水线使用的分支
+	Ref string `yaml:"ref"`
+	// CACert 校验服务器证书时额外信任的CA证书文件（PEM格式），用于自签名证书的自建实例
+	CACert string `yaml:"ca_cert"`
+	// Proxy 访问GitLab使用的HTTP(S)代理地址，留空时读取HTTPS_PROXY等环境变量
+	Proxy string `yaml:"proxy"`
+}
+
+// GiteaConfig Gitea/Forgejo Actions后端配置
+type GiteaConfig struct {
+	// URL Gitea或Forgejo实例地址
+	URL      string `yaml:"url"`
+	Token    string `yaml:"token" secret:"true"`
+	Owner    string `yaml:"owner"`
+	Repo     string `yaml:"repo"`
+	Workflow string `yaml:"workflow"`
+	// Ref 触发工作流使用的分支
+	Ref string `yaml:"ref"`
+	// CACert 校验服务器证书时额外信任的CA证书文件（PEM格式），用于自签名证书的自建实例
+	CACert string `yaml:"ca_cert"`
+	// Proxy 访问Gitea使用的HTTP(S)代理地址，留空时读取HTTPS_PROXY等环境变量
+	Proxy string `yaml:"proxy"`
 }
 
+// 拉取镜像的方式
+const (
+	// PullModeNative 使用内置的仓库客户端下载镜像，失败时回退到容器运行时命令
+	PullModeNative = "native"
+	// PullModeCLI 只使用容器运行时的 pull/tag 命令
+	PullModeCLI = "cli"
+)
+
 // PullConfig Pull命令配置
 type PullConfig struct {
-	SourceRegistry   string `mapstructure:"source_registry"`
-	ContainerRuntime string `mapstructure:"container_runtime"`
+	// SourceRegistry 没有改写规则匹配时使用的镜像仓库前缀，为空时直接从原仓库拉取
+	SourceRegistry   string `yaml:"source_registry"`
+	ContainerRuntime string `yaml:"container_runtime"`
+	Mode             string `yaml:"mode"`
+	// Rewrites 按顺序匹配的源仓库改写规则，第一条匹配的规则生效
+	Rewrites []RewriteRule `yaml:"rewrites"`
+}
+
+// 转存后端
+const (
+	// ShipBackendGitHub 触发GitHub Actions工作流
+	ShipBackendGitHub = "github"
+	// ShipBackendGitLab 触发GitLab CI流水线
+	ShipBackendGitLab = "gitlab"
+	// ShipBackendGitea 触发Gitea或Forgejo Actions工作流
+	ShipBackendGitea = "gitea"
+	// ShipBackendLocal 在本机直接从源仓库复制到目标仓库
+	ShipBackendLocal = "local"
+)
+
+// ShipBackends 支持的转存后端
+var ShipBackends = []string{ShipBackendGitHub, ShipBackendGitLab, ShipBackendGitea, ShipBackendLocal}
+
+// ShipConfig Ship命令配置
+type ShipConfig struct {
+	// Backend 执行转存的后端，见ShipBackends
+	Backend string `yaml:"backend"`
+	// Parallelism 批量转存时同时运行的工作流数量上限
+	Parallelism int `yaml:"parallelism"`
+	// SingleRun 在单个工作流运行中转存全部镜像，而不是每个镜像各触发一次
+	SingleRun bool `yaml:"single_run"`
+	// Target 默认使用的目标仓库名称，对应targets中的配置
+	Target string `yaml:"target"`
+}
+
+// ParseConfig 从文件中提取镜像的配置
+type ParseConfig struct {
+	// ImagePaths 在Kubernetes资源中额外查找镜像的JSONPath，用于内置规则未覆盖的CRD
+	ImagePaths []yamlparser.ImagePath `yaml:"image_paths"`
+}
+
+// Options 配置加载选项
+type Options struct {
+	// ConfigFile 显式指定的配置文件，设置后不再搜索默认路径
+	ConfigFile string
+	// Flags 命令行参数覆盖项，键为配置项路径，如 "pull.container_runtime"
+	Flags map[string]string
+	// SkipValidation 跳过必填项校验，用于仅查看配置的场景
+	SkipValidation bool
+}
+
+// DefaultSearchPaths 返回配置文件搜索路径，优先级从高到低
+func DefaultSearchPaths() []string {
+	paths := []string{"config.yaml"}
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, filepath.Join(home, ".image-shipper", "config.yaml"))
+	}
+	return append(paths, "/etc/image-shipper/config.yaml")
 }
 
-// LoadWithDefaults 从环境变量加载配置
+// LoadWithDefaults 按默认搜索路径加载配置
 func LoadWithDefaults() (*Config, error) {
-	config := &Config{}
+	return Load(Options{})
+}
 
-	// 直接从环境变量读取GitHub Token
-	if token := os.Getenv("IMGSHIPPER_GITHUB_TOKEN"); token != "" {
-		config.GitHub.Token = token
+// Load 加载配置
+// 优先级从高到低为：命令行参数 > 环境变量 > 配置文件 > 默认值。
+// 多个配置文件同时存在时逐个合并，搜索路径中靠前的文件优先。
+func Load(opts Options) (*Config, error) {
+	config := &Config{origins: map[string]Origin{}}
+	config.applyDefaults()
+
+	if opts.ConfigFile != "" {
+		if err := config.mergeFile(opts.ConfigFile); err != nil {
+			return nil, err
+		}
+	} else {
+		paths := DefaultSearchPaths()
+		// 从优先级最低的文件开始合并，高优先级文件覆盖低优先级文件
+		for i := len(paths) - 1; i >= 0; i-- {
+			if _, err := os.Stat(paths[i]); err != nil {
+				continue
+			}
+			if err := config.mergeFile(paths[i]); err != nil {
+				return nil, err
+			}
+		}
 	}
 
-	// 直接从环境变量读取其他GitHub配置
-	if owner := os.Getenv("IMGSHIPPER_GITHUB_OWNER"); owner != "" {
-		config.GitHub.Owner = owner
+	if err := config.mergeEnv(); err != nil {
+		return nil, err
 	}
 
-	if repo := os.Getenv("IMGSHIPPER_GITHUB_REPO"); repo != "" {
-		config.GitHub.Repo = repo
+	if err := config.mergeFlags(opts.Flags); err != nil {
+		return nil, err
 	}
 
-	if workflow := os.Getenv("IMGSHIPPER_GITHUB_WORKFLOW"); workflow != "" {
-		config.GitHub.Workflow = workflow
+	// 验证配置
+	if !opts.SkipValidation {
+		if err := config.Validate(); err != nil {
+			return nil, fmt.Errorf("配置验证失败: %w", err)
+		}
 	}
 
-	// 直接从环境变量读取Pull配置
-	if sourceRegistry := os.Getenv("IMGSHIPPER_PULL_SOURCE_REGISTRY"); sourceRegistry != "" {
-		config.Pull.SourceRegistry = sourceRegistry
+	return config, nil
+}
+
+// applyDefaults 设置默认值
+func (c *Config) applyDefaults() {
+	defaults := map[string]string{
+		"github.repo":            "image-shipper",
+		"github.workflow":        "image-shipper.yaml",
+		"github.ref":             "main",
+		"gitlab.url":             "https://gitlab.com",
+		"gitlab.ref":             "main",
+		"gitea.repo":             "image-shipper",
+		"gitea.workflow":         "image-shipper.yaml",
+		"gitea.ref":              "main",
+		"pull.container_runtime": "docker",
+		"pull.mode":              PullModeNative,
+		"ship.backend":           ShipBackendGitHub,
+		"ship.parallelism":       "4",
+	}
+	for key, value := range defaults {
+		field, _ := c.field(key)
+		_ = setScalar(field, value)
+		c.origins[key] = Origin{Source: SourceDefault}
 	}
+}
 
-	if containerRuntime := os.Getenv("IMGSHIPPER_PULL_CONTAINER_RUNTIME"); containerRuntime != "" {
-		config.Pull.ContainerRuntime = containerRuntime
+// Origin 返回指定配置项的来源
+// 映射和列表类配置项整体来自同一来源，其子项返回父配置项的来源。
+func (c *Config) Origin(key string) Origin {
+	for {
+		if origin, ok := c.origins[key]; ok {
+			return origin
+		}
+		i := strings.LastIndexAny(key, ".[")
+		if i < 0 {
+			return Origin{Source: SourceDefault}
+		}
+		key = key[:i]
 	}
+}
 
-	// 设置默认值（只有在环境变量未设置时才应用）
-	if config.GitHub.Repo == "" {
-		config.GitHub.Repo = "image-shipper"
+// Entries 按声明顺序列出所有配置项及其来源，敏感值会被遮盖
+func (c *Config) Entries() []Entry {
+	var entries []Entry
+	var visit func(key string, value reflect.Value, field reflect.StructField)
+	visit = func(key string, value reflect.Value, field reflect.StructField) {
+		// 结构体映射逐个展开，如 targets.harbor.registry
+		if value.Kind() == reflect.Map && value.Type().Elem().Kind() == reflect.Struct {
+			keys := value.MapKeys()
+			sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+			for _, k := range keys {
+				elem := reflect.New(value.Type().Elem()).Elem()
+				elem.Set(value.MapIndex(k))
+				walkLeaves(elem, joinKey(key, k.String()), visit)
+			}
+			return
+		}
+		// 结构体列表按下标展开，如 pull.rewrites[0].match
+		if value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.Struct {
+			for i := 0; i < value.Len(); i++ {
+				walkLeaves(value.Index(i), fmt.Sprintf("%s[%d]", key, i), visit)
+			}
+			return
+		}
+		display := fmt.Sprint(value.Interface())
+		if field.Tag.Get("secret") == "true" && display != "" {
+			display = maskSecret(display)
+		}
+		entries = append(entries, Entry{Key: key, Value: display, Origin: c.Origin(key)})
 	}
-	if config.GitHub.Workflow == "" {
-		config.GitHub.Workflow = "image-shipper.yaml"
+	walkLeaves(reflect.ValueOf(c).Elem(), "", visit)
+	return entries
+}
+
+// Validate 验证配置
+// 只校验所选转存后端需要的配置，本地转存不需要GitHub、GitLab或Gitea配置。
+func (c *Config) Validate() error {
+	if !slices.Contains(ShipBackends, c.Ship.Backend) {
+		return fmt.Errorf("ship backend must be one of %s", strings.Join(ShipBackends, ", "))
 	}
-	if config.Pull.SourceRegistry == "" {
-		config.Pull.SourceRegistry = "docker.io/library"
+
+	// 在测试环境中，跳过后端配置验证
+	if os.Getenv("TEST_ENV") != "true" {
+		if err := c.validateBackend(); err != nil {
+			return err
+		}
 	}
-	if config.Pull.ContainerRuntime == "" {
-		config.Pull.ContainerRuntime = "docker"
+
+	if c.Pull.Mode != PullModeNative && c.Pull.Mode != PullModeCLI {
+		return fmt.Errorf("pull mode must be %q or %q", PullModeNative, PullModeCLI)
 	}
 
-	// 验证配置
-	if err := config.Validate(); err != nil {
-		return nil, fmt.Errorf("配置验证失败: %w", err)
+	if err := c.validateRewrites(); err != nil {
+		return err
 	}
 
-	return config, nil
+	if c.Ship.Parallelism < 1 {
+		return fmt.Errorf("ship parallelism must be at least 1")
+	}
+	return c.validateTargets()
 }
 
-// Validate 验证配置
-func (c *Config) Validate() error {
-	// 在测试环境中，跳过GitHub配置验证
-	if os.Getenv("TEST_ENV") != "true" {
-		if c.GitHub.Token == "" {
-			return fmt.Errorf("github token is required")
+// validateBackend 校验转存后端的必填项
+func (c *Config) validateBackend() error {
+	switch c.Ship.Backend {
+	case ShipBackendGitHub:
+		if c.GitHub.AppID != 0 && c.GitHub.AppPrivateKey == "" {
+			return fmt.Errorf("github app_private_key is required when app_id is set")
+		}
+
+		if c.GitHub.AppID == 0 && c.GitHub.AppPrivateKey != "" {
+			return fmt.Errorf("github app_id is required when app_private_key is set")
+		}
+
+		if c.GitHub.Token == "" && c.GitHub.AppID == 0 {
+			return fmt.Errorf("github token or app_id is required")
 		}
 
 		if c.GitHub.Owner == "" {
@@ -97,6 +326,109 @@ func (c *Config) Validate() error {
 		if c.GitHub.Workflow == "" {
 			return fmt.Errorf("github workflow is required")
 		}
+
+		if c.GitHub.Ref == "" {
+			return fmt.Errorf("github ref is required")
+		}
+
+		for _, option := range []struct{ key, value string }{
+			{"api_url", c.GitHub.APIURL},
+			{"upload_url", c.GitHub.UploadURL},
+			{"proxy", c.GitHub.Proxy},
+		} {
+			if err := validateURL(option.value); err != nil {
+				return fmt.Errorf("github %s: %w", option.key, err)
+			}
+		}
+
+	case ShipBackendGitLab:
+		if c.GitLab.URL == "" {
+			return fmt.Errorf("gitlab url is required")
+		}
+
+		if c.GitLab.Token == "" {
+			return fmt.Errorf("gitlab token is required")
+		}
+
+		if c.GitLab.Project == "" {
+			return fmt.Errorf("gitlab project is required")
+		}
+
+		if c.GitLab.Ref == "" {
+			return fmt.Errorf("gitlab ref is required")
+		}
+
+		for _, option := range []struct{ key, value string }{
+			{"url", c.GitLab.URL},
+			{"proxy", c.GitLab.Proxy},
+		} {
+			if err := validateURL(option.value); err != nil {
+				return fmt.Errorf("gitlab %s: %w", option.key, err)
+			}
+		}
+
+	case ShipBackendGitea:
+		if c.Gitea.URL == "" {
+			return fmt.Errorf("gitea url is required")
+		}
+
+		if c.Gitea.Token == "" {
+			return fmt.Errorf("gitea token is required")
+		}
+
+		if c.Gitea.Owner == "" {
+			return fmt.Errorf("gitea owner is required")
+		}
+
+		if c.Gitea.Repo == "" {
+			return fmt.Errorf("gitea repo is required")
+		}
+
+		if c.Gitea.Workflow == "" {
+			return fmt.Errorf("gitea workflow is required")
+		}
+
+		if c.Gitea.Ref == "" {
+			return fmt.Errorf("gitea ref is required")
+		}
+
+		for _, option := range []struct{ key, value string }{
+			{"url", c.Gitea.URL},
+			{"proxy", c.Gitea.Proxy},
+		} {
+			if err := validateURL(option.value); err != nil {
+				return fmt.Errorf("gitea %s: %w", option.key, err)
+			}
+		}
+
+	case ShipBackendLocal:
+		// 本地转存直接推送到目标仓库，没有工作流默认的阿里云配置可以使用
+		if c.Ship.Target == "" {
+			return fmt.Errorf("ship backend local requires a ship target")
+		}
 	}
 	return nil
-}
\ No newline at end of file
+}
+
+// validateURL 校验可选的http(s)地址
+func validateURL(value string) error {
+	if value == "" {
+		return nil
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q is not an http(s) URL", value)
+	}
+	return nil
+}
+
+// maskSecret 遮盖敏感值，仅保留末尾四位
+func maskSecret(value string) string {
+	if len(value) <= 4 {
+		return "****"
+	}
+	return "****" + value[len(value)-4:]
+}
@@ -0,0 +1,318 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// envPrefix 环境变量前缀
+const envPrefix = "IMGSHIPPER_"
+
+// Source 配置项来源类型
+type Source string
+
+const (
+	// SourceDefault 内置默认值
+	SourceDefault Source = "default"
+	// SourceFile 配置文件
+	SourceFile Source = "file"
+	// SourceEnv 环境变量
+	SourceEnv Source = "env"
+	// SourceFlag 命令行参数
+	SourceFlag Source = "flag"
+)
+
+// Origin 配置项来源
+type Origin struct {
+	Source Source
+	// Detail 来源详情：文件路径、环境变量名或命令行参数对应的配置项
+	Detail string
+}
+
+// String 返回来源的可读描述
+func (o Origin) String() string {
+	if o.Detail == "" {
+		return string(o.Source)
+	}
+	return fmt.Sprintf("%s (%s)", o.Source, o.Detail)
+}
+
+// Entry 配置项及其取值和来源
+type Entry struct {
+	Key    string
+	Value  string
+	Origin Origin
+}
+
+// EnvName 返回配置项对应的环境变量名，如 github.token -> IMGSHIPPER_GITHUB_TOKEN
+func EnvName(key string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// mergeFile 将配置文件内容合并到当前配置，仅覆盖文件中出现的配置项
+func (c *Config) mergeFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("无法读取配置文件 %s: %w", path, err)
+	}
+
+	var raw map[interface{}]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("解析配置文件 %s 失败: %w", path, err)
+	}
+	if len(raw) == 0 {
+		return nil
+	}
+
+	// 先检查未知配置项，给出完整的配置项路径，比yaml库的错误信息更直观
+	if err := checkUnknownKeys(reflect.TypeOf(*c), raw, ""); err != nil {
+		return fmt.Errorf("配置文件 %s: %w", path, err)
+	}
+
+	var fileConfig Config
+	if err := yaml.UnmarshalStrict(data, &fileConfig); err != nil {
+		return fmt.Errorf("解析配置文件 %s 失败: %w", path, err)
+	}
+
+	mergeStruct(reflect.ValueOf(c).Elem(), reflect.ValueOf(&fileConfig).Elem(), raw, "", Origin{Source: SourceFile, Detail: path}, c.origins)
+	return nil
+}
+
+// mergeEnv 从IMGSHIPPER_*环境变量合并标量配置项
+func (c *Config) mergeEnv() error {
+	var err error
+	walkLeaves(reflect.ValueOf(c).Elem(), "", func(key string, value reflect.Value, _ reflect.StructField) {
+		if err != nil {
+			return
+		}
+		name := EnvName(key)
+		env, ok := os.LookupEnv(name)
+		if !ok || env == "" || !isScalar(value.Kind()) {
+			return
+		}
+		if setErr := setScalar(value, env); setErr != nil {
+			err = fmt.Errorf("环境变量 %s: %w", name, setErr)
+			return
+		}
+		c.origins[key] = Origin{Source: SourceEnv, Detail: name}
+	})
+	return err
+}
+
+// mergeFlags 合并命令行参数覆盖项
+func (c *Config) mergeFlags(flags map[string]string) error {
+	// 按键排序，保证出错时的报错信息稳定
+	keys := make([]string, 0, len(flags))
+	for key := range flags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		field, ok := c.field(key)
+		if !ok || !isScalar(field.Kind()) {
+			return fmt.Errorf("未知配置项 %q", key)
+		}
+		if err := setScalar(field, flags[key]); err != nil {
+			return fmt.Errorf("命令行参数 %s: %w", key, err)
+		}
+		c.origins[key] = Origin{Source: SourceFlag, Detail: key}
+	}
+	return nil
+}
+
+// field 根据配置项路径查找字段
+func (c *Config) field(key string) (reflect.Value, bool) {
+	value := reflect.ValueOf(c).Elem()
+	for _, part := range strings.Split(key, ".") {
+		if value.Kind() != reflect.Struct {
+			return reflect.Value{}, false
+		}
+		found := false
+		for i := 0; i < value.NumField(); i++ {
+			if name, ok := yamlName(value.Type().Field(i)); ok && name == part {
+				value = value.Field(i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return reflect.Value{}, false
+		}
+	}
+	return value, true
+}
+
+// walkLeaves 按声明顺序遍历结构体中所有非结构体字段
+func walkLeaves(value reflect.Value, prefix string, fn func(key string, value reflect.Value, field reflect.StructField)) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		name, ok := yamlName(field)
+		if !ok {
+			continue
+		}
+		key := joinKey(prefix, name)
+		if field.Type.Kind() == reflect.Struct {
+			walkLeaves(value.Field(i), key, fn)
+			continue
+		}
+		fn(key, value.Field(i), field)
+	}
+}
+
+// mergeStruct 将src中在raw里出现过的字段复制到dst，并记录来源
+func mergeStruct(dst, src reflect.Value, raw map[interface{}]interface{}, prefix string, origin Origin, origins map[string]Origin) {
+	for i := 0; i < dst.NumField(); i++ {
+		field := dst.Type().Field(i)
+		name, ok := yamlName(field)
+		if !ok {
+			continue
+		}
+		rawValue, present := raw[name]
+		if !present {
+			continue
+		}
+		key := joinKey(prefix, name)
+		if field.Type.Kind() == reflect.Struct {
+			if nested, ok := rawValue.(map[interface{}]interface{}); ok {
+				mergeStruct(dst.Field(i), src.Field(i), nested, key, origin, origins)
+			}
+			continue
+		}
+		dst.Field(i).Set(src.Field(i))
+		origins[key] = origin
+	}
+}
+
+// checkUnknownKeys 检查原始YAML中是否存在结构体未声明的配置项
+func checkUnknownKeys(typ reflect.Type, raw interface{}, prefix string) error {
+	switch typ.Kind() {
+	case reflect.Ptr:
+		return checkUnknownKeys(typ.Elem(), raw, prefix)
+	case reflect.Struct:
+		m, ok := raw.(map[interface{}]interface{})
+		if !ok {
+			return nil
+		}
+		known := map[string]reflect.Type{}
+		for i := 0; i < typ.NumField(); i++ {
+			if name, ok := yamlName(typ.Field(i)); ok {
+				known[name] = typ.Field(i).Type
+			}
+		}
+		keys, err := sortedKeys(m, prefix)
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			fieldType, ok := known[k]
+			if !ok {
+				return fmt.Errorf("未知配置项 %q", joinKey(prefix, k))
+			}
+			if err := checkUnknownKeys(fieldType, m[k], joinKey(prefix, k)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		m, ok := raw.(map[interface{}]interface{})
+		if !ok {
+			return nil
+		}
+		keys, err := sortedKeys(m, prefix)
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := checkUnknownKeys(typ.Elem(), m[k], joinKey(prefix, k)); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		items, ok := raw.([]interface{})
+		if !ok {
+			return nil
+		}
+		for i, item := range items {
+			if err := checkUnknownKeys(typ.Elem(), item, fmt.Sprintf("%s[%d]", prefix, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// yamlName 返回字段对应的YAML键名，未导出或忽略的字段返回false
+func yamlName(field reflect.StructField) (string, bool) {
+	if field.PkgPath != "" {
+		return "", false
+	}
+	name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+	if name == "-" {
+		return "", false
+	}
+	if name == "" {
+		name = strings.ToLower(field.Name)
+	}
+	return name, true
+}
+
+// isScalar 判断字段是否可以用单个字符串赋值
+func isScalar(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int64:
+		return true
+	}
+	return false
+}
+
+// setScalar 将字符串解析后写入标量字段
+func setScalar(value reflect.Value, s string) error {
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("无效的布尔值 %q", s)
+		}
+		value.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("无效的整数 %q", s)
+		}
+		value.SetInt(n)
+	default:
+		return fmt.Errorf("不支持的配置项类型 %s", value.Kind())
+	}
+	return nil
+}
+
+// sortedKeys 返回map中的键，按字典序排列
+// 键必须是字符串：未加引号的 yes、on、123 等会被YAML解析为布尔值或数字，视为错误而不是按字符串比较。
+func sortedKeys(m map[interface{}]interface{}, prefix string) ([]string, error) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		key, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("配置项 %q 不是字符串，请加上引号", joinKey(prefix, fmt.Sprint(k)))
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// joinKey 拼接配置项路径
+func joinKey(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
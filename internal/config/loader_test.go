@@ -0,0 +1,248 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeConfig 在dir下写入配置文件，返回文件路径
+func writeConfig(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// isolate 将工作目录和HOME指向空的临时目录，默认搜索路径中只有测试写入的文件
+func isolate(t *testing.T) (cwd, home string) {
+	t.Helper()
+	if _, err := os.Stat("/etc/image-shipper/config.yaml"); err == nil {
+		t.Skip("/etc/image-shipper/config.yaml exists")
+	}
+	cwd, home = t.TempDir(), t.TempDir()
+	t.Chdir(cwd)
+	t.Setenv("HOME", home)
+	return cwd, home
+}
+
+// wantOrigins 检查配置项的来源描述
+func wantOrigins(t *testing.T, cfg *Config, origins map[string]string) {
+	t.Helper()
+	for key, want := range origins {
+		if got := cfg.Origin(key).String(); got != want {
+			t.Errorf("Origin(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestLoadSearchPaths(t *testing.T) {
+	_, home := isolate(t)
+	homeConfig := writeConfig(t, home, ".image-shipper/config.yaml", `
+github:
+  owner: home-owner
+  repo: home-repo
+pull:
+  mode: cli
+`)
+	writeConfig(t, ".", "config.yaml", `
+github:
+  owner: cwd-owner
+`)
+
+	cfg, err := Load(Options{SkipValidation: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 当前目录的文件优先，未覆盖的配置项保留家目录文件中的值
+	if cfg.GitHub.Owner != "cwd-owner" || cfg.GitHub.Repo != "home-repo" || cfg.Pull.Mode != PullModeCLI || cfg.GitHub.Workflow != "image-shipper.yaml" {
+		t.Errorf("loaded github %+v, pull mode %q", cfg.GitHub, cfg.Pull.Mode)
+	}
+	wantOrigins(t, cfg, map[string]string{
+		"github.owner":    "file (config.yaml)",
+		"github.repo":     "file (" + homeConfig + ")",
+		"pull.mode":       "file (" + homeConfig + ")",
+		"github.workflow": "default",
+		"github.token":    "default",
+	})
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	cwd, _ := isolate(t)
+	writeConfig(t, cwd, "config.yaml", "github:\n  owner: searched\n")
+	explicit := writeConfig(t, t.TempDir(), "custom.yaml", "github:\n  repo: custom-repo\n")
+
+	// 显式指定的配置文件不与搜索路径中的文件合并
+	cfg, err := Load(Options{ConfigFile: explicit, SkipValidation: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.GitHub.Owner != "" || cfg.GitHub.Repo != "custom-repo" {
+		t.Errorf("loaded github %+v, want only %s", cfg.GitHub, explicit)
+	}
+	wantOrigins(t, cfg, map[string]string{"github.repo": "file (" + explicit + ")"})
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	isolate(t)
+	file := writeConfig(t, t.TempDir(), "config.yaml", `
+github:
+  owner: file-owner
+  token: ghp_filetoken1234
+pull:
+  container_runtime: podman
+ship:
+  parallelism: 2
+  single_run: true
+targets:
+  harbor:
+    type: harbor
+    registry: harbor.example.com
+    namespace: mirror
+`)
+	t.Setenv("IMGSHIPPER_GITHUB_OWNER", "env-owner")
+	t.Setenv("IMGSHIPPER_SHIP_PARALLELISM", "8")
+	t.Setenv("IMGSHIPPER_PULL_CONTAINER_RUNTIME", "nerdctl")
+	// 空的环境变量不覆盖配置文件
+	t.Setenv("IMGSHIPPER_SHIP_SINGLE_RUN", "")
+
+	cfg, err := Load(Options{
+		ConfigFile:     file,
+		Flags:          map[string]string{"github.owner": "flag-owner", "pull.container_runtime": "docker"},
+		SkipValidation: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.GitHub.Owner != "flag-owner" || cfg.Pull.ContainerRuntime != "docker" || cfg.Ship.Parallelism != 8 || !cfg.Ship.SingleRun {
+		t.Errorf("loaded github owner %q, runtime %q, ship %+v", cfg.GitHub.Owner, cfg.Pull.ContainerRuntime, cfg.Ship)
+	}
+	wantOrigins(t, cfg, map[string]string{
+		"github.owner":            "flag (github.owner)",
+		"pull.container_runtime":  "flag (pull.container_runtime)",
+		"ship.parallelism":        "env (IMGSHIPPER_SHIP_PARALLELISM)",
+		"ship.single_run":         "file (" + file + ")",
+		"github.token":            "file (" + file + ")",
+		"targets.harbor.registry": "file (" + file + ")",
+		"ship.backend":            "default",
+	})
+
+	entries := map[string]Entry{}
+	for _, entry := range cfg.Entries() {
+		entries[entry.Key] = entry
+	}
+	if entry := entries["github.token"]; entry.Value != "****1234" {
+		t.Errorf("github.token displayed as %q, want masked", entry.Value)
+	}
+	if entry := entries["targets.harbor.namespace"]; entry.Value != "mirror" || entry.Origin.Source != SourceFile {
+		t.Errorf("targets.harbor.namespace = %+v", entry)
+	}
+	if entry := entries["ship.parallelism"]; entry.Value != "8" || entry.Origin.Source != SourceEnv {
+		t.Errorf("ship.parallelism = %+v", entry)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		env    map[string]string
+		flags  map[string]string
+		want   string
+	}{
+		{
+			name:   "unknown section",
+			config: "githb:\n  owner: me\n",
+			want:   `未知配置项 "githb"`,
+		},
+		{
+			name:   "unknown nested key",
+			config: "github:\n  ownr: me\n",
+			want:   `未知配置项 "github.ownr"`,
+		},
+		{
+			name:   "unknown key in target",
+			config: "targets:\n  harbor:\n    type: harbor\n    regsitry: harbor.example.com\n",
+			want:   `未知配置项 "targets.harbor.regsitry"`,
+		},
+		{
+			name:   "unknown key in rewrite rule",
+			config: "pull:\n  rewrites:\n    - match: docker.io\n      mirorr: mirror.example.com\n",
+			want:   `未知配置项 "pull.rewrites[0].mirorr"`,
+		},
+		{
+			name:   "non-string top-level key",
+			config: "1: value\n",
+			want:   `配置项 "1" 不是字符串`,
+		},
+		{
+			// 未加引号的 yes 被解析为布尔值
+			name:   "non-string target name",
+			config: "targets:\n  yes:\n    type: harbor\n",
+			want:   `配置项 "targets.true" 不是字符串`,
+		},
+		{
+			name:   "non-string nested key",
+			config: "github:\n  123: value\n",
+			want:   `配置项 "github.123" 不是字符串`,
+		},
+		{
+			name:   "invalid yaml",
+			config: "github: [\n",
+			want:   "解析配置文件",
+		},
+		{
+			name: "invalid env integer",
+			env:  map[string]string{"IMGSHIPPER_SHIP_PARALLELISM": "many"},
+			want: `环境变量 IMGSHIPPER_SHIP_PARALLELISM: 无效的整数 "many"`,
+		},
+		{
+			name: "invalid env bool",
+			env:  map[string]string{"IMGSHIPPER_SHIP_SINGLE_RUN": "maybe"},
+			want: `环境变量 IMGSHIPPER_SHIP_SINGLE_RUN: 无效的布尔值 "maybe"`,
+		},
+		{
+			name:  "unknown flag key",
+			flags: map[string]string{"github.nope": "x"},
+			want:  `未知配置项 "github.nope"`,
+		},
+		{
+			// 非标量配置项不能通过命令行参数设置
+			name:  "non-scalar flag key",
+			flags: map[string]string{"pull.rewrites": "x"},
+			want:  `未知配置项 "pull.rewrites"`,
+		},
+		{
+			name:  "invalid flag value",
+			flags: map[string]string{"ship.parallelism": "two"},
+			want:  `命令行参数 ship.parallelism: 无效的整数 "two"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolate(t)
+			file := writeConfig(t, t.TempDir(), "config.yaml", tt.config)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			_, err := Load(Options{ConfigFile: file, Flags: tt.flags, SkipValidation: true})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadMissingConfigFile(t *testing.T) {
+	isolate(t)
+	_, err := Load(Options{ConfigFile: filepath.Join(t.TempDir(), "missing.yaml"), SkipValidation: true})
+	if err == nil || !strings.Contains(err.Error(), "无法读取配置文件") {
+		t.Errorf("Load() error = %v, want missing file", err)
+	}
+}
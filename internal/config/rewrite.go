@@ -0,0 +1,112 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/keevingness/image-shipper/internal/types"
+	"github.com/keevingness/image-shipper/pkg/docker"
+)
+
+// RewriteRule 拉取镜像时的源仓库改写规则
+type RewriteRule struct {
+	// Match 匹配补全后的仓库全名（如 docker.io/library/nginx）的前缀，按 '/' 分段匹配，
+	// 可以是仓库地址（quay.io）、地址加命名空间（docker.io/library），每段都支持 * ? [] 通配符
+	Match string `yaml:"match"`
+	// Mirror 改写后的仓库前缀，包含镜像仓库地址和命名空间
+	Mirror string `yaml:"mirror"`
+	// Flatten 只保留仓库名的最后一段，如 quay.io/coreos/etcd -> <mirror>/etcd
+	Flatten bool `yaml:"flatten"`
+}
+
+// matches 判断规则是否匹配仓库全名，匹配时返回前缀之后剩余的路径
+func (r RewriteRule) matches(name string) (string, bool) {
+	parts := strings.Split(name, "/")
+	n := strings.Count(r.Match, "/") + 1
+	if n > len(parts) {
+		return "", false
+	}
+	if ok, _ := path.Match(r.Match, strings.Join(parts[:n], "/")); !ok {
+		return "", false
+	}
+	return strings.Join(parts[n:], "/"), true
+}
+
+// PullSource 返回拉取镜像时实际使用的源镜像地址
+// 按顺序使用第一条匹配的改写规则；没有规则匹配时，配置了source_registry则沿用工作流的命名方式
+// 拼接在其后，否则直接从镜像原本所在的仓库拉取。
+func (c *Config) PullSource(ref docker.Reference) string {
+	if source, ok := c.pullRewrite(ref); ok {
+		return source
+	}
+	return ref.WithDefaultTag().NormalizedString()
+}
+
+// pullRewrite 按改写规则和source_registry改写镜像地址，都不适用时返回false
+func (c *Config) pullRewrite(ref docker.Reference) (string, bool) {
+	name := ref.Normalize().Name()
+	suffix := strings.TrimPrefix(ref.WithDefaultTag().String(), ref.Name())
+
+	for _, rule := range c.Pull.Rewrites {
+		rest, ok := rule.matches(name)
+		if !ok {
+			continue
+		}
+		mirror := strings.TrimSuffix(rule.Mirror, "/")
+		switch {
+		case rule.Flatten:
+			return mirror + "/" + path.Base(name) + suffix, true
+		case rest == "":
+			return mirror + suffix, true
+		default:
+			return mirror + "/" + rest + suffix, true
+		}
+	}
+
+	if c.Pull.SourceRegistry != "" {
+		return strings.TrimSuffix(c.Pull.SourceRegistry, "/") + "/" + ref.WithDefaultTag().String(), true
+	}
+	return "", false
+}
+
+// MirrorRewriter 返回改写清单时使用的镜像地址映射，不需要改写的镜像返回false
+// target不为nil时与转存工作流的命名方式一致，将原始地址拼接在目标仓库前缀之后；
+// 否则按pull.rewrites和source_registry改写，与pull拉取时使用的地址相同。
+func (c *Config) MirrorRewriter(target *types.Target) (func(ref docker.Reference) (string, bool), error) {
+	if target == nil {
+		if len(c.Pull.Rewrites) == 0 && c.Pull.SourceRegistry == "" {
+			return nil, fmt.Errorf("未配置目标仓库、pull.rewrites或pull.source_registry，无法确定转存后的镜像地址")
+		}
+		return c.pullRewrite, nil
+	}
+
+	prefix, err := c.TargetPrefix(target)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(ref docker.Reference) (string, bool) {
+		// 已经指向目标仓库的镜像不再改写，重复执行时结果不变
+		if strings.HasPrefix(ref.String(), prefix) {
+			return "", false
+		}
+		return prefix + ref.String(), true
+	}, nil
+}
+
+// validateRewrites 校验改写规则
+func (c *Config) validateRewrites() error {
+	for i, rule := range c.Pull.Rewrites {
+		if rule.Match == "" {
+			return fmt.Errorf("pull rewrite %d: match is required", i)
+		}
+		if _, err := path.Match(rule.Match, ""); err != nil {
+			return fmt.Errorf("pull rewrite %d: invalid match pattern %q", i, rule.Match)
+		}
+		if rule.Mirror == "" {
+			return fmt.Errorf("pull rewrite %d: mirror is required", i)
+		}
+	}
+	return nil
+}
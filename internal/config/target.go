@@ -0,0 +1,130 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/keevingness/image-shipper/internal/types"
+)
+
+// 支持的目标仓库类型
+const (
+	TargetGHCR      = "ghcr"
+	TargetDockerHub = "dockerhub"
+	TargetHarbor    = "harbor"
+	TargetAliyun    = "aliyun"
+	TargetTCR       = "tcr"
+	TargetSWR       = "swr"
+	TargetGeneric   = "generic"
+)
+
+// targetDefaults 各类型目标仓库的默认地址和凭据Secrets前缀
+var targetDefaults = map[string]struct {
+	registry    string
+	credentials string
+}{
+	TargetGHCR:      {registry: "ghcr.io"},
+	TargetDockerHub: {registry: "docker.io", credentials: "DOCKERHUB"},
+	TargetHarbor:    {credentials: "HARBOR"},
+	TargetAliyun:    {credentials: "ALIYUN_REGISTRY"},
+	TargetTCR:       {credentials: "TCR"},
+	TargetSWR:       {credentials: "SWR"},
+	TargetGeneric:   {credentials: "REGISTRY"},
+}
+
+// TargetProfile 命名的目标仓库配置
+type TargetProfile struct {
+	// Type 仓库类型，决定工作流如何登录以及默认的仓库地址
+	Type string `yaml:"type"`
+	// Registry 仓库地址，ghcr和dockerhub可省略
+	Registry string `yaml:"registry"`
+	// Namespace 镜像推送到的命名空间（组织、项目或用户名）
+	Namespace string `yaml:"namespace"`
+	// Credentials 工作流中保存登录凭据的Secrets名称前缀，默认由类型决定
+	Credentials string `yaml:"credentials"`
+}
+
+// ResolveTarget 根据名称查找目标仓库配置并补全默认值
+// name为空时使用ship.target；两者都未设置时返回nil，工作流沿用阿里云Secrets。
+func (c *Config) ResolveTarget(name string) (*types.Target, error) {
+	if name == "" {
+		name = c.Ship.Target
+	}
+	if name == "" {
+		return nil, nil
+	}
+
+	profile, ok := c.Targets[name]
+	if !ok {
+		return nil, fmt.Errorf("未知的目标仓库 %q，可用的目标仓库: %s", name, strings.Join(c.targetNames(), ", "))
+	}
+
+	target := &types.Target{
+		Name:        name,
+		Type:        profile.Type,
+		Registry:    profile.Registry,
+		Namespace:   profile.Namespace,
+		Credentials: profile.Credentials,
+	}
+	defaults := targetDefaults[profile.Type]
+	if target.Registry == "" {
+		target.Registry = defaults.registry
+	}
+	if target.Credentials == "" {
+		target.Credentials = defaults.credentials
+	}
+	return target, nil
+}
+
+// TargetPrefix 返回转存工作流推送镜像时使用的地址前缀，如 ghcr.io/owner/
+// 原始镜像地址拼接在该前缀之后即为转存后的地址。
+func (c *Config) TargetPrefix(target *types.Target) (string, error) {
+	namespace := target.Namespace
+	if namespace == "" {
+		switch target.Type {
+		case TargetGHCR:
+			// 工作流默认推送到仓库所有者名下
+			namespace = strings.ToLower(c.GitHub.Owner)
+		case TargetDockerHub, TargetAliyun:
+			// 工作流中默认的命名空间来自Secrets，本地无法得知
+			return "", fmt.Errorf("目标仓库 %s 未配置namespace，无法确定转存后的镜像地址", target.Name)
+		}
+	}
+	prefix := strings.TrimSuffix(target.Registry, "/") + "/"
+	if namespace != "" {
+		prefix += strings.Trim(namespace, "/") + "/"
+	}
+	return prefix, nil
+}
+
+// validateTargets 校验目标仓库配置
+func (c *Config) validateTargets() error {
+	for _, name := range c.targetNames() {
+		profile := c.Targets[name]
+		defaults, ok := targetDefaults[profile.Type]
+		if !ok {
+			return fmt.Errorf("target %q: unsupported type %q", name, profile.Type)
+		}
+		if profile.Registry == "" && defaults.registry == "" {
+			return fmt.Errorf("target %q: registry is required for type %s", name, profile.Type)
+		}
+	}
+
+	if c.Ship.Target != "" {
+		if _, ok := c.Targets[c.Ship.Target]; !ok {
+			return fmt.Errorf("ship target %q is not defined in targets", c.Ship.Target)
+		}
+	}
+	return nil
+}
+
+// targetNames 返回排序后的目标仓库名称
+func (c *Config) targetNames() []string {
+	names := make([]string, 0, len(c.Targets))
+	for name := range c.Targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,17 @@
+package flagutil
+
+import "strings"
+
+// StringList 可重复指定的字符串参数，如 -f a.yaml -f b.yaml
+type StringList []string
+
+// String 返回逗号分隔的所有取值
+func (l *StringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+// Set 追加一个取值
+func (l *StringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
@@ -0,0 +1,135 @@
+package github
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v79/github"
+	"golang.org/x/oauth2"
+)
+
+// appJWTSource 生成以GitHub App身份调用API的JWT
+// GitHub要求JWT的有效期不超过10分钟，签发时间提前一分钟以容忍时钟偏差。
+type appJWTSource struct {
+	appID int64
+	key   *rsa.PrivateKey
+}
+
+// Token 签发新的JWT
+func (s *appJWTSource) Token() (*oauth2.Token, error) {
+	now := time.Now()
+	expiry := now.Add(9 * time.Minute)
+
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]int64{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": expiry.Unix(),
+		"iss": s.appID,
+	})
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign GitHub App JWT: %w", err)
+	}
+	return &oauth2.Token{
+		AccessToken: unsigned + "." + base64.RawURLEncoding.EncodeToString(signature),
+		Expiry:      expiry,
+	}, nil
+}
+
+// installationTokenSource 获取GitHub App的安装令牌
+// 安装令牌一小时后过期，由oauth2.ReuseTokenSource在过期前重新获取，长时间的批量转存不会中途失效。
+type installationTokenSource struct {
+	// apps 以JWT认证的客户端
+	apps           *github.Client
+	owner          string
+	repo           string
+	installationID int64
+
+	mu          sync.Mutex
+	permissions *github.InstallationPermissions
+}
+
+// Token 获取新的安装令牌，令牌只授权访问转存仓库
+func (s *installationTokenSource) Token() (*oauth2.Token, error) {
+	ctx := context.Background()
+
+	s.mu.Lock()
+	installationID := s.installationID
+	s.mu.Unlock()
+	if installationID == 0 {
+		installation, _, err := s.apps.Apps.FindRepositoryInstallation(ctx, s.owner, s.repo)
+		if err != nil {
+			return nil, fmt.Errorf("GitHub App is not installed on %s/%s: %w", s.owner, s.repo, err)
+		}
+		installationID = installation.GetID()
+	}
+
+	token, _, err := s.apps.Apps.CreateInstallationToken(ctx, installationID, &github.InstallationTokenOptions{
+		Repositories: []string{s.repo},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create installation token: %w", err)
+	}
+
+	s.mu.Lock()
+	s.installationID = installationID
+	s.permissions = token.GetPermissions()
+	s.mu.Unlock()
+
+	return &oauth2.Token{
+		AccessToken: token.GetToken(),
+		Expiry:      token.GetExpiresAt().Time,
+	}, nil
+}
+
+// Permissions 返回最近一次获取的安装令牌的权限，尚未获取令牌时为nil
+func (s *installationTokenSource) Permissions() *github.InstallationPermissions {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.permissions
+}
+
+// loadAppPrivateKey 读取GitHub App私钥，value可以是PEM文件路径或PEM内容
+// GitHub生成的私钥为PKCS#1格式，也接受转换后的PKCS#8格式。
+func loadAppPrivateKey(value string) (*rsa.PrivateKey, error) {
+	data := []byte(value)
+	if !strings.Contains(value, "-----BEGIN") {
+		var err error
+		if data, err = os.ReadFile(value); err != nil {
+			return nil, fmt.Errorf("failed to read GitHub App private key: %w", err)
+		}
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("GitHub App private key is not in PEM format")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse GitHub App private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("GitHub App private key must be an RSA key")
+	}
+	return key, nil
+}
@@ -0,0 +1,426 @@
+package github
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/keevingness/image-shipper/internal/config"
+)
+
+const (
+	testAppID          = 1234
+	testInstallationID = 99
+)
+
+// testAppKey 测试使用的GitHub App私钥，只生成一次
+var testAppKey = sync.OnceValue(func() *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return key
+})
+
+// pemKey 将私钥编码为PEM格式
+func pemKey(t *testing.T, blockType string, der []byte) string {
+	t.Helper()
+	return string(pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}))
+}
+
+// fakeGitHub 进程内的GitHub Enterprise Server API，只实现App认证和权限检查用到的接口
+// /app 下的接口要求有效的App JWT，其他接口要求最近签发的安装令牌或静态令牌。
+type fakeGitHub struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu sync.Mutex
+	// token 静态令牌认证时接受的令牌
+	token string
+	// installed 为false时查找安装返回404
+	installed bool
+	// permissions 安装令牌的权限
+	permissions map[string]string
+	// tokenTTL 安装令牌的有效期
+	tokenTTL time.Duration
+	// tokens 已签发的安装令牌
+	tokens []string
+	// lookups 查找仓库安装的次数
+	lookups int
+	// tokenRepos 最近一次签发令牌时限定的仓库
+	tokenRepos []string
+
+	// workflowStatus 读取工作流返回的状态码
+	workflowStatus int
+	// scopes 读取工作流时返回的X-OAuth-Scopes
+	scopes string
+	// dispatchStatus 触发工作流返回的状态码
+	dispatchStatus int
+	// accepted 触发工作流返回403时的X-Accepted-GitHub-Permissions
+	accepted string
+	// dispatchRef 最近一次触发工作流使用的分支
+	dispatchRef string
+}
+
+// newFakeGitHub 启动进程内的GitHub API，测试结束时关闭
+func newFakeGitHub(t *testing.T) *fakeGitHub {
+	t.Helper()
+	f := &fakeGitHub{
+		t:              t,
+		installed:      true,
+		permissions:    map[string]string{"actions": "write", "contents": "read"},
+		tokenTTL:       time.Hour,
+		workflowStatus: http.StatusOK,
+		dispatchStatus: http.StatusNoContent,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v3/repos/owner/image-shipper/installation", f.app(func(w http.ResponseWriter, r *http.Request) {
+		f.lookups++
+		if !f.installed {
+			http.Error(w, `{"message":"Not Found"}`, http.StatusNotFound)
+			return
+		}
+		fmt.Fprintf(w, `{"id":%d}`, testInstallationID)
+	}))
+	mux.HandleFunc(fmt.Sprintf("POST /api/v3/app/installations/%d/access_tokens", testInstallationID), f.app(f.createToken))
+	mux.HandleFunc("GET /api/v3/repos/owner/image-shipper/actions/workflows/image-shipper.yaml", f.repo(func(w http.ResponseWriter, r *http.Request) {
+		if f.scopes != "" {
+			w.Header().Set("X-OAuth-Scopes", f.scopes)
+		}
+		if f.workflowStatus != http.StatusOK {
+			http.Error(w, `{"message":"Not Found"}`, f.workflowStatus)
+			return
+		}
+		fmt.Fprint(w, `{"id":1,"path":".github/workflows/image-shipper.yaml"}`)
+	}))
+	mux.HandleFunc("POST /api/v3/repos/owner/image-shipper/actions/workflows/image-shipper.yaml/dispatches", f.repo(func(w http.ResponseWriter, r *http.Request) {
+		var event struct {
+			Ref string `json:"ref"`
+		}
+		json.NewDecoder(r.Body).Decode(&event)
+		f.dispatchRef = event.Ref
+		switch f.dispatchStatus {
+		case http.StatusNoContent:
+			w.WriteHeader(http.StatusNoContent)
+		case http.StatusUnprocessableEntity:
+			http.Error(w, `{"message":"No ref found for: `+event.Ref+`"}`, http.StatusUnprocessableEntity)
+		case http.StatusForbidden:
+			if f.accepted != "" {
+				w.Header().Set("X-Accepted-GitHub-Permissions", f.accepted)
+			}
+			http.Error(w, `{"message":"Resource not accessible by personal access token"}`, http.StatusForbidden)
+		default:
+			http.Error(w, `{"message":"Server Error"}`, f.dispatchStatus)
+		}
+	}))
+
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+// app 要求请求携带由测试私钥签名的App JWT
+func (f *fakeGitHub) app(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jwt, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			http.Error(w, `{"message":"A JSON web token could not be decoded"}`, http.StatusUnauthorized)
+			return
+		}
+		if err := verifyAppJWT(jwt, &testAppKey().PublicKey, time.Now()); err != nil {
+			f.t.Errorf("%s %s: %v", r.Method, r.URL.Path, err)
+			http.Error(w, `{"message":"A JSON web token could not be decoded"}`, http.StatusUnauthorized)
+			return
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		handler(w, r)
+	}
+}
+
+// repo 要求请求携带静态令牌或最近签发的安装令牌
+func (f *fakeGitHub) repo(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		valid := token == f.token
+		if len(f.tokens) > 0 {
+			valid = valid || token == f.tokens[len(f.tokens)-1]
+		}
+		if token == "" || !valid {
+			http.Error(w, `{"message":"Bad credentials"}`, http.StatusUnauthorized)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// createToken 签发新的安装令牌
+func (f *fakeGitHub) createToken(w http.ResponseWriter, r *http.Request) {
+	var options struct {
+		Repositories []string `json:"repositories"`
+	}
+	json.NewDecoder(r.Body).Decode(&options)
+	f.tokenRepos = options.Repositories
+
+	token := fmt.Sprintf("ghs_token%d", len(f.tokens)+1)
+	f.tokens = append(f.tokens, token)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"token":       token,
+		"expires_at":  time.Now().Add(f.tokenTTL).UTC().Format(time.RFC3339),
+		"permissions": f.permissions,
+	})
+}
+
+// issued 返回已签发的安装令牌数量和查找安装的次数
+func (f *fakeGitHub) issued() (int, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.tokens), f.lookups
+}
+
+// config 返回连接到该服务的配置
+func (f *fakeGitHub) config() config.GitHubConfig {
+	return config.GitHubConfig{
+		Owner:    "owner",
+		Repo:     "image-shipper",
+		Workflow: "image-shipper.yaml",
+		Ref:      "main",
+		APIURL:   f.server.URL,
+	}
+}
+
+// tokenClient 创建使用静态令牌的客户端
+func (f *fakeGitHub) tokenClient(t *testing.T, token string) *Client {
+	t.Helper()
+	f.mu.Lock()
+	f.token = token
+	f.mu.Unlock()
+	cfg := f.config()
+	cfg.Token = token
+	client, err := NewClient(cfg, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// appClient 创建以GitHub App身份认证的客户端，installationID为0时按仓库查找安装
+func (f *fakeGitHub) appClient(t *testing.T, installationID int64) *Client {
+	t.Helper()
+	cfg := f.config()
+	cfg.AppID = testAppID
+	cfg.AppPrivateKey = pemKey(t, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(testAppKey()))
+	cfg.AppInstallationID = installationID
+	client, err := NewClient(cfg, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// verifyAppJWT 校验JWT的签名和GitHub要求的声明
+func verifyAppJWT(jwt string, key *rsa.PublicKey, now time.Time) error {
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("JWT has %d parts, want 3", len(parts))
+	}
+
+	var header map[string]string
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return err
+	}
+	if header["alg"] != "RS256" || header["typ"] != "JWT" {
+		return fmt.Errorf("JWT header = %v, want RS256 JWT", header)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return fmt.Errorf("JWT signature is not base64url: %w", err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return fmt.Errorf("JWT signature is invalid: %w", err)
+	}
+
+	var claims map[string]int64
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return err
+	}
+	iat, exp := time.Unix(claims["iat"], 0), time.Unix(claims["exp"], 0)
+	switch {
+	case claims["iss"] != testAppID:
+		return fmt.Errorf("JWT iss = %d, want %d", claims["iss"], testAppID)
+	case iat.After(now.Add(-50 * time.Second)):
+		return fmt.Errorf("JWT iat %s is not backdated for clock skew", iat)
+	case exp.Sub(iat) > 10*time.Minute:
+		return fmt.Errorf("JWT lifetime %s exceeds 10 minutes", exp.Sub(iat))
+	case !exp.After(now):
+		return fmt.Errorf("JWT expired at %s", exp)
+	}
+	return nil
+}
+
+// decodeJWTPart 解码JWT的头部或声明
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return fmt.Errorf("JWT part is not base64url: %w", err)
+	}
+	return json.Unmarshal(data, v)
+}
+
+func TestAppJWTSource(t *testing.T) {
+	source := &appJWTSource{appID: testAppID, key: testAppKey()}
+	token, err := source.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyAppJWT(token.AccessToken, &testAppKey().PublicKey, time.Now()); err != nil {
+		t.Error(err)
+	}
+	// oauth2在Expiry之前复用JWT，Expiry不能晚于JWT自身的exp
+	if remaining := time.Until(token.Expiry); remaining <= 0 || remaining > 9*time.Minute {
+		t.Errorf("Expiry in %s, want within 9 minutes", remaining)
+	}
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyAppJWT(token.AccessToken, &other.PublicKey, time.Now()); err == nil {
+		t.Error("JWT verified with a different key")
+	}
+}
+
+func TestLoadAppPrivateKey(t *testing.T) {
+	key := testAppKey()
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecPKCS8, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	writeKey := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	tests := []struct {
+		name    string
+		value   string
+		wantErr string
+	}{
+		{name: "PKCS#1 content", value: pemKey(t, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key))},
+		{name: "PKCS#1 file", value: writeKey("pkcs1.pem", pemKey(t, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key)))},
+		{name: "PKCS#8 content", value: pemKey(t, "PRIVATE KEY", pkcs8)},
+		{name: "PKCS#8 file", value: writeKey("pkcs8.pem", pemKey(t, "PRIVATE KEY", pkcs8))},
+		{name: "missing file", value: filepath.Join(dir, "missing.pem"), wantErr: "failed to read GitHub App private key"},
+		{name: "not PEM", value: writeKey("key.txt", "not a key"), wantErr: "not in PEM format"},
+		{name: "invalid DER", value: pemKey(t, "PRIVATE KEY", []byte("garbage")), wantErr: "failed to parse GitHub App private key"},
+		{name: "EC key", value: pemKey(t, "PRIVATE KEY", ecPKCS8), wantErr: "must be an RSA key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loadAppPrivateKey(tt.value)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(key) {
+				t.Error("loaded a different key")
+			}
+		})
+	}
+}
+
+func TestInstallationToken(t *testing.T) {
+	f := newFakeGitHub(t)
+	client := f.appClient(t, 0)
+
+	// 未设置安装ID时按仓库查找一次，之后复用未过期的令牌
+	for i := 0; i < 2; i++ {
+		if err := client.CheckPermissions(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if tokens, lookups := f.issued(); tokens != 1 || lookups != 1 {
+		t.Errorf("issued %d tokens with %d installation lookups, want 1 and 1", tokens, lookups)
+	}
+	f.mu.Lock()
+	if len(f.tokenRepos) != 1 || f.tokenRepos[0] != "image-shipper" {
+		t.Errorf("token scoped to repositories %q, want image-shipper", f.tokenRepos)
+	}
+	f.mu.Unlock()
+	if got := client.installation.Permissions().GetActions(); got != "write" {
+		t.Errorf("Permissions().Actions = %q, want write", got)
+	}
+}
+
+func TestInstallationTokenRefresh(t *testing.T) {
+	f := newFakeGitHub(t)
+	// 有效期短于oauth2的提前刷新时间，每次请求都会重新获取
+	f.tokenTTL = 5 * time.Second
+	client := f.appClient(t, testInstallationID)
+
+	for i := 0; i < 3; i++ {
+		if err := client.CheckPermissions(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 配置了安装ID时不查找安装
+	if tokens, lookups := f.issued(); tokens != 3 || lookups != 0 {
+		t.Errorf("issued %d tokens with %d installation lookups, want 3 and 0", tokens, lookups)
+	}
+}
+
+func TestInstallationTokenNotInstalled(t *testing.T) {
+	f := newFakeGitHub(t)
+	f.installed = false
+	client := f.appClient(t, 0)
+
+	err := client.CheckPermissions()
+	if err == nil || !strings.Contains(err.Error(), "GitHub App is not installed on owner/image-shipper") {
+		t.Errorf("CheckPermissions() error = %v, want not installed", err)
+	}
+	if tokens, _ := f.issued(); tokens != 0 {
+		t.Errorf("issued %d tokens without an installation", tokens)
+	}
+}
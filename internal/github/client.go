@@ -1,61 +1,179 @@
 package github
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/go-github/v79/github"
 	"go.uber.org/zap"
 	"golang.org/x/oauth2"
 
+	"github.com/keevingness/image-shipper/internal/config"
+	"github.com/keevingness/image-shipper/internal/httputil"
 	"github.com/keevingness/image-shipper/internal/types"
 )
 
 // Client GitHub客户端封装
 type Client struct {
-	client   *github.Client
-	logger   *zap.Logger
-	owner    string
-	repo     string
-	workflow string
+	client *github.Client
+	// httpClient 不带令牌的HTTP客户端，用于从预签名地址下载制品和日志
+	httpClient *http.Client
+	logger     *zap.Logger
+	owner      string
+	repo       string
+	workflow   string
+	ref        string
+	// tokenKind 令牌类型，使用GitHub App认证时为空
+	tokenKind string
+	// installation 使用GitHub App认证时的安装令牌来源
+	installation *installationTokenSource
+
+	// runs 缓存已定位到的运行记录，键为请求ID
+	mu   sync.Mutex
+	runs map[string]int64
 }
 
+const (
+	// runLookupSkew 按创建时间过滤运行记录时允许的时钟偏差
+	runLookupSkew = 2 * time.Minute
+	// ResultsArtifact 工作流上传的结果制品名称
+	ResultsArtifact = "image-shipper-results"
+	// maxInputLength 单个workflow_dispatch输入允许的最大长度
+	maxInputLength = 65535
+)
+
 // NewClient 创建新的GitHub客户端
-func NewClient(token, owner, repo, workflow string, logger *zap.Logger) *Client {
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: token},
-	)
-	tc := oauth2.NewClient(context.Background(), ts)
-	client := github.NewClient(tc)
+// 配置了APIURL时连接GitHub Enterprise Server，否则连接github.com。
+// 配置了AppID时以GitHub App身份认证，安装令牌按需获取并在过期前自动刷新，否则使用静态令牌。
+func NewClient(cfg config.GitHubConfig, logger *zap.Logger) (*Client, error) {
+	httpClient, err := httputil.NewClient(cfg.Proxy, cfg.CACert)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, httpClient)
+
+	c := &Client{
+		httpClient: httpClient,
+		logger:     logger,
+		owner:      cfg.Owner,
+		repo:       cfg.Repo,
+		workflow:   cfg.Workflow,
+		ref:        cfg.Ref,
+		runs:       map[string]int64{},
+	}
+
+	var ts oauth2.TokenSource
+	if cfg.AppID != 0 {
+		key, err := loadAppPrivateKey(cfg.AppPrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		apps, err := newAPIClient(oauth2.NewClient(ctx, oauth2.ReuseTokenSource(nil, &appJWTSource{appID: cfg.AppID, key: key})), cfg)
+		if err != nil {
+			return nil, err
+		}
+		c.installation = &installationTokenSource{
+			apps:           apps,
+			owner:          cfg.Owner,
+			repo:           cfg.Repo,
+			installationID: cfg.AppInstallationID,
+		}
+		ts = oauth2.ReuseTokenSource(nil, c.installation)
+	} else {
+		c.tokenKind = tokenKind(cfg.Token)
+		ts = oauth2.StaticTokenSource(
+			&oauth2.Token{AccessToken: cfg.Token},
+		)
+	}
+
+	if c.client, err = newAPIClient(oauth2.NewClient(ctx, ts), cfg); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
 
-	return &Client{
-		client:   client,
-		logger:   logger,
-		owner:    owner,
-		repo:     repo,
-		workflow: workflow,
+// newAPIClient 创建使用指定HTTP客户端的API客户端，配置了APIURL时指向GitHub Enterprise Server
+func newAPIClient(httpClient *http.Client, cfg config.GitHubConfig) (*github.Client, error) {
+	client := github.NewClient(httpClient)
+	if cfg.APIURL == "" {
+		return client, nil
+	}
+	client, err := client.WithEnterpriseURLs(cfg.APIURL, cmp.Or(cfg.UploadURL, cfg.APIURL))
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitHub Enterprise URL: %w", err)
 	}
+	return client, nil
 }
 
 // TriggerMirrorWorkflow 触发镜像转存工作流
-func (c *Client) TriggerMirrorWorkflow(sourceImage, targetRegistry string) (*types.MirrorRequest, error) {
+// 每次触发都会生成唯一的请求ID并作为request_id输入传给工作流，
+// 工作流将其写入运行名称，GetWorkflowStatus据此定位对应的运行记录。
+// target为nil时不传目标仓库输入，由工作流使用默认的阿里云配置；
+// platforms为空时复制镜像的全部平台，否则只复制指定的平台。
+func (c *Client) TriggerMirrorWorkflow(sourceImage string, target *types.Target, platforms []string) (*types.MirrorRequest, error) {
+	request, err := c.dispatch([]string{sourceImage}, target, platforms)
+	if err != nil {
+		return nil, err
+	}
+	request.SourceImage = sourceImage
+
+	c.logger.Info("Successfully triggered mirror workflow",
+		zap.String("request_id", request.ID),
+		zap.String("source_image", sourceImage),
+		zap.String("target_registry", request.TargetRegistry))
+
+	return request, nil
+}
+
+// TriggerBatchMirrorWorkflow 在单个工作流运行中转存一组镜像
+// 镜像列表以JSON数组的形式通过docker_images输入传给工作流，
+// 运行结束后通过GetWorkflowResults获取每个镜像的结果。
+func (c *Client) TriggerBatchMirrorWorkflow(sourceImages []string, target *types.Target, platforms []string) (*types.MirrorRequest, error) {
+	request, err := c.dispatch(sourceImages, target, platforms)
+	if err != nil {
+		return nil, err
+	}
+	request.SourceImages = sourceImages
+
+	c.logger.Info("Successfully triggered batch mirror workflow",
+		zap.String("request_id", request.ID),
+		zap.Int("images", len(sourceImages)),
+		zap.String("target_registry", request.TargetRegistry))
+
+	return request, nil
+}
+
+// dispatch 带上新生成的请求ID、目标仓库和平台列表触发工作流
+func (c *Client) dispatch(images []string, target *types.Target, platforms []string) (*types.MirrorRequest, error) {
 	// 生成唯一ID
-	requestID := fmt.Sprintf("%d", time.Now().Unix())
+	requestID, err := NewRequestID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate request id: %w", err)
+	}
+	inputs, err := WorkflowInputs(requestID, images, target, platforms)
+	if err != nil {
+		return nil, err
+	}
 
-	// 准备工作流输入参数
-	// 工作流文件期望接收一个名为docker_image的参数
-	inputs := map[string]interface{}{
-		"docker_image": sourceImage,
+	targetRegistry := ""
+	if target != nil {
+		targetRegistry = target.Registry
 	}
 
 	// 触发工作流
 	event := github.CreateWorkflowDispatchEventRequest{
-		Ref:    "main",
+		Ref:    c.ref,
 		Inputs: inputs,
 	}
 
-	_, err := c.client.Actions.CreateWorkflowDispatchEventByFileName(
+	createdAt := time.Now()
+	_, err = c.client.Actions.CreateWorkflowDispatchEventByFileName(
 		context.Background(),
 		c.owner,
 		c.repo,
@@ -64,112 +182,188 @@ func (c *Client) TriggerMirrorWorkflow(sourceImage, targetRegistry string) (*typ
 	)
 	if err != nil {
 		c.logger.Error("Failed to trigger GitHub workflow", zap.Error(err))
+		if permission := missingPermission(err); permission != "" {
+			return nil, fmt.Errorf("failed to trigger workflow: %s is missing the %s permission: %w", c.credentialName(), permission, err)
+		}
 		return nil, fmt.Errorf("failed to trigger workflow: %w", err)
 	}
 
 	// 创建请求记录
-	request := &types.MirrorRequest{
+	return &types.MirrorRequest{
 		ID:             requestID,
-		SourceImage:    sourceImage,
 		TargetRegistry: targetRegistry,
 		Status:         "pending",
-		CreatedAt:      time.Now(),
-		UpdatedAt:      time.Now(),
+		CreatedAt:      createdAt,
+		UpdatedAt:      createdAt,
+	}, nil
+}
+
+// GetWorkflowResults 下载运行结果制品并解析每个镜像的转存结果
+// 只有在工作流运行结束后调用才能拿到完整结果。
+func (c *Client) GetWorkflowResults(request *types.MirrorRequest) ([]types.ImageResult, error) {
+	runID, err := c.findRunID(request)
+	if err != nil {
+		return nil, err
+	}
+	if runID == 0 {
+		return nil, fmt.Errorf("workflow run for request %s is not visible yet", request.ID)
 	}
 
-	c.logger.Info("Successfully triggered mirror workflow",
-		zap.String("request_id", requestID),
-		zap.String("source_image", sourceImage),
-		zap.String("target_registry", targetRegistry))
+	artifacts, _, err := c.client.Actions.ListWorkflowRunArtifacts(
+		context.Background(),
+		c.owner,
+		c.repo,
+		runID,
+		&github.ListOptions{PerPage: 100},
+	)
+	if err != nil {
+		c.logger.Error("Failed to list workflow artifacts", zap.Error(err))
+		return nil, fmt.Errorf("failed to list workflow artifacts: %w", err)
+	}
 
-	return request, nil
+	for _, artifact := range artifacts.Artifacts {
+		if artifact.GetName() != ResultsArtifact {
+			continue
+		}
+
+		downloadURL, _, err := c.client.Actions.DownloadArtifact(
+			context.Background(),
+			c.owner,
+			c.repo,
+			artifact.GetID(),
+			3,
+		)
+		if err != nil {
+			c.logger.Error("Failed to get artifact download url", zap.Error(err))
+			return nil, fmt.Errorf("failed to download results artifact: %w", err)
+		}
+		return c.downloadResults(downloadURL.String())
+	}
+
+	return nil, fmt.Errorf("results artifact %q not found in workflow run %d", ResultsArtifact, runID)
 }
 
 // GetWorkflowStatus 获取工作流状态
-func (c *Client) GetWorkflowStatus(requestID string) (*types.GitHubWorkflowResponse, error) {
-	// 获取工作流运行列表，按创建时间降序排列
-	runs, _, err := c.client.Actions.ListWorkflowRunsByFileName(
+// 运行记录在触发后需要一段时间才会出现在列表中，此时返回状态为
+// types.WorkflowStatusNotVisible 的响应，而不是猜测一个相近的运行。
+func (c *Client) GetWorkflowStatus(request *types.MirrorRequest) (*types.GitHubWorkflowResponse, error) {
+	runID, err := c.findRunID(request)
+	if err != nil {
+		return nil, err
+	}
+	if runID == 0 {
+		return &types.GitHubWorkflowResponse{Status: types.WorkflowStatusNotVisible}, nil
+	}
+
+	// 获取工作流运行的详细信息
+	runDetail, _, err := c.client.Actions.GetWorkflowRunByID(
 		context.Background(),
 		c.owner,
 		c.repo,
-		c.workflow,
-		&github.ListWorkflowRunsOptions{
-			Event: "workflow_dispatch",
-		},
+		runID,
 	)
 	if err != nil {
-		c.logger.Error("Failed to list workflow runs", zap.Error(err))
-		return nil, fmt.Errorf("failed to list workflow runs: %w", err)
+		c.logger.Error("Failed to get workflow run details", zap.Error(err))
+		return nil, fmt.Errorf("failed to get workflow run details: %w", err)
+	}
+
+	status := "unknown"
+	if runDetail.Status != nil {
+		status = *runDetail.Status
+	}
+
+	conclusion := "unknown"
+	if runDetail.Conclusion != nil {
+		conclusion = *runDetail.Conclusion
+	}
+
+	return &types.GitHubWorkflowResponse{
+		WorkflowID: runDetail.GetID(),
+		Status:     status,
+		Conclusion: conclusion,
+		URL:        runDetail.GetHTMLURL(),
+	}, nil
+}
+
+// CancelWorkflow 取消请求对应的工作流运行
+func (c *Client) CancelWorkflow(request *types.MirrorRequest) error {
+	runID, err := c.findRunID(request)
+	if err != nil {
+		return err
+	}
+	if runID == 0 {
+		return fmt.Errorf("workflow run for request %s is not visible yet", request.ID)
+	}
+
+	_, err = c.client.Actions.CancelWorkflowRunByID(context.Background(), c.owner, c.repo, runID)
+	// 取消请求被接受后异步执行，GitHub返回202
+	var accepted *github.AcceptedError
+	if err != nil && !errors.As(err, &accepted) {
+		c.logger.Error("Failed to cancel workflow run", zap.Int64("run_id", runID), zap.Error(err))
+		return fmt.Errorf("failed to cancel workflow run: %w", err)
 	}
+	return nil
+}
 
-	// 将request_id转换为时间戳，用于时间匹配
-	requestTime, err := time.Parse(time.RFC3339, requestID)
+// GetWorkflowLogs 下载工作流运行的日志，只有在运行结束后才能获取
+func (c *Client) GetWorkflowLogs(request *types.MirrorRequest) (string, error) {
+	runID, err := c.findRunID(request)
 	if err != nil {
-		// 如果requestID不是RFC3339格式，尝试将其解析为Unix时间戳
-		timestamp, err := time.Parse(time.RFC3339, time.Unix(0, 0).Add(time.Duration(parseInt(requestID))*time.Second).Format(time.RFC3339))
-		if err != nil {
-			return nil, fmt.Errorf("invalid request_id format: %w", err)
-		}
-		requestTime = timestamp
+		return "", err
+	}
+	if runID == 0 {
+		return "", fmt.Errorf("workflow run for request %s is not visible yet", request.ID)
+	}
+
+	logsURL, _, err := c.client.Actions.GetWorkflowRunLogs(context.Background(), c.owner, c.repo, runID, 3)
+	if err != nil {
+		c.logger.Error("Failed to get workflow logs url", zap.Error(err))
+		return "", fmt.Errorf("failed to download workflow logs: %w", err)
+	}
+	return c.downloadLogs(logsURL.String())
+}
+
+// findRunID 根据请求ID查找对应的工作流运行，尚未出现时返回0
+func (c *Client) findRunID(request *types.MirrorRequest) (int64, error) {
+	c.mu.Lock()
+	runID, ok := c.runs[request.ID]
+	c.mu.Unlock()
+	if ok {
+		return runID, nil
 	}
 
-	// 查找最近的工作流运行
-	if len(runs.WorkflowRuns) > 0 {
-		// 获取最新的工作流运行
-		run := runs.WorkflowRuns[0]
+	opts := &github.ListWorkflowRunsOptions{
+		Event:       "workflow_dispatch",
+		Created:     ">=" + request.CreatedAt.Add(-runLookupSkew).UTC().Format(time.RFC3339),
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
 
-		// 获取工作流运行的详细信息
-		runDetail, _, err := c.client.Actions.GetWorkflowRunByID(
+	// 逐页查找运行名称中带有请求ID的运行记录
+	for {
+		runs, resp, err := c.client.Actions.ListWorkflowRunsByFileName(
 			context.Background(),
 			c.owner,
 			c.repo,
-			run.GetID(),
+			c.workflow,
+			opts,
 		)
 		if err != nil {
-			c.logger.Error("Failed to get workflow run details", zap.Error(err))
-			return nil, fmt.Errorf("failed to get workflow run details: %w", err)
+			c.logger.Error("Failed to list workflow runs", zap.Error(err))
+			return 0, fmt.Errorf("failed to list workflow runs: %w", err)
 		}
 
-		// 检查工作流创建时间是否与request_id匹配（允许5分钟的时间差）
-		if run.CreatedAt != nil {
-			diff := run.CreatedAt.Sub(requestTime)
-			if diff < 5*time.Minute && diff > -5*time.Minute {
-				// 找到匹配的工作流运行
-				status := "unknown"
-				if runDetail.Status != nil {
-					status = *runDetail.Status
-				}
-
-				conclusion := "unknown"
-				if runDetail.Conclusion != nil {
-					conclusion = *runDetail.Conclusion
-				}
-
-				url := ""
-				if runDetail.HTMLURL != nil {
-					url = *runDetail.HTMLURL
-				}
-
-				return &types.GitHubWorkflowResponse{
-					WorkflowID: runDetail.GetID(),
-					Status:     status,
-					Conclusion: conclusion,
-					URL:        url,
-				}, nil
+		for _, run := range runs.WorkflowRuns {
+			if strings.Contains(run.GetDisplayTitle(), request.ID) {
+				c.mu.Lock()
+				c.runs[request.ID] = run.GetID()
+				c.mu.Unlock()
+				return run.GetID(), nil
 			}
 		}
-	}
-
-	return nil, fmt.Errorf("workflow run with request_id %s not found", requestID)
-}
 
-// parseInt 辅助函数，将字符串转换为int
-func parseInt(s string) int64 {
-	var result int64
-	for _, r := range s {
-		if r >= '0' && r <= '9' {
-			result = result*10 + int64(r-'0')
+		if resp.NextPage == 0 {
+			return 0, nil
 		}
+		opts.Page = resp.NextPage
 	}
-	return result
 }
@@ -0,0 +1,55 @@
+package github
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/keevingness/image-shipper/internal/types"
+)
+
+// WorkflowInputs 生成转存工作流的输入
+// 一个镜像时通过docker_image传递，多个镜像以JSON数组通过docker_images传递；
+// 请求ID由工作流写入运行名称，用于定位对应的运行记录。Gitea等使用同一工作流文件的后端也由此生成输入。
+func WorkflowInputs(requestID string, images []string, target *types.Target, platforms []string) (map[string]interface{}, error) {
+	inputs := map[string]interface{}{
+		"request_id": requestID,
+	}
+	if len(images) == 1 {
+		inputs["docker_image"] = images[0]
+	} else {
+		encoded, err := json.Marshal(images)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode image list: %w", err)
+		}
+		if len(encoded) > maxInputLength {
+			return nil, fmt.Errorf("image list too long for a single workflow run (%d bytes, limit %d)", len(encoded), maxInputLength)
+		}
+		// 覆盖docker_image的默认值，否则工作流会额外转存默认镜像
+		inputs["docker_image"] = ""
+		inputs["docker_images"] = string(encoded)
+	}
+
+	if target != nil {
+		inputs["target_type"] = target.Type
+		inputs["target_registry"] = target.Registry
+		inputs["target_namespace"] = target.Namespace
+		inputs["target_credentials"] = target.Credentials
+	}
+	if len(platforms) > 0 {
+		inputs["platforms"] = strings.Join(platforms, ",")
+	}
+	return inputs, nil
+}
+
+// NewRequestID 生成请求ID，由触发时间和随机后缀组成，保证并发触发时互不相同
+func NewRequestID() (string, error) {
+	suffix := make([]byte, 6)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d-%s", time.Now().Unix(), hex.EncodeToString(suffix)), nil
+}
@@ -0,0 +1,40 @@
+package github
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// downloadLogs 下载运行日志压缩包，按任务拼接为文本
+// 压缩包根目录下每个任务有一个完整的日志文件，子目录中是按步骤拆分的重复内容，只读取前者。
+func (c *Client) downloadLogs(url string) (string, error) {
+	archive, err := c.downloadArchive(url, "workflow logs")
+	if err != nil {
+		return "", err
+	}
+
+	files := archive.File[:0:0]
+	for _, file := range archive.File {
+		if !strings.Contains(file.Name, "/") && strings.HasSuffix(file.Name, ".txt") {
+			files = append(files, file)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+
+	var sb strings.Builder
+	for _, file := range files {
+		rc, err := file.Open()
+		if err != nil {
+			return "", fmt.Errorf("failed to open %s: %w", file.Name, err)
+		}
+		fmt.Fprintf(&sb, "==> %s <==\n", file.Name)
+		_, err = io.Copy(&sb, rc)
+		rc.Close()
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", file.Name, err)
+		}
+	}
+	return sb.String(), nil
+}
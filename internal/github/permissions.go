@@ -0,0 +1,144 @@
+package github
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/google/go-github/v79/github"
+)
+
+// 令牌类型，按GitHub令牌的前缀区分
+const (
+	tokenClassic     = "classic"
+	tokenFineGrained = "fine-grained"
+	tokenApp         = "app"
+	tokenOther       = "other"
+)
+
+// legacyToken 旧式的无前缀personal access token
+var legacyToken = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// tokenKind 根据前缀判断令牌类型
+func tokenKind(token string) string {
+	switch {
+	case strings.HasPrefix(token, "github_pat_"):
+		return tokenFineGrained
+	case strings.HasPrefix(token, "ghp_"), legacyToken.MatchString(token):
+		return tokenClassic
+	case strings.HasPrefix(token, "ghs_"):
+		// 其他工具生成后传入的GitHub App安装令牌
+		return tokenApp
+	default:
+		return tokenOther
+	}
+}
+
+// CheckPermissions 检查凭据能否读取工作流并触发运行，缺少权限时错误信息中指明缺少的权限
+// GitHub App直接检查安装令牌的权限，classic令牌检查其scope；
+// 细粒度令牌的权限无法查询，以一个不存在的分支触发工作流来试探：有actions:write权限时GitHub只会拒绝该分支，不会创建运行。
+func (c *Client) CheckPermissions() error {
+	ctx := context.Background()
+
+	_, resp, err := c.client.Actions.GetWorkflowByFileName(ctx, c.owner, c.repo, c.workflow)
+	if err != nil {
+		if resp != nil && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden) {
+			return fmt.Errorf("cannot read workflow %s in %s/%s: make sure the repository exists and the %s has the actions:read permission on it: %w",
+				c.workflow, c.owner, c.repo, c.credentialName(), err)
+		}
+		return fmt.Errorf("failed to check GitHub permissions: %w", err)
+	}
+
+	switch {
+	case c.installation != nil:
+		actions := c.installation.Permissions().GetActions()
+		if actions != "write" {
+			return fmt.Errorf("GitHub App installation is missing the actions:write permission (has actions:%s): grant \"Actions: Read and write\" in the app settings and approve the new permissions for the installation",
+				cmp.Or(actions, "none"))
+		}
+
+	case resp.Header.Get("X-OAuth-Scopes") != "" || c.tokenKind == tokenClassic:
+		// classic令牌没有单独的actions权限，触发工作流需要repo scope，公开仓库也可以只有public_repo
+		scopes := strings.Split(resp.Header.Get("X-OAuth-Scopes"), ",")
+		for i := range scopes {
+			scopes[i] = strings.TrimSpace(scopes[i])
+		}
+		if !slices.Contains(scopes, "repo") && !slices.Contains(scopes, "public_repo") {
+			return fmt.Errorf("token is missing the repo scope required for actions:write (has scopes: %s)",
+				cmp.Or(resp.Header.Get("X-OAuth-Scopes"), "none"))
+		}
+
+	default:
+		return c.probeDispatch(ctx)
+	}
+	return nil
+}
+
+// probeDispatch 以不存在的分支触发工作流，检查是否具有actions:write权限
+func (c *Client) probeDispatch(ctx context.Context) error {
+	requestID, err := NewRequestID()
+	if err != nil {
+		return err
+	}
+	_, err = c.client.Actions.CreateWorkflowDispatchEventByFileName(ctx, c.owner, c.repo, c.workflow, github.CreateWorkflowDispatchEventRequest{
+		Ref: "image-shipper-permission-check-" + requestID,
+	})
+
+	var errResp *github.ErrorResponse
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &errResp) && errResp.Response.StatusCode == http.StatusUnprocessableEntity:
+		// 通过了权限检查，只是分支不存在
+		return nil
+	case missingPermission(err) != "":
+		return fmt.Errorf("%s is missing the %s permission on %s/%s", c.credentialName(), missingPermission(err), c.owner, c.repo)
+	case errors.As(err, &errResp) && errResp.Response.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("%s is missing the actions:write permission on %s/%s: %w", c.credentialName(), c.owner, c.repo, err)
+	default:
+		return fmt.Errorf("failed to check GitHub permissions: %w", err)
+	}
+}
+
+// missingPermission 从403响应中读取接口要求的权限，如 actions:write，没有时返回空
+func missingPermission(err error) string {
+	var errResp *github.ErrorResponse
+	if !errors.As(err, &errResp) || errResp.Response == nil || errResp.Response.StatusCode != http.StatusForbidden {
+		return ""
+	}
+	// 格式为 "actions=write"，同一组内的多个权限以逗号分隔，多组可选权限以分号分隔
+	accepted := errResp.Response.Header.Get("X-Accepted-GitHub-Permissions")
+	if accepted == "" {
+		return ""
+	}
+	var sets []string
+	for _, set := range strings.Split(accepted, ";") {
+		var permissions []string
+		for _, permission := range strings.Split(set, ",") {
+			if permission = strings.TrimSpace(permission); permission != "" {
+				permissions = append(permissions, strings.Replace(permission, "=", ":", 1))
+			}
+		}
+		if len(permissions) > 0 {
+			sets = append(sets, strings.Join(permissions, " and "))
+		}
+	}
+	return strings.Join(sets, " or ")
+}
+
+// credentialName 返回错误信息中使用的凭据名称
+func (c *Client) credentialName() string {
+	switch {
+	case c.installation != nil || c.tokenKind == tokenApp:
+		return "GitHub App installation"
+	case c.tokenKind == tokenFineGrained:
+		return "fine-grained token"
+	default:
+		return "token"
+	}
+}
@@ -0,0 +1,98 @@
+package github
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/keevingness/image-shipper/internal/types"
+)
+
+// resultsFile 结果制品中记录每个镜像结果的文件，每行一个JSON对象
+const resultsFile = "results.jsonl"
+
+// downloadResults 下载结果制品压缩包并解析其中的结果文件
+// 下载地址是预签名的临时地址，不能携带GitHub令牌访问。
+func (c *Client) downloadResults(url string) ([]types.ImageResult, error) {
+	archive, err := c.downloadArchive(url, "results artifact")
+	if err != nil {
+		return nil, err
+	}
+	return readResults(archive)
+}
+
+// ParseResultsArchive 解析结果制品的zip压缩包，Gitea等兼容GitHub Actions的服务下载的制品格式相同
+func ParseResultsArchive(data []byte) ([]types.ImageResult, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open results artifact: %w", err)
+	}
+	return readResults(archive)
+}
+
+// readResults 读取结果制品中的结果文件
+func readResults(archive *zip.Reader) ([]types.ImageResult, error) {
+	for _, file := range archive.File {
+		if file.Name != resultsFile {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", resultsFile, err)
+		}
+		defer rc.Close()
+		return ParseResults(rc)
+	}
+
+	return nil, fmt.Errorf("%s not found in results artifact", resultsFile)
+}
+
+// downloadArchive 从预签名地址下载zip压缩包，what用于错误信息
+func (c *Client) downloadArchive(url, what string) (*zip.Reader, error) {
+	resp, err := c.httpClient.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", what, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: unexpected status %s", what, resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", what, err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", what, err)
+	}
+	return archive, nil
+}
+
+// ParseResults 解析JSON Lines格式的结果文件，每行是一个镜像的转存结果
+// 其他后端运行的流水线写出的结果文件格式相同。
+func ParseResults(r io.Reader) ([]types.ImageResult, error) {
+	var results []types.ImageResult
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var result types.ImageResult
+		if err := json.Unmarshal(line, &result); err != nil {
+			return nil, fmt.Errorf("invalid result line %q: %w", line, err)
+		}
+		results = append(results, result)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", resultsFile, err)
+	}
+	return results, nil
+}
@@ -0,0 +1,305 @@
+package shipper
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/keevingness/image-shipper/internal/config"
+	"github.com/keevingness/image-shipper/internal/github"
+	"github.com/keevingness/image-shipper/internal/types"
+)
+
+const (
+	// giteaPageSize 查找运行记录时每页的数量
+	giteaPageSize = 50
+	// giteaLookupSkew 按创建时间停止查找运行记录时允许的时钟偏差
+	giteaLookupSkew = 2 * time.Minute
+)
+
+// Gitea 通过Gitea或Forgejo Actions工作流转存
+// 两者的Actions兼容GitHub Actions，使用与GitHub相同的工作流文件和输入，运行记录同样按运行名称中的请求ID定位。
+type Gitea struct {
+	api      *restClient
+	logger   *zap.Logger
+	repoPath string
+	workflow string
+	ref      string
+
+	mu   sync.Mutex
+	runs map[string]int64
+}
+
+// giteaRun Gitea API返回的工作流运行
+// Gitea与Forgejo的字段名不完全相同，两者都解码，使用有值的一个。
+type giteaRun struct {
+	ID         int64  `json:"id"`
+	Status     string `json:"status"`
+	Conclusion string `json:"conclusion"`
+	HTMLURL    string `json:"html_url"`
+	// DisplayTitle 和 CreatedAt 为Gitea的字段
+	DisplayTitle string    `json:"display_title"`
+	CreatedAt    time.Time `json:"created_at"`
+	// Title 和 Created 为Forgejo的字段
+	Title   string    `json:"title"`
+	Created time.Time `json:"created"`
+}
+
+// giteaJob Gitea API返回的运行任务
+type giteaJob struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// NewGitea 创建Gitea/Forgejo Actions后端
+func NewGitea(cfg config.GiteaConfig, logger *zap.Logger) (*Gitea, error) {
+	api, err := newRESTClient(strings.TrimSuffix(cfg.URL, "/")+"/api/v1", cfg.Proxy, cfg.CACert)
+	if err != nil {
+		return nil, err
+	}
+	api.authHeader, api.authValue = "Authorization", "token "+cfg.Token
+
+	return &Gitea{
+		api:      api,
+		logger:   logger,
+		repoPath: "/repos/" + url.PathEscape(cfg.Owner) + "/" + url.PathEscape(cfg.Repo),
+		workflow: cfg.Workflow,
+		ref:      cfg.Ref,
+		runs:     map[string]int64{},
+	}, nil
+}
+
+// Submit 触发转存工作流
+// Forgejo可以在触发时直接返回运行ID；Gitea不返回，之后按请求ID在运行列表中查找。
+func (g *Gitea) Submit(ctx context.Context, images []string, target *types.Target, platforms []string) (*types.MirrorRequest, error) {
+	requestID, err := github.NewRequestID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate request id: %w", err)
+	}
+	inputs, err := github.WorkflowInputs(requestID, images, target, platforms)
+	if err != nil {
+		return nil, err
+	}
+
+	body := struct {
+		Ref           string                 `json:"ref"`
+		Inputs        map[string]interface{} `json:"inputs"`
+		ReturnRunInfo bool                   `json:"return_run_info"`
+	}{Ref: g.ref, Inputs: inputs, ReturnRunInfo: true}
+
+	createdAt := time.Now()
+	var run struct {
+		ID int64 `json:"id"`
+	}
+	path := "/actions/workflows/" + url.PathEscape(g.workflow) + "/dispatches"
+	if err := g.call(ctx, http.MethodPost, path, body, &run); err != nil {
+		g.logger.Error("Failed to trigger Gitea workflow", zap.Error(err))
+		return nil, fmt.Errorf("failed to trigger workflow: %w", err)
+	}
+	if run.ID != 0 {
+		g.mu.Lock()
+		g.runs[requestID] = run.ID
+		g.mu.Unlock()
+	}
+
+	request := &types.MirrorRequest{
+		ID:        requestID,
+		Status:    "pending",
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt,
+	}
+	if target != nil {
+		request.TargetRegistry = target.Registry
+	}
+	if len(images) == 1 {
+		request.SourceImage = images[0]
+	} else {
+		request.SourceImages = images
+	}
+
+	g.logger.Info("Successfully triggered Gitea workflow",
+		zap.String("request_id", request.ID),
+		zap.Int("images", len(images)))
+
+	return request, nil
+}
+
+// Status 查询工作流运行状态，并映射为GitHub工作流的状态和结论
+func (g *Gitea) Status(ctx context.Context, request *types.MirrorRequest) (*types.GitHubWorkflowResponse, error) {
+	runID, err := g.findRun(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	if runID == 0 {
+		return &types.GitHubWorkflowResponse{Status: types.WorkflowStatusNotVisible}, nil
+	}
+
+	var run giteaRun
+	if err := g.call(ctx, http.MethodGet, fmt.Sprintf("/actions/runs/%d", runID), nil, &run); err != nil {
+		return nil, fmt.Errorf("failed to get workflow run %d: %w", runID, err)
+	}
+
+	status, conclusion := giteaStatus(run.Status, run.Conclusion)
+	return &types.GitHubWorkflowResponse{
+		WorkflowID: run.ID,
+		Status:     status,
+		Conclusion: conclusion,
+		URL:        run.HTMLURL,
+	}, nil
+}
+
+// Results 下载运行上传的结果制品
+func (g *Gitea) Results(ctx context.Context, request *types.MirrorRequest) ([]types.ImageResult, error) {
+	runID, err := g.visibleRun(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	var list struct {
+		Artifacts []struct {
+			ID   int64  `json:"id"`
+			Name string `json:"name"`
+		} `json:"artifacts"`
+	}
+	if err := g.call(ctx, http.MethodGet, fmt.Sprintf("/actions/runs/%d/artifacts", runID), nil, &list); err != nil {
+		return nil, fmt.Errorf("failed to list workflow artifacts: %w", err)
+	}
+
+	for _, artifact := range list.Artifacts {
+		if artifact.Name != github.ResultsArtifact {
+			continue
+		}
+		var data []byte
+		if err := g.call(ctx, http.MethodGet, fmt.Sprintf("/actions/artifacts/%d/zip", artifact.ID), nil, &data); err != nil {
+			return nil, fmt.Errorf("failed to download results artifact: %w", err)
+		}
+		return github.ParseResultsArchive(data)
+	}
+	return nil, fmt.Errorf("results artifact %q not found in workflow run %d", github.ResultsArtifact, runID)
+}
+
+// Cancel Gitea和Forgejo的API不提供取消运行的接口，只能在运行页面上手动取消
+func (g *Gitea) Cancel(ctx context.Context, request *types.MirrorRequest) error {
+	status, err := g.Status(ctx, request)
+	if err != nil {
+		return err
+	}
+	if status.Status == types.WorkflowStatusCompleted {
+		return nil
+	}
+	return fmt.Errorf("cancelling workflow runs is not supported by the Gitea API, cancel it at %s", cmp.Or(status.URL, "the Actions page"))
+}
+
+// Logs 按顺序拼接运行中每个任务的日志
+func (g *Gitea) Logs(ctx context.Context, request *types.MirrorRequest) (string, error) {
+	runID, err := g.visibleRun(ctx, request)
+	if err != nil {
+		return "", err
+	}
+
+	var list struct {
+		Jobs []giteaJob `json:"jobs"`
+	}
+	if err := g.call(ctx, http.MethodGet, fmt.Sprintf("/actions/runs/%d/jobs", runID), nil, &list); err != nil {
+		return "", fmt.Errorf("failed to list jobs of workflow run %d: %w", runID, err)
+	}
+	slices.SortFunc(list.Jobs, func(a, b giteaJob) int { return cmp.Compare(a.ID, b.ID) })
+
+	var sb strings.Builder
+	for _, job := range list.Jobs {
+		var log []byte
+		if err := g.call(ctx, http.MethodGet, fmt.Sprintf("/actions/jobs/%d/logs", job.ID), nil, &log); err != nil {
+			return "", fmt.Errorf("failed to get log of job %d: %w", job.ID, err)
+		}
+		fmt.Fprintf(&sb, "==> %s <==\n", job.Name)
+		sb.Write(log)
+	}
+	return sb.String(), nil
+}
+
+// visibleRun 返回请求对应的运行ID，运行记录尚未出现时返回错误
+func (g *Gitea) visibleRun(ctx context.Context, request *types.MirrorRequest) (int64, error) {
+	runID, err := g.findRun(ctx, request)
+	if err != nil {
+		return 0, err
+	}
+	if runID == 0 {
+		return 0, fmt.Errorf("workflow run for request %s is not visible yet", request.ID)
+	}
+	return runID, nil
+}
+
+// findRun 根据请求ID查找对应的工作流运行，尚未出现时返回0
+// 运行列表按创建时间倒序返回，查到早于请求创建时间的运行时停止。
+func (g *Gitea) findRun(ctx context.Context, request *types.MirrorRequest) (int64, error) {
+	g.mu.Lock()
+	runID, ok := g.runs[request.ID]
+	g.mu.Unlock()
+	if ok {
+		return runID, nil
+	}
+
+	since := request.CreatedAt.Add(-giteaLookupSkew)
+	for page := 1; ; page++ {
+		var list struct {
+			WorkflowRuns []giteaRun `json:"workflow_runs"`
+		}
+		path := fmt.Sprintf("/actions/runs?event=workflow_dispatch&page=%d&limit=%d", page, giteaPageSize)
+		if err := g.call(ctx, http.MethodGet, path, nil, &list); err != nil {
+			g.logger.Error("Failed to list Gitea workflow runs", zap.Error(err))
+			return 0, fmt.Errorf("failed to list workflow runs: %w", err)
+		}
+
+		for _, run := range list.WorkflowRuns {
+			if strings.Contains(cmp.Or(run.DisplayTitle, run.Title), request.ID) {
+				g.mu.Lock()
+				g.runs[request.ID] = run.ID
+				g.mu.Unlock()
+				return run.ID, nil
+			}
+			created := run.CreatedAt
+			if created.IsZero() {
+				created = run.Created
+			}
+			if !created.IsZero() && created.Before(since) {
+				return 0, nil
+			}
+		}
+
+		if len(list.WorkflowRuns) < giteaPageSize {
+			return 0, nil
+		}
+	}
+}
+
+// call 调用仓库下的API
+func (g *Gitea) call(ctx context.Context, method, path string, in, out interface{}) error {
+	return g.api.call(ctx, method, g.repoPath+path, in, out)
+}
+
+// giteaStatus 将工作流运行状态映射为GitHub工作流的状态和结论
+// Gitea返回与GitHub相同的状态和结论；Forgejo只返回一个状态，结束时即为结论。
+func giteaStatus(status, conclusion string) (string, string) {
+	switch status {
+	case types.WorkflowStatusCompleted:
+		return types.WorkflowStatusCompleted, cmp.Or(conclusion, "unknown")
+	case "success", "failure", "cancelled", "skipped":
+		return types.WorkflowStatusCompleted, status
+	case "in_progress", "running":
+		return "in_progress", "unknown"
+	case "blocked":
+		// 等待并发限制或审批
+		return "waiting", "unknown"
+	default:
+		// queued、waiting、unknown
+		return "queued", "unknown"
+	}
+}
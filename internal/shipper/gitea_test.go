@@ -0,0 +1,376 @@
+package shipper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/keevingness/image-shipper/internal/config"
+	"github.com/keevingness/image-shipper/internal/types"
+)
+
+const fakeGiteaRunID = 17
+
+// fakeGitea 进程内的Gitea/Forgejo API，只实现Gitea后端用到的接口
+// forgejo为true时按Forgejo的方式在触发时返回运行ID，运行记录使用Forgejo的字段名和单一状态。
+type fakeGitea struct {
+	t       *testing.T
+	server  *httptest.Server
+	forgejo bool
+
+	mu       sync.Mutex
+	ref      string
+	inputs   map[string]interface{}
+	runTitle string
+	// hidden 为true时运行列表中只有早于请求的运行
+	hidden     bool
+	pages      []string
+	status     string
+	conclusion string
+}
+
+// newFakeGitea 启动进程内的Gitea API，测试结束时关闭
+func newFakeGitea(t *testing.T, forgejo bool) *fakeGitea {
+	t.Helper()
+	f := &fakeGitea{t: t, forgejo: forgejo, status: "waiting"}
+
+	repo := "/api/v1/repos/owner/image-shipper/actions"
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+repo+"/workflows/image-shipper.yaml/dispatches", f.dispatch)
+	mux.HandleFunc("GET "+repo+"/runs", f.listRuns)
+	mux.HandleFunc(fmt.Sprintf("GET %s/runs/%d", repo, fakeGiteaRunID), func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		json.NewEncoder(w).Encode(f.run(time.Now()))
+	})
+	mux.HandleFunc(fmt.Sprintf("GET %s/runs/%d/artifacts", repo, fakeGiteaRunID), func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"total_count":2,"artifacts":[{"id":3,"name":"build-logs"},{"id":4,"name":"image-shipper-results"}]}`)
+	})
+	results := zipFiles(t, "results.jsonl", testResults)
+	mux.HandleFunc("GET "+repo+"/artifacts/4/zip", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(results)
+	})
+	mux.HandleFunc(fmt.Sprintf("GET %s/runs/%d/jobs", repo, fakeGiteaRunID), func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"total_count":2,"jobs":[{"id":32,"name":"report"},{"id":31,"name":"mirror"}]}`)
+	})
+	mux.HandleFunc("GET "+repo+"/jobs/31/logs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "copying nginx:1.25\n")
+	})
+	mux.HandleFunc("GET "+repo+"/jobs/32/logs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "writing summary\n")
+	})
+
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token gitea-token" {
+			http.Error(w, `{"message":"token is required"}`, http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+// backend 创建连接到该服务的Gitea后端
+func (f *fakeGitea) backend(t *testing.T) Shipper {
+	t.Helper()
+	cfg := &config.Config{
+		Ship: config.ShipConfig{Backend: config.ShipBackendGitea},
+		Gitea: config.GiteaConfig{
+			URL:      f.server.URL + "/",
+			Token:    "gitea-token",
+			Owner:    "owner",
+			Repo:     "image-shipper",
+			Workflow: "image-shipper.yaml",
+			Ref:      "main",
+		},
+	}
+	backend, err := New(cfg, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return backend
+}
+
+// setStatus 修改运行状态，Forgejo只使用status
+func (f *fakeGitea) setStatus(status, conclusion string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.status, f.conclusion = status, conclusion
+}
+
+// run 返回当前的运行记录，字段名取决于服务类型
+func (f *fakeGitea) run(created time.Time) map[string]interface{} {
+	run := map[string]interface{}{
+		"id":       fakeGiteaRunID,
+		"status":   f.status,
+		"html_url": "https://gitea.example.com/owner/image-shipper/actions/runs/17",
+	}
+	if f.forgejo {
+		run["title"], run["created"] = f.runTitle, created
+	} else {
+		run["display_title"], run["created_at"] = f.runTitle, created
+		run["conclusion"] = f.conclusion
+	}
+	return run
+}
+
+// dispatch 记录工作流输入，Forgejo在请求return_run_info时返回运行ID
+func (f *fakeGitea) dispatch(w http.ResponseWriter, r *http.Request) {
+	var event struct {
+		Ref           string                 `json:"ref"`
+		Inputs        map[string]interface{} `json:"inputs"`
+		ReturnRunInfo bool                   `json:"return_run_info"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ref, f.inputs = event.Ref, event.Inputs
+	f.runTitle = fmt.Sprintf("Mirror images (%v)", event.Inputs["request_id"])
+	if f.forgejo && event.ReturnRunInfo {
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"id":%d,"workflow_id":"image-shipper.yaml"}`, fakeGiteaRunID)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listRuns 按创建时间倒序分页返回运行记录，第一页全是其他请求的运行
+func (f *fakeGitea) listRuns(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("event") != "workflow_dispatch" || query.Get("limit") != fmt.Sprint(giteaPageSize) {
+		f.t.Errorf("unexpected run list query %s", r.URL.RawQuery)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pages = append(f.pages, query.Get("page"))
+
+	var runs []map[string]interface{}
+	switch {
+	case f.hidden:
+		runs = append(runs, map[string]interface{}{"id": 1, "display_title": "Mirror images (old)", "created_at": time.Now().Add(-time.Hour)})
+	case query.Get("page") == "1":
+		for i := range giteaPageSize {
+			runs = append(runs, map[string]interface{}{"id": 100 + i, "display_title": fmt.Sprintf("Mirror images (other-%d)", i), "created_at": time.Now()})
+		}
+	default:
+		runs = append(runs, f.run(time.Now()))
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"total_count": len(runs), "workflow_runs": runs})
+}
+
+// listedPages 返回查询过的运行列表页码
+func (f *fakeGitea) listedPages() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.pages)
+}
+
+func TestGiteaBackend(t *testing.T) {
+	f := newFakeGitea(t, false)
+	backend := f.backend(t)
+	ctx := context.Background()
+
+	target := &types.Target{Type: "harbor", Registry: "harbor.example.com", Namespace: "mirror", Credentials: "HARBOR"}
+	request, err := backend.Submit(ctx, []string{"nginx:1.25", "redis:7"}, target, []string{"linux/arm64"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(request.SourceImages, []string{"nginx:1.25", "redis:7"}) || request.TargetRegistry != "harbor.example.com" || request.ID == "" {
+		t.Errorf("Submit() = %+v", request)
+	}
+	wantInputs := map[string]interface{}{
+		"request_id":         request.ID,
+		"docker_image":       "",
+		"docker_images":      `["nginx:1.25","redis:7"]`,
+		"target_type":        "harbor",
+		"target_registry":    "harbor.example.com",
+		"target_namespace":   "mirror",
+		"target_credentials": "HARBOR",
+		"platforms":          "linux/arm64",
+	}
+	f.mu.Lock()
+	if f.ref != "main" || fmt.Sprint(f.inputs) != fmt.Sprint(wantInputs) {
+		t.Errorf("dispatched ref %q inputs %v, want main %v", f.ref, f.inputs, wantInputs)
+	}
+	f.mu.Unlock()
+
+	// Gitea触发时不返回运行ID，翻页找到运行名称中带有请求ID的运行
+	status, err := backend.Status(ctx, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.WorkflowID != fakeGiteaRunID || status.Status != "queued" || status.Conclusion != "unknown" {
+		t.Errorf("Status() = %+v, want queued run %d", status, fakeGiteaRunID)
+	}
+	if pages := f.listedPages(); !slices.Equal(pages, []string{"1", "2"}) {
+		t.Errorf("listed run pages %q, want [1 2]", pages)
+	}
+
+	// 已找到的运行ID会被记住，不再查询运行列表
+	if err := backend.Cancel(ctx, request); err == nil || !strings.Contains(err.Error(), "https://gitea.example.com/owner/image-shipper/actions/runs/17") {
+		t.Errorf("Cancel() of a queued run error = %v, want the run url", err)
+	}
+	if pages := f.listedPages(); len(pages) != 2 {
+		t.Errorf("listed run pages %q after the run was found", pages)
+	}
+
+	f.setStatus(types.WorkflowStatusCompleted, "failure")
+	status, err = backend.Status(ctx, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Status != types.WorkflowStatusCompleted || status.Conclusion != "failure" || !strings.HasSuffix(status.URL, "/runs/17") {
+		t.Errorf("Status() = %+v, want completed failure", status)
+	}
+
+	results, err := backend.Results(ctx, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.EqualFunc(results, wantResults, func(a, b types.ImageResult) bool { return fmt.Sprint(a) == fmt.Sprint(b) }) {
+		t.Errorf("Results() = %+v, want %+v", results, wantResults)
+	}
+
+	logs, err := backend.Logs(ctx, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "==> mirror <==\ncopying nginx:1.25\n==> report <==\nwriting summary\n"; logs != want {
+		t.Errorf("Logs() = %q, want %q", logs, want)
+	}
+
+	// 已结束的运行无需取消
+	if err := backend.Cancel(ctx, request); err != nil {
+		t.Errorf("Cancel() of a completed run error = %v", err)
+	}
+}
+
+func TestGiteaBackendForgejo(t *testing.T) {
+	f := newFakeGitea(t, true)
+	backend := f.backend(t)
+	ctx := context.Background()
+
+	request, err := backend.Submit(ctx, []string{"nginx:1.25"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.SourceImage != "nginx:1.25" {
+		t.Errorf("Submit() = %+v", request)
+	}
+
+	f.setStatus("running", "")
+	status, err := backend.Status(ctx, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.WorkflowID != fakeGiteaRunID || status.Status != "in_progress" {
+		t.Errorf("Status() = %+v, want in_progress run %d", status, fakeGiteaRunID)
+	}
+
+	// Forgejo只返回一个状态，结束时即为结论
+	f.setStatus("success", "")
+	status, err = backend.Status(ctx, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Status != types.WorkflowStatusCompleted || status.Conclusion != "success" {
+		t.Errorf("Status() = %+v, want completed success", status)
+	}
+
+	if _, err := backend.Results(ctx, request); err != nil {
+		t.Fatal(err)
+	}
+	// 触发时已返回运行ID，不需要查询运行列表
+	if pages := f.listedPages(); len(pages) != 0 {
+		t.Errorf("listed run pages %q, want none", pages)
+	}
+}
+
+func TestGiteaBackendNotVisible(t *testing.T) {
+	f := newFakeGitea(t, false)
+	f.hidden = true
+	backend := f.backend(t)
+	ctx := context.Background()
+
+	request, err := backend.Submit(ctx, []string{"nginx"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := backend.Status(ctx, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Status != types.WorkflowStatusNotVisible {
+		t.Errorf("Status() = %+v, want not_visible", status)
+	}
+	// 遇到早于请求的运行后停止翻页
+	if pages := f.listedPages(); !slices.Equal(pages, []string{"1"}) {
+		t.Errorf("listed run pages %q, want [1]", pages)
+	}
+	if _, err := backend.Results(ctx, request); err == nil || !strings.Contains(err.Error(), "not visible yet") {
+		t.Errorf("Results() error = %v, want not visible", err)
+	}
+	if _, err := backend.Logs(ctx, request); err == nil || !strings.Contains(err.Error(), "not visible yet") {
+		t.Errorf("Logs() error = %v, want not visible", err)
+	}
+	if err := backend.Cancel(ctx, request); err == nil || !strings.Contains(err.Error(), "the Actions page") {
+		t.Errorf("Cancel() error = %v, want a pointer to the Actions page", err)
+	}
+}
+
+func TestGiteaBackendUnauthorized(t *testing.T) {
+	f := newFakeGitea(t, false)
+	cfg := &config.Config{
+		Ship:  config.ShipConfig{Backend: config.ShipBackendGitea},
+		Gitea: config.GiteaConfig{URL: f.server.URL, Token: "wrong", Owner: "owner", Repo: "image-shipper", Workflow: "image-shipper.yaml", Ref: "main"},
+	}
+	backend, err := New(cfg, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backend.Submit(context.Background(), []string{"nginx"}, nil, nil); err == nil || err.Error() != "failed to trigger workflow: 401 Unauthorized: token is required" {
+		t.Errorf("Submit() with a wrong token error = %v", err)
+	}
+}
+
+func TestGiteaStatus(t *testing.T) {
+	tests := []struct {
+		status, conclusion string
+		want, wantConc     string
+	}{
+		// Gitea
+		{"queued", "", "queued", "unknown"},
+		{"waiting", "", "queued", "unknown"},
+		{"in_progress", "", "in_progress", "unknown"},
+		{"completed", "success", types.WorkflowStatusCompleted, "success"},
+		{"completed", "failure", types.WorkflowStatusCompleted, "failure"},
+		{"completed", "", types.WorkflowStatusCompleted, "unknown"},
+		// Forgejo
+		{"unknown", "", "queued", "unknown"},
+		{"blocked", "", "waiting", "unknown"},
+		{"running", "", "in_progress", "unknown"},
+		{"success", "", types.WorkflowStatusCompleted, "success"},
+		{"failure", "", types.WorkflowStatusCompleted, "failure"},
+		{"cancelled", "", types.WorkflowStatusCompleted, "cancelled"},
+		{"skipped", "", types.WorkflowStatusCompleted, "skipped"},
+	}
+	for _, tt := range tests {
+		status, conclusion := giteaStatus(tt.status, tt.conclusion)
+		if status != tt.want || conclusion != tt.wantConc {
+			t.Errorf("giteaStatus(%q, %q) = %q, %q, want %q, %q", tt.status, tt.conclusion, status, conclusion, tt.want, tt.wantConc)
+		}
+	}
+}
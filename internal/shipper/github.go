@@ -0,0 +1,46 @@
+package shipper
+
+import (
+	"context"
+
+	"github.com/keevingness/image-shipper/internal/github"
+	"github.com/keevingness/image-shipper/internal/types"
+)
+
+// GitHub 通过GitHub Actions工作流转存
+type GitHub struct {
+	client *github.Client
+}
+
+// NewGitHub 创建GitHub Actions后端
+func NewGitHub(client *github.Client) *GitHub {
+	return &GitHub{client: client}
+}
+
+// Submit 触发转存工作流，多个镜像通过docker_images输入在同一次运行中转存
+func (g *GitHub) Submit(_ context.Context, images []string, target *types.Target, platforms []string) (*types.MirrorRequest, error) {
+	if len(images) == 1 {
+		return g.client.TriggerMirrorWorkflow(images[0], target, platforms)
+	}
+	return g.client.TriggerBatchMirrorWorkflow(images, target, platforms)
+}
+
+// Status 查询工作流运行状态
+func (g *GitHub) Status(_ context.Context, request *types.MirrorRequest) (*types.GitHubWorkflowResponse, error) {
+	return g.client.GetWorkflowStatus(request)
+}
+
+// Results 读取运行上传的结果制品
+func (g *GitHub) Results(_ context.Context, request *types.MirrorRequest) ([]types.ImageResult, error) {
+	return g.client.GetWorkflowResults(request)
+}
+
+// Cancel 取消工作流运行
+func (g *GitHub) Cancel(_ context.Context, request *types.MirrorRequest) error {
+	return g.client.CancelWorkflow(request)
+}
+
+// Logs 下载工作流运行日志
+func (g *GitHub) Logs(_ context.Context, request *types.MirrorRequest) (string, error) {
+	return g.client.GetWorkflowLogs(request)
+}
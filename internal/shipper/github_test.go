@@ -0,0 +1,336 @@
+package shipper
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/keevingness/image-shipper/internal/config"
+	"github.com/keevingness/image-shipper/internal/types"
+)
+
+// testResults 结果文件的内容，每行一个镜像
+const testResults = `{"image":"nginx:1.25","target":"registry.example.com/mirror/nginx:1.25","digest":"sha256:aaaa","status":"success"}
+
+{"image":"redis:7","target":"registry.example.com/mirror/redis:7","status":"failed","error":"manifest unknown"}
+`
+
+// wantResults testResults解析后的结果
+var wantResults = []types.ImageResult{
+	{Image: "nginx:1.25", Target: "registry.example.com/mirror/nginx:1.25", Digest: "sha256:aaaa", Status: "success"},
+	{Image: "redis:7", Target: "registry.example.com/mirror/redis:7", Status: "failed", Error: "manifest unknown"},
+}
+
+// zipFiles 按顺序将文件写入zip压缩包，files为文件名和内容交替排列
+func zipFiles(t *testing.T, files ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for i := 0; i+1 < len(files); i += 2 {
+		w, err := zw.Create(files[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(files[i+1]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// fakeGitHub 进程内的GitHub Enterprise Server API，只实现GitHub后端用到的接口
+// 触发工作流后生成一条运行记录，运行名称中带有请求ID；hidden次列表查询之后运行才会出现。
+type fakeGitHub struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu         sync.Mutex
+	inputs     map[string]interface{}
+	ref        string
+	hidden     int
+	runTitle   string
+	status     string
+	conclusion string
+	cancelled  bool
+}
+
+const fakeGitHubRunID = 4242
+
+// newFakeGitHub 启动进程内的GitHub API，测试结束时关闭
+func newFakeGitHub(t *testing.T) *fakeGitHub {
+	t.Helper()
+	f := &fakeGitHub{t: t, status: "queued"}
+
+	repo := "/api/v3/repos/owner/image-shipper/actions"
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+repo+"/workflows/image-shipper.yaml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-OAuth-Scopes", "repo, workflow")
+		fmt.Fprint(w, `{"id":1,"path":".github/workflows/image-shipper.yaml"}`)
+	})
+	mux.HandleFunc("POST "+repo+"/workflows/image-shipper.yaml/dispatches", f.dispatch)
+	mux.HandleFunc("GET "+repo+"/workflows/image-shipper.yaml/runs", f.listRuns)
+	mux.HandleFunc(fmt.Sprintf("GET %s/runs/%d", repo, fakeGitHubRunID), func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		run := map[string]interface{}{
+			"id":       fakeGitHubRunID,
+			"status":   f.status,
+			"html_url": "https://github.example.com/owner/image-shipper/actions/runs/4242",
+		}
+		if f.conclusion != "" {
+			run["conclusion"] = f.conclusion
+		}
+		json.NewEncoder(w).Encode(run)
+	})
+	mux.HandleFunc(fmt.Sprintf("POST %s/runs/%d/cancel", repo, fakeGitHubRunID), func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.cancelled = true
+		f.mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprint(w, `{}`)
+	})
+	mux.HandleFunc(fmt.Sprintf("GET %s/runs/%d/artifacts", repo, fakeGitHubRunID), func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"total_count":2,"artifacts":[{"id":7,"name":"build-logs"},{"id":8,"name":"image-shipper-results"}]}`)
+	})
+	// 制品和日志的下载接口重定向到预签名地址
+	mux.HandleFunc("GET "+repo+"/artifacts/8/zip", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, f.server.URL+"/presigned/results.zip", http.StatusFound)
+	})
+	mux.HandleFunc(fmt.Sprintf("GET %s/runs/%d/logs", repo, fakeGitHubRunID), func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, f.server.URL+"/presigned/logs.zip", http.StatusFound)
+	})
+	mux.HandleFunc("GET /presigned/results.zip", f.presigned(zipFiles(t, "results.jsonl", testResults)))
+	mux.HandleFunc("GET /presigned/logs.zip", f.presigned(zipFiles(t,
+		"1_mirror.txt", "copying nginx:1.25\n",
+		"mirror/1_Set up job.txt", "duplicated step log\n",
+		"0_prepare.txt", "preparing\n",
+	)))
+
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/") && r.Header.Get("Authorization") != "Bearer ghp_testtoken" {
+			http.Error(w, `{"message":"Bad credentials"}`, http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+// dispatched 返回最近一次触发工作流的分支和输入
+func (f *fakeGitHub) dispatched() (string, map[string]interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.ref, f.inputs
+}
+
+// backend 创建连接到该服务的GitHub后端
+func (f *fakeGitHub) backend() (Shipper, error) {
+	cfg := &config.Config{
+		Ship: config.ShipConfig{Backend: config.ShipBackendGitHub},
+		GitHub: config.GitHubConfig{
+			Token:    "ghp_testtoken",
+			Owner:    "owner",
+			Repo:     "image-shipper",
+			Workflow: "image-shipper.yaml",
+			Ref:      "main",
+			APIURL:   f.server.URL,
+		},
+	}
+	return New(cfg, zap.NewNop())
+}
+
+// dispatch 记录工作流输入并生成运行记录
+func (f *fakeGitHub) dispatch(w http.ResponseWriter, r *http.Request) {
+	var event struct {
+		Ref    string                 `json:"ref"`
+		Inputs map[string]interface{} `json:"inputs"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	f.ref, f.inputs = event.Ref, event.Inputs
+	f.runTitle = fmt.Sprintf("Mirror images (%v)", event.Inputs["request_id"])
+	f.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listRuns 分两页返回运行记录，第一页只有其他请求的运行
+func (f *fakeGitHub) listRuns(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("event") != "workflow_dispatch" || !strings.HasPrefix(r.URL.Query().Get("created"), ">=") {
+		f.t.Errorf("unexpected run list query %s", r.URL.RawQuery)
+	}
+	if r.URL.Query().Get("page") != "2" {
+		w.Header().Set("Link", fmt.Sprintf(`<%s%s?page=2>; rel="next"`, f.server.URL, r.URL.Path))
+		fmt.Fprint(w, `{"total_count":2,"workflow_runs":[{"id":1,"display_title":"Mirror images (other-request)"}]}`)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.runTitle == "" || f.hidden > 0 {
+		f.hidden--
+		fmt.Fprint(w, `{"total_count":1,"workflow_runs":[]}`)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"total_count":   2,
+		"workflow_runs": []map[string]interface{}{{"id": fakeGitHubRunID, "display_title": f.runTitle}},
+	})
+}
+
+// presigned 返回预签名地址的内容，预签名地址不应携带GitHub令牌
+func (f *fakeGitHub) presigned(data []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			f.t.Errorf("token sent to presigned url %s", r.URL.Path)
+		}
+		w.Write(data)
+	}
+}
+
+func TestGitHubBackend(t *testing.T) {
+	f := newFakeGitHub(t)
+	f.hidden = 1
+	backend, err := f.backend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	target := &types.Target{Type: "harbor", Registry: "harbor.example.com", Namespace: "mirror", Credentials: "HARBOR"}
+	request, err := backend.Submit(ctx, []string{"nginx:1.25"}, target, []string{"linux/amd64", "linux/arm64"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.SourceImage != "nginx:1.25" || request.TargetRegistry != "harbor.example.com" || request.ID == "" {
+		t.Errorf("Submit() = %+v", request)
+	}
+	wantInputs := map[string]interface{}{
+		"request_id":         request.ID,
+		"docker_image":       "nginx:1.25",
+		"target_type":        "harbor",
+		"target_registry":    "harbor.example.com",
+		"target_namespace":   "mirror",
+		"target_credentials": "HARBOR",
+		"platforms":          "linux/amd64,linux/arm64",
+	}
+	if ref, inputs := f.dispatched(); ref != "main" || fmt.Sprint(inputs) != fmt.Sprint(wantInputs) {
+		t.Errorf("dispatched ref %q inputs %v, want main %v", ref, inputs, wantInputs)
+	}
+
+	// 运行记录出现之前
+	status, err := backend.Status(ctx, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Status != types.WorkflowStatusNotVisible {
+		t.Errorf("Status() before the run is listed = %+v, want not_visible", status)
+	}
+
+	status, err = backend.Status(ctx, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.WorkflowID != fakeGitHubRunID || status.Status != "queued" || status.Conclusion != "unknown" {
+		t.Errorf("Status() = %+v, want queued run %d", status, fakeGitHubRunID)
+	}
+
+	f.mu.Lock()
+	f.status, f.conclusion = types.WorkflowStatusCompleted, "failure"
+	f.mu.Unlock()
+	status, err = backend.Status(ctx, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Status != types.WorkflowStatusCompleted || status.Conclusion != "failure" || !strings.HasSuffix(status.URL, "/runs/4242") {
+		t.Errorf("Status() = %+v, want completed failure", status)
+	}
+
+	results, err := backend.Results(ctx, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.EqualFunc(results, wantResults, func(a, b types.ImageResult) bool { return fmt.Sprint(a) == fmt.Sprint(b) }) {
+		t.Errorf("Results() = %+v, want %+v", results, wantResults)
+	}
+
+	logs, err := backend.Logs(ctx, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "==> 0_prepare.txt <==\npreparing\n==> 1_mirror.txt <==\ncopying nginx:1.25\n"; logs != want {
+		t.Errorf("Logs() = %q, want %q", logs, want)
+	}
+
+	if err := backend.Cancel(ctx, request); err != nil {
+		t.Fatal(err)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.cancelled {
+		t.Error("Cancel() did not cancel the run")
+	}
+}
+
+func TestGitHubBackendBatch(t *testing.T) {
+	f := newFakeGitHub(t)
+	backend, err := f.backend()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	images := []string{"nginx:1.25", "redis:7"}
+	request, err := backend.Submit(context.Background(), images, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(request.SourceImages, images) || request.SourceImage != "" {
+		t.Errorf("Submit() = %+v, want source images %q", request, images)
+	}
+	// 多个镜像以JSON数组传递，并清空docker_image的默认值；未指定目标时不传目标输入
+	_, inputs := f.dispatched()
+	if inputs["docker_images"] != `["nginx:1.25","redis:7"]` || inputs["docker_image"] != "" {
+		t.Errorf("dispatched inputs = %v", inputs)
+	}
+	if _, ok := inputs["target_registry"]; ok {
+		t.Errorf("dispatched target inputs without a target: %v", inputs)
+	}
+}
+
+func TestGitHubBackendNotVisible(t *testing.T) {
+	f := newFakeGitHub(t)
+	f.hidden = 100
+	backend, err := f.backend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	request, err := backend.Submit(ctx, []string{"nginx"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := backend.Results(ctx, request); err == nil || !strings.Contains(err.Error(), "not visible yet") {
+		t.Errorf("Results() error = %v, want not visible", err)
+	}
+	if _, err := backend.Logs(ctx, request); err == nil || !strings.Contains(err.Error(), "not visible yet") {
+		t.Errorf("Logs() error = %v, want not visible", err)
+	}
+	if err := backend.Cancel(ctx, request); err == nil || !strings.Contains(err.Error(), "not visible yet") {
+		t.Errorf("Cancel() error = %v, want not visible", err)
+	}
+}
@@ -0,0 +1,228 @@
+package shipper
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/keevingness/image-shipper/internal/config"
+	"github.com/keevingness/image-shipper/internal/github"
+	"github.com/keevingness/image-shipper/internal/types"
+)
+
+// gitlabResultsFile 流水线作为制品保存的结果文件，格式与GitHub工作流的结果制品相同
+const gitlabResultsFile = "results.jsonl"
+
+// GitLab 通过GitLab CI流水线转存
+// 流水线由仓库中的 .gitlab-ci.yml 定义，转存参数以流水线变量传递，变量名与工作流输入对应。
+type GitLab struct {
+	api     *restClient
+	logger  *zap.Logger
+	project string
+	ref     string
+}
+
+// gitlabPipeline GitLab API返回的流水线
+type gitlabPipeline struct {
+	ID     int64  `json:"id"`
+	Status string `json:"status"`
+	WebURL string `json:"web_url"`
+}
+
+// gitlabJob GitLab API返回的流水线任务
+type gitlabJob struct {
+	ID     int64  `json:"id"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+// NewGitLab 创建GitLab CI后端
+func NewGitLab(cfg config.GitLabConfig, logger *zap.Logger) (*GitLab, error) {
+	api, err := newRESTClient(strings.TrimSuffix(cfg.URL, "/")+"/api/v4", cfg.Proxy, cfg.CACert)
+	if err != nil {
+		return nil, err
+	}
+	api.authHeader, api.authValue = "PRIVATE-TOKEN", cfg.Token
+
+	return &GitLab{
+		api:     api,
+		logger:  logger,
+		project: cfg.Project,
+		ref:     cfg.Ref,
+	}, nil
+}
+
+// Submit 创建流水线，流水线ID即为请求ID
+func (g *GitLab) Submit(ctx context.Context, images []string, target *types.Target, platforms []string) (*types.MirrorRequest, error) {
+	variables := map[string]string{}
+	if len(images) == 1 {
+		variables["DOCKER_IMAGE"] = images[0]
+	} else {
+		// 镜像地址中不会出现换行，按行传递便于流水线脚本逐行读取
+		variables["DOCKER_IMAGES"] = strings.Join(images, "\n")
+	}
+	targetRegistry := ""
+	if target != nil {
+		targetRegistry = target.Registry
+		variables["TARGET_TYPE"] = target.Type
+		variables["TARGET_REGISTRY"] = target.Registry
+		variables["TARGET_NAMESPACE"] = target.Namespace
+		variables["TARGET_CREDENTIALS"] = target.Credentials
+	}
+	if len(platforms) > 0 {
+		variables["PLATFORMS"] = strings.Join(platforms, ",")
+	}
+
+	type variable struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	}
+	body := struct {
+		Ref       string     `json:"ref"`
+		Variables []variable `json:"variables"`
+	}{Ref: g.ref}
+	for _, key := range slices.Sorted(maps.Keys(variables)) {
+		body.Variables = append(body.Variables, variable{Key: key, Value: variables[key]})
+	}
+
+	createdAt := time.Now()
+	var pipeline gitlabPipeline
+	if err := g.call(ctx, http.MethodPost, "/pipeline", body, &pipeline); err != nil {
+		g.logger.Error("Failed to create GitLab pipeline", zap.Error(err))
+		return nil, fmt.Errorf("failed to create pipeline: %w", err)
+	}
+
+	request := &types.MirrorRequest{
+		ID:             strconv.FormatInt(pipeline.ID, 10),
+		TargetRegistry: targetRegistry,
+		Status:         "pending",
+		CreatedAt:      createdAt,
+		UpdatedAt:      createdAt,
+	}
+	if len(images) == 1 {
+		request.SourceImage = images[0]
+	} else {
+		request.SourceImages = images
+	}
+
+	g.logger.Info("Successfully created GitLab pipeline",
+		zap.String("request_id", request.ID),
+		zap.Int("images", len(images)),
+		zap.String("url", pipeline.WebURL))
+
+	return request, nil
+}
+
+// Status 查询流水线状态，并映射为GitHub工作流的状态和结论
+func (g *GitLab) Status(ctx context.Context, request *types.MirrorRequest) (*types.GitHubWorkflowResponse, error) {
+	var pipeline gitlabPipeline
+	if err := g.call(ctx, http.MethodGet, "/pipelines/"+request.ID, nil, &pipeline); err != nil {
+		return nil, fmt.Errorf("failed to get pipeline %s: %w", request.ID, err)
+	}
+
+	status, conclusion := gitlabStatus(pipeline.Status)
+	return &types.GitHubWorkflowResponse{
+		WorkflowID: pipeline.ID,
+		Status:     status,
+		Conclusion: conclusion,
+		URL:        pipeline.WebURL,
+	}, nil
+}
+
+// Results 从流水线任务的制品中读取结果文件
+func (g *GitLab) Results(ctx context.Context, request *types.MirrorRequest) ([]types.ImageResult, error) {
+	jobs, err := g.jobs(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, job := range jobs {
+		var data []byte
+		path := fmt.Sprintf("/jobs/%d/artifacts/%s", job.ID, gitlabResultsFile)
+		err := g.call(ctx, http.MethodGet, path, nil, &data)
+		if isNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to download %s from job %d: %w", gitlabResultsFile, job.ID, err)
+		}
+		return github.ParseResults(bytes.NewReader(data))
+	}
+	return nil, fmt.Errorf("%s not found in artifacts of pipeline %s", gitlabResultsFile, request.ID)
+}
+
+// Cancel 取消流水线
+func (g *GitLab) Cancel(ctx context.Context, request *types.MirrorRequest) error {
+	if err := g.call(ctx, http.MethodPost, "/pipelines/"+request.ID+"/cancel", nil, nil); err != nil {
+		return fmt.Errorf("failed to cancel pipeline %s: %w", request.ID, err)
+	}
+	return nil
+}
+
+// Logs 按顺序拼接流水线中每个任务的日志
+func (g *GitLab) Logs(ctx context.Context, request *types.MirrorRequest) (string, error) {
+	jobs, err := g.jobs(ctx, request)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	for _, job := range jobs {
+		var trace []byte
+		if err := g.call(ctx, http.MethodGet, fmt.Sprintf("/jobs/%d/trace", job.ID), nil, &trace); err != nil {
+			return "", fmt.Errorf("failed to get log of job %d: %w", job.ID, err)
+		}
+		fmt.Fprintf(&sb, "==> %s <==\n", job.Name)
+		sb.Write(trace)
+	}
+	return sb.String(), nil
+}
+
+// jobs 列出流水线中的任务，按创建顺序排列
+func (g *GitLab) jobs(ctx context.Context, request *types.MirrorRequest) ([]gitlabJob, error) {
+	var jobs []gitlabJob
+	if err := g.call(ctx, http.MethodGet, "/pipelines/"+request.ID+"/jobs?per_page=100", nil, &jobs); err != nil {
+		return nil, fmt.Errorf("failed to list jobs of pipeline %s: %w", request.ID, err)
+	}
+	// API按ID倒序返回
+	for i, j := 0, len(jobs)-1; i < j; i, j = i+1, j-1 {
+		jobs[i], jobs[j] = jobs[j], jobs[i]
+	}
+	return jobs, nil
+}
+
+// call 调用项目下的API
+func (g *GitLab) call(ctx context.Context, method, path string, in, out interface{}) error {
+	return g.api.call(ctx, method, "/projects/"+url.PathEscape(g.project)+path, in, out)
+}
+
+// gitlabStatus 将流水线状态映射为GitHub工作流的状态和结论
+func gitlabStatus(status string) (string, string) {
+	switch status {
+	case "success":
+		return types.WorkflowStatusCompleted, "success"
+	case "failed":
+		return types.WorkflowStatusCompleted, "failure"
+	case "canceled":
+		return types.WorkflowStatusCompleted, "cancelled"
+	case "skipped":
+		return types.WorkflowStatusCompleted, "skipped"
+	case "running", "canceling":
+		return "in_progress", "unknown"
+	case "manual":
+		// 等待手动触发的任务，需要在GitLab页面上操作
+		return "waiting", "unknown"
+	default:
+		// created、waiting_for_resource、preparing、pending、scheduled
+		return "queued", "unknown"
+	}
+}
@@ -0,0 +1,275 @@
+package shipper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/keevingness/image-shipper/internal/config"
+	"github.com/keevingness/image-shipper/internal/types"
+)
+
+// fakeGitLab 进程内的GitLab API，只实现GitLab后端用到的接口
+type fakeGitLab struct {
+	server *httptest.Server
+
+	mu        sync.Mutex
+	ref       string
+	variables map[string]string
+	status    string
+	cancelled bool
+}
+
+// newFakeGitLab 启动进程内的GitLab API，测试结束时关闭
+// 流水线42有两个任务，API按ID倒序返回；只有任务7的制品中有结果文件。
+func newFakeGitLab(t *testing.T) *fakeGitLab {
+	t.Helper()
+	f := &fakeGitLab{status: "created"}
+
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("PRIVATE-TOKEN") != "glpat-test" {
+			http.Error(w, `{"message":"401 Unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		// 项目路径中的斜杠需要转义
+		path, ok := strings.CutPrefix(r.URL.EscapedPath(), "/api/v4/projects/group%2Fimage-shipper")
+		if !ok {
+			http.Error(w, `{"message":"404 Project Not Found"}`, http.StatusNotFound)
+			return
+		}
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		switch r.Method + " " + path {
+		case "POST /pipeline":
+			var body struct {
+				Ref       string `json:"ref"`
+				Variables []struct {
+					Key   string `json:"key"`
+					Value string `json:"value"`
+				} `json:"variables"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			f.ref = body.Ref
+			f.variables = map[string]string{}
+			for _, v := range body.Variables {
+				f.variables[v.Key] = v.Value
+			}
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, `{"id":42,"status":%q,"web_url":"https://gitlab.example.com/group/image-shipper/-/pipelines/42"}`, f.status)
+		case "GET /pipelines/42":
+			fmt.Fprintf(w, `{"id":42,"status":%q,"web_url":"https://gitlab.example.com/group/image-shipper/-/pipelines/42"}`, f.status)
+		case "POST /pipelines/42/cancel":
+			f.cancelled = true
+			fmt.Fprint(w, `{"id":42,"status":"canceling"}`)
+		case "GET /pipelines/42/jobs":
+			if r.URL.Query().Get("per_page") != "100" {
+				t.Errorf("jobs listed with query %s", r.URL.RawQuery)
+			}
+			fmt.Fprint(w, `[{"id":8,"name":"cleanup","status":"success"},{"id":7,"name":"image-shipper","status":"success"}]`)
+		case "GET /jobs/7/artifacts/results.jsonl":
+			fmt.Fprint(w, testResults)
+		case "GET /jobs/7/trace":
+			fmt.Fprint(w, "copying nginx:1.25\n")
+		case "GET /jobs/8/trace":
+			fmt.Fprint(w, "cleaning up\n")
+		case "GET /pipelines/43", "GET /pipelines/43/jobs":
+			http.Error(w, `{"message":"404 Not found"}`, http.StatusNotFound)
+		case "POST /pipelines/43/cancel":
+			http.Error(w, `{"message":"403 Forbidden"}`, http.StatusForbidden)
+		default:
+			http.Error(w, `{"message":"404 Not found"}`, http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+// backend 创建连接到该服务的GitLab后端
+func (f *fakeGitLab) backend(t *testing.T) Shipper {
+	t.Helper()
+	cfg := &config.Config{
+		Ship: config.ShipConfig{Backend: config.ShipBackendGitLab},
+		GitLab: config.GitLabConfig{
+			URL:     f.server.URL + "/",
+			Token:   "glpat-test",
+			Project: "group/image-shipper",
+			Ref:     "main",
+		},
+	}
+	backend, err := New(cfg, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return backend
+}
+
+// setStatus 修改流水线状态
+func (f *fakeGitLab) setStatus(status string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.status = status
+}
+
+func TestGitLabBackend(t *testing.T) {
+	f := newFakeGitLab(t)
+	backend := f.backend(t)
+	ctx := context.Background()
+
+	target := &types.Target{Type: "harbor", Registry: "harbor.example.com", Namespace: "mirror", Credentials: "HARBOR"}
+	request, err := backend.Submit(ctx, []string{"nginx:1.25", "redis:7"}, target, []string{"linux/amd64", "linux/arm64"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.ID != "42" || request.TargetRegistry != "harbor.example.com" || !slices.Equal(request.SourceImages, []string{"nginx:1.25", "redis:7"}) {
+		t.Errorf("Submit() = %+v", request)
+	}
+	wantVariables := map[string]string{
+		"DOCKER_IMAGES":      "nginx:1.25\nredis:7",
+		"TARGET_TYPE":        "harbor",
+		"TARGET_REGISTRY":    "harbor.example.com",
+		"TARGET_NAMESPACE":   "mirror",
+		"TARGET_CREDENTIALS": "HARBOR",
+		"PLATFORMS":          "linux/amd64,linux/arm64",
+	}
+	f.mu.Lock()
+	if f.ref != "main" || fmt.Sprint(f.variables) != fmt.Sprint(wantVariables) {
+		t.Errorf("pipeline ref %q variables %q, want main %q", f.ref, f.variables, wantVariables)
+	}
+	f.mu.Unlock()
+
+	status, err := backend.Status(ctx, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.WorkflowID != 42 || status.Status != "queued" || !strings.HasSuffix(status.URL, "/pipelines/42") {
+		t.Errorf("Status() = %+v, want queued pipeline 42", status)
+	}
+
+	f.setStatus("failed")
+	status, err = backend.Status(ctx, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Status != types.WorkflowStatusCompleted || status.Conclusion != "failure" {
+		t.Errorf("Status() = %+v, want completed failure", status)
+	}
+
+	// 任务8没有结果文件，跳过后从任务7读取
+	results, err := backend.Results(ctx, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.EqualFunc(results, wantResults, func(a, b types.ImageResult) bool { return fmt.Sprint(a) == fmt.Sprint(b) }) {
+		t.Errorf("Results() = %+v, want %+v", results, wantResults)
+	}
+
+	logs, err := backend.Logs(ctx, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "==> image-shipper <==\ncopying nginx:1.25\n==> cleanup <==\ncleaning up\n"; logs != want {
+		t.Errorf("Logs() = %q, want %q", logs, want)
+	}
+
+	if err := backend.Cancel(ctx, request); err != nil {
+		t.Fatal(err)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.cancelled {
+		t.Error("Cancel() did not cancel the pipeline")
+	}
+}
+
+func TestGitLabBackendSingleImage(t *testing.T) {
+	f := newFakeGitLab(t)
+	request, err := f.backend(t).Submit(context.Background(), []string{"nginx:1.25"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.SourceImage != "nginx:1.25" {
+		t.Errorf("Submit() = %+v", request)
+	}
+	// 未指定目标和平台时只传镜像，流水线使用默认的阿里云配置
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if want := map[string]string{"DOCKER_IMAGE": "nginx:1.25"}; fmt.Sprint(f.variables) != fmt.Sprint(want) {
+		t.Errorf("pipeline variables = %q, want %q", f.variables, want)
+	}
+}
+
+func TestGitLabBackendErrors(t *testing.T) {
+	f := newFakeGitLab(t)
+	backend := f.backend(t)
+	ctx := context.Background()
+	missing := &types.MirrorRequest{ID: "43"}
+
+	if _, err := backend.Status(ctx, missing); err == nil || !strings.Contains(err.Error(), "404 Not found") {
+		t.Errorf("Status() error = %v, want 404", err)
+	}
+	if _, err := backend.Results(ctx, missing); err == nil || !strings.Contains(err.Error(), "404 Not found") {
+		t.Errorf("Results() error = %v, want 404", err)
+	}
+	// GitLab的错误信息已经带有状态码，不再重复
+	if err := backend.Cancel(ctx, missing); err == nil || err.Error() != "failed to cancel pipeline 43: 403 Forbidden" {
+		t.Errorf("Cancel() error = %v, want 403 Forbidden", err)
+	}
+
+	cfg := &config.Config{
+		Ship:   config.ShipConfig{Backend: config.ShipBackendGitLab},
+		GitLab: config.GitLabConfig{URL: f.server.URL, Token: "wrong", Project: "group/image-shipper", Ref: "main"},
+	}
+	unauthorized, err := New(cfg, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := unauthorized.Submit(ctx, []string{"nginx"}, nil, nil); err == nil || !strings.Contains(err.Error(), "401 Unauthorized") {
+		t.Errorf("Submit() with a wrong token error = %v, want 401", err)
+	}
+}
+
+func TestGitLabStatus(t *testing.T) {
+	tests := []struct {
+		status     string
+		want       string
+		conclusion string
+	}{
+		{"created", "queued", "unknown"},
+		{"waiting_for_resource", "queued", "unknown"},
+		{"preparing", "queued", "unknown"},
+		{"pending", "queued", "unknown"},
+		{"scheduled", "queued", "unknown"},
+		{"running", "in_progress", "unknown"},
+		{"canceling", "in_progress", "unknown"},
+		{"manual", "waiting", "unknown"},
+		{"success", types.WorkflowStatusCompleted, "success"},
+		{"failed", types.WorkflowStatusCompleted, "failure"},
+		{"canceled", types.WorkflowStatusCompleted, "cancelled"},
+		{"skipped", types.WorkflowStatusCompleted, "skipped"},
+	}
+	for _, tt := range tests {
+		status, conclusion := gitlabStatus(tt.status)
+		if status != tt.want || conclusion != tt.conclusion {
+			t.Errorf("gitlabStatus(%q) = %q, %q, want %q, %q", tt.status, status, conclusion, tt.want, tt.conclusion)
+		}
+	}
+}
+
+func TestNewRESTClientCACert(t *testing.T) {
+	cfg := &config.Config{
+		Ship:   config.ShipConfig{Backend: config.ShipBackendGitLab},
+		GitLab: config.GitLabConfig{URL: "https://gitlab.example.com", Token: "t", Project: "p", Ref: "main", CACert: "testdata/missing.pem"},
+	}
+	if _, err := New(cfg, zap.NewNop()); err == nil || !strings.Contains(err.Error(), "CA certificate") {
+		t.Errorf("New() with a missing CA certificate error = %v", err)
+	}
+}
@@ -0,0 +1,322 @@
+package shipper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/keevingness/image-shipper/internal/config"
+	"github.com/keevingness/image-shipper/internal/types"
+	"github.com/keevingness/image-shipper/pkg/docker"
+)
+
+// Local 在本机直接从源仓库复制镜像到目标仓库，不需要任何CI服务
+// 目标地址的命名方式与转存工作流一致，两种方式转存的镜像可以互相替代。
+type Local struct {
+	cfg *config.Config
+
+	mu      sync.Mutex
+	seq     int
+	copiers map[string]*localCopier
+	runs    map[string]*localRun
+}
+
+// localCopier 复制到某个目标仓库的复制器，同一目标仓库的请求共用，令牌缓存因此可以复用
+type localCopier struct {
+	client *docker.RegistryClient
+	prefix string
+}
+
+// localRun 一次本地转存请求的执行状态
+type localRun struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu         sync.Mutex
+	log        strings.Builder
+	results    []types.ImageResult
+	conclusion string
+}
+
+// NewLocal 创建本地转存后端
+func NewLocal(cfg *config.Config) *Local {
+	return &Local{
+		cfg:     cfg,
+		copiers: map[string]*localCopier{},
+		runs:    map[string]*localRun{},
+	}
+}
+
+// Submit 在后台依次复制所有镜像
+func (l *Local) Submit(_ context.Context, images []string, target *types.Target, platforms []string) (*types.MirrorRequest, error) {
+	if target == nil {
+		return nil, errors.New("本地转存需要通过 --target 或配置项 ship.target 指定目标仓库")
+	}
+	copier, err := l.copier(target)
+	if err != nil {
+		return nil, err
+	}
+	var parsed []docker.Platform
+	for _, name := range platforms {
+		platform, err := docker.ParsePlatform(name)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, platform)
+	}
+
+	// 运行不随提交时的ctx结束，与远程运行一样需要通过Cancel取消
+	ctx, cancel := context.WithCancel(context.Background())
+	run := &localRun{cancel: cancel, done: make(chan struct{})}
+
+	l.mu.Lock()
+	l.seq++
+	id := fmt.Sprintf("local-%d", l.seq)
+	l.runs[id] = run
+	l.mu.Unlock()
+
+	go run.execute(ctx, copier, images, parsed)
+
+	now := time.Now()
+	request := &types.MirrorRequest{
+		ID:             id,
+		TargetRegistry: target.Registry,
+		Status:         "pending",
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if len(images) == 1 {
+		request.SourceImage = images[0]
+	} else {
+		request.SourceImages = images
+	}
+	return request, nil
+}
+
+// Status 返回复制进度，结束后结论为success、failure或cancelled
+func (l *Local) Status(_ context.Context, request *types.MirrorRequest) (*types.GitHubWorkflowResponse, error) {
+	run, err := l.run(request)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-run.done:
+		return &types.GitHubWorkflowResponse{Status: types.WorkflowStatusCompleted, Conclusion: run.conclusion}, nil
+	default:
+		return &types.GitHubWorkflowResponse{Status: "in_progress", Conclusion: "unknown"}, nil
+	}
+}
+
+// Results 返回每个镜像的复制结果
+func (l *Local) Results(_ context.Context, request *types.MirrorRequest) ([]types.ImageResult, error) {
+	run, err := l.run(request)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-run.done:
+		return run.results, nil
+	default:
+		return nil, fmt.Errorf("local run %s is still in progress", request.ID)
+	}
+}
+
+// Cancel 停止复制，已经推送的blob会保留在目标仓库中，下次复制时直接跳过
+func (l *Local) Cancel(_ context.Context, request *types.MirrorRequest) error {
+	run, err := l.run(request)
+	if err != nil {
+		return err
+	}
+	run.cancel()
+	<-run.done
+	return nil
+}
+
+// Logs 返回复制过程中每个blob的处理记录
+func (l *Local) Logs(_ context.Context, request *types.MirrorRequest) (string, error) {
+	run, err := l.run(request)
+	if err != nil {
+		return "", err
+	}
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	return run.log.String(), nil
+}
+
+// run 查找请求对应的运行
+func (l *Local) run(request *types.MirrorRequest) (*localRun, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	run, ok := l.runs[request.ID]
+	if !ok {
+		return nil, fmt.Errorf("unknown local run %s", request.ID)
+	}
+	return run, nil
+}
+
+// copier 返回复制到目标仓库的复制器
+func (l *Local) copier(target *types.Target) (*localCopier, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if copier, ok := l.copiers[target.Name]; ok {
+		return copier, nil
+	}
+
+	credentials := targetCredentials(l.cfg, target)
+	// Docker Hub未配置命名空间时，工作流推送到登录用户名下
+	if target.Namespace == "" && target.Type == config.TargetDockerHub {
+		resolved := *target
+		resolved.Namespace, _ = credentials(target.Registry)
+		target = &resolved
+	}
+	prefix, err := l.cfg.TargetPrefix(target)
+	if err != nil {
+		return nil, err
+	}
+
+	copier := &localCopier{
+		client: docker.NewRegistryClient(docker.WithCredentials(credentials)),
+		prefix: prefix,
+	}
+	l.copiers[target.Name] = copier
+	return copier, nil
+}
+
+// targetCredentials 返回本地转存使用的登录凭据
+// 目标仓库优先使用环境变量 <前缀>_USER 和 <前缀>_PASSWORD，与工作流读取的Secrets同名；
+// GHCR未设置时使用配置中的GitHub令牌；其余仓库从Docker客户端配置文件读取。
+func targetCredentials(cfg *config.Config, target *types.Target) docker.CredentialFunc {
+	fallback := docker.DockerConfigCredentials()
+	return func(registry string) (string, string) {
+		if registry == target.Registry {
+			if target.Credentials != "" {
+				user := os.Getenv(target.Credentials + "_USER")
+				password := os.Getenv(target.Credentials + "_PASSWORD")
+				if user != "" {
+					return user, password
+				}
+			}
+			if target.Type == config.TargetGHCR && cfg.GitHub.Token != "" {
+				return cfg.GitHub.Owner, cfg.GitHub.Token
+			}
+		}
+		return fallback(registry)
+	}
+}
+
+// execute 依次复制所有镜像，单个镜像失败不影响其余镜像
+func (r *localRun) execute(ctx context.Context, copier *localCopier, images []string, platforms []docker.Platform) {
+	defer close(r.done)
+	defer r.cancel()
+
+	failed := 0
+	for _, image := range images {
+		r.logf("镜像: %s\n", image)
+		result := copier.copy(ctx, image, platforms, func(desc docker.Descriptor, action docker.BlobAction) {
+			r.logf("  %s %s (%s)\n", blobActionText(action), shortDigest(desc.Digest), formatSize(desc.Size))
+		})
+		if result.Status == "success" {
+			r.logf("  ✅ %s\n", result.PinnedTarget())
+		} else {
+			failed++
+			r.logf("  ❌ %s\n", result.Error)
+		}
+
+		r.mu.Lock()
+		r.results = append(r.results, result)
+		r.mu.Unlock()
+	}
+
+	switch {
+	case ctx.Err() != nil:
+		r.conclusion = "cancelled"
+	case failed > 0:
+		r.conclusion = "failure"
+	default:
+		r.conclusion = "success"
+	}
+}
+
+// logf 追加一行日志
+func (r *localRun) logf(format string, args ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fmt.Fprintf(&r.log, format, args...)
+}
+
+// copy 复制单个镜像，目标地址为前缀加上原始输入中的仓库名和标签，只带摘要的镜像使用 sha256-<摘要> 作为标签
+func (c *localCopier) copy(ctx context.Context, image string, platforms []docker.Platform, onBlob func(docker.Descriptor, docker.BlobAction)) types.ImageResult {
+	image = strings.TrimSpace(image)
+	result := types.ImageResult{Image: image, Status: "failed"}
+
+	raw, err := docker.ParseReference(image)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	dst, err := docker.ParseReference(c.prefix + raw.Name() + ":" + raw.LocalTag())
+	if err != nil {
+		result.Error = fmt.Sprintf("无法生成目标地址: %v", err)
+		return result
+	}
+	result.Target = dst.String()
+
+	copied, err := c.client.CopyImage(ctx, raw.Normalize(), dst, docker.CopyOptions{
+		Platforms: platforms,
+		OnBlob:    onBlob,
+	})
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	// 复制整个清单时目标摘要必须与指定的源摘要一致
+	if raw.Digest != "" && len(platforms) == 0 && copied.Digest != raw.Digest {
+		result.Error = fmt.Sprintf("目标镜像摘要 %s 与源镜像摘要 %s 不一致", copied.Digest, raw.Digest)
+		return result
+	}
+
+	result.Status = "success"
+	result.Digest = copied.Digest
+	result.Platforms = copied.Platforms
+	return result
+}
+
+// blobActionText 返回blob处理方式的描述
+func blobActionText(action docker.BlobAction) string {
+	switch action {
+	case docker.BlobExisted:
+		return "已存在"
+	case docker.BlobMounted:
+		return "已挂载"
+	default:
+		return "已上传"
+	}
+}
+
+// shortDigest 返回摘要的前12位，用于日志显示
+func shortDigest(digest string) string {
+	_, hex, _ := strings.Cut(digest, ":")
+	if len(hex) > 12 {
+		hex = hex[:12]
+	}
+	return hex
+}
+
+// formatSize 以易读的单位显示大小
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
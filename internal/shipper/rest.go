@@ -0,0 +1,118 @@
+package shipper
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/keevingness/image-shipper/internal/httputil"
+)
+
+// restTimeout 单次API调用的超时时间，包括下载制品和日志
+const restTimeout = 2 * time.Minute
+
+// restClient 调用CI服务REST API的简单客户端，GitLab和Gitea后端共用
+type restClient struct {
+	httpClient *http.Client
+	baseURL    string
+	// authHeader 和 authValue 为每个请求附带的认证头
+	authHeader string
+	authValue  string
+}
+
+// newRESTClient 创建REST API客户端，使用配置的代理和额外信任的CA证书
+func newRESTClient(baseURL, proxy, caCert string) (*restClient, error) {
+	httpClient, err := httputil.NewClient(proxy, caCert)
+	if err != nil {
+		return nil, err
+	}
+	httpClient.Timeout = restTimeout
+	return &restClient{httpClient: httpClient, baseURL: baseURL}, nil
+}
+
+// apiError API返回的错误状态
+type apiError struct {
+	StatusCode int
+	Status     string
+	Message    string
+}
+
+func (e *apiError) Error() string {
+	// GitLab的错误信息通常已经以状态码开头，如 "403 Forbidden"
+	if e.Message == "" || strings.HasPrefix(e.Message, strconv.Itoa(e.StatusCode)) {
+		return cmp.Or(e.Message, e.Status)
+	}
+	return fmt.Sprintf("%s: %s", e.Status, e.Message)
+}
+
+// isNotFound 判断是否为404错误
+func isNotFound(err error) bool {
+	var apiErr *apiError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// call 调用API，in不为nil时以JSON发送；out为*[]byte时返回原始内容，否则按JSON解码
+func (c *restClient) call(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(c.authHeader, c.authValue)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &apiError{StatusCode: resp.StatusCode, Status: resp.Status}
+		var msg struct {
+			Message interface{} `json:"message"`
+			Error   string      `json:"error"`
+		}
+		if json.Unmarshal(data, &msg) == nil {
+			apiErr.Message = msg.Error
+			if msg.Message != nil {
+				apiErr.Message = fmt.Sprint(msg.Message)
+			}
+		}
+		return apiErr
+	}
+
+	switch out := out.(type) {
+	case nil:
+		return nil
+	case *[]byte:
+		*out = data
+		return nil
+	default:
+		if len(data) == 0 {
+			return nil
+		}
+		return json.Unmarshal(data, out)
+	}
+}
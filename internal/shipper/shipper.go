@@ -0,0 +1,71 @@
+// Package shipper 定义ship命令使用的转存后端
+// 后端负责在某处执行转存（GitHub Actions、GitLab CI、Gitea Actions或本机），ship命令只通过Shipper接口提交和跟踪请求。
+package shipper
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/keevingness/image-shipper/internal/config"
+	"github.com/keevingness/image-shipper/internal/github"
+	"github.com/keevingness/image-shipper/internal/types"
+)
+
+// Shipper 转存后端
+// Submit提交后转存异步执行，调用方轮询Status直到状态为types.WorkflowStatusCompleted，再通过Results获取每个镜像的结果。
+type Shipper interface {
+	// Submit 提交转存请求，只有一个镜像时按单个镜像转存，否则在一次运行中转存全部镜像
+	// target为nil时使用后端的默认目标仓库；platforms为空时复制镜像的全部平台。
+	Submit(ctx context.Context, images []string, target *types.Target, platforms []string) (*types.MirrorRequest, error)
+	// Status 查询运行状态，运行记录尚未出现时状态为types.WorkflowStatusNotVisible
+	Status(ctx context.Context, request *types.MirrorRequest) (*types.GitHubWorkflowResponse, error)
+	// Results 返回运行结束后每个镜像的转存结果
+	Results(ctx context.Context, request *types.MirrorRequest) ([]types.ImageResult, error)
+	// Cancel 取消尚未结束的运行
+	Cancel(ctx context.Context, request *types.MirrorRequest) error
+	// Logs 返回运行日志
+	Logs(ctx context.Context, request *types.MirrorRequest) (string, error)
+}
+
+// New 根据配置项ship.backend创建转存后端
+func New(cfg *config.Config, logger *zap.Logger) (Shipper, error) {
+	switch cfg.Ship.Backend {
+	case config.ShipBackendGitHub:
+		client, err := github.NewClient(cfg.GitHub, logger)
+		if err != nil {
+			return nil, err
+		}
+		// 提交前检查权限，缺少权限时直接指出，而不是在触发时才失败
+		if err := client.CheckPermissions(); err != nil {
+			return nil, err
+		}
+		return NewGitHub(client), nil
+	case config.ShipBackendGitLab:
+		gitlab, err := NewGitLab(cfg.GitLab, logger)
+		if err != nil {
+			return nil, err
+		}
+		return gitlab, nil
+	case config.ShipBackendGitea:
+		gitea, err := NewGitea(cfg.Gitea, logger)
+		if err != nil {
+			return nil, err
+		}
+		return gitea, nil
+	case config.ShipBackendLocal:
+		return NewLocal(cfg), nil
+	}
+	return nil, fmt.Errorf("不支持的转存后端 %q", cfg.Ship.Backend)
+}
+
+// PollInterval 返回轮询运行状态的间隔
+// 远程运行需要等待运行器启动，频繁查询只会消耗API配额；本地复制没有这个开销。
+func PollInterval(s Shipper) time.Duration {
+	if _, ok := s.(*Local); ok {
+		return time.Second
+	}
+	return 10 * time.Second
+}
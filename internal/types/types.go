@@ -6,6 +6,7 @@ import "time"
 type MirrorRequest struct {
 	ID             string    `json:"id"`
 	SourceImage    string    `json:"source_image"`
+	SourceImages   []string  `json:"source_images,omitempty"` // 批量模式下的镜像列表
 	TargetRegistry string    `json:"target_registry"`
 	Status         string    `json:"status"` // pending, running, success, failed
 	CreatedAt      time.Time `json:"created_at"`
@@ -13,6 +14,25 @@ type MirrorRequest struct {
 	Error          string    `json:"error,omitempty"`
 }
 
+// Target 镜像转存的目标仓库
+type Target struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"` // ghcr, dockerhub, harbor, aliyun, tcr, swr, generic
+	Registry  string `json:"registry"`
+	Namespace string `json:"namespace"`
+	// Credentials 工作流中读取登录凭据的Secrets名称前缀，
+	// 用户名和密码分别取自 <Credentials>_USER 和 <Credentials>_PASSWORD
+	Credentials string `json:"credentials"`
+}
+
+// 工作流运行状态，除GitHub返回的原始状态外额外定义的取值
+const (
+	// WorkflowStatusNotVisible 工作流已触发，但对应的运行记录尚未出现在运行列表中
+	WorkflowStatusNotVisible = "not_visible"
+	// WorkflowStatusCompleted 工作流运行已结束
+	WorkflowStatusCompleted = "completed"
+)
+
 // GitHubWorkflowResponse GitHub工作流响应
 type GitHubWorkflowResponse struct {
 	WorkflowID int64  `json:"workflow_id"`
@@ -20,3 +40,21 @@ type GitHubWorkflowResponse struct {
 	Conclusion string `json:"conclusion"`
 	URL        string `json:"url"`
 }
+
+// ImageResult 工作流中单个镜像的转存结果
+type ImageResult struct {
+	Image     string   `json:"image"`
+	Target    string   `json:"target"`
+	Digest    string   `json:"digest,omitempty"`    // 目标镜像的清单摘要，复制全部平台时与源镜像一致
+	Platforms []string `json:"platforms,omitempty"` // 实际复制的平台，如 linux/amd64
+	Status    string   `json:"status"`              // success, failed
+	Error     string   `json:"error,omitempty"`
+}
+
+// PinnedTarget 返回按摘要固定的目标镜像地址，如 registry/ns/nginx:1.25@sha256:...
+func (r ImageResult) PinnedTarget() string {
+	if r.Digest == "" {
+		return r.Target
+	}
+	return r.Target + "@" + r.Digest
+}
@@ -0,0 +1,224 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// BlobAction 复制blob时实际采取的方式
+type BlobAction string
+
+const (
+	// BlobExisted 目标仓库中已有该blob
+	BlobExisted BlobAction = "existed"
+	// BlobMounted 从同一仓库服务中的源仓库挂载
+	BlobMounted BlobAction = "mounted"
+	// BlobUploaded 从源仓库下载并上传到目标仓库
+	BlobUploaded BlobAction = "uploaded"
+)
+
+// CopyOptions 复制镜像的选项
+type CopyOptions struct {
+	// Platforms 只复制指定的平台，为空时原样复制整个清单
+	Platforms []Platform
+	// OnBlob 每个blob处理完成后调用，可用于显示进度
+	OnBlob func(desc Descriptor, action BlobAction)
+}
+
+// CopyResult 复制镜像的结果
+type CopyResult struct {
+	// Digest 目标仓库中顶层清单的摘要，复制整个清单时与源镜像一致
+	Digest string
+	// MediaType 顶层清单的媒体类型
+	MediaType string
+	// Platforms 实际复制的平台，如 linux/amd64
+	Platforms []string
+}
+
+// CopyImage 在仓库之间直接复制镜像，内容以流的方式转发，不写入本地磁盘
+// 先复制所有blob（目标仓库已有的跳过，同一仓库服务内优先跨仓库挂载），再推送子清单，顶层清单最后推送，
+// 因此目标标签出现时其引用的内容都已就绪。指定平台时行为与转存工作流一致：只选一个平台时目标为该平台的清单，
+// 选出多个平台时生成只包含这些平台的新索引。dst应带有标签。
+func (c *RegistryClient) CopyImage(ctx context.Context, src, dst Reference, opts CopyOptions) (*CopyResult, error) {
+	top, err := c.GetManifest(ctx, src.Domain, src.Path, src.Identifier())
+	if err != nil {
+		return nil, err
+	}
+
+	result := &CopyResult{MediaType: top.MediaType}
+	body := top.Body
+	switch {
+	case IsIndex(top.MediaType):
+		var index Index
+		if err := json.Unmarshal(top.Body, &index); err != nil {
+			return nil, fmt.Errorf("decode image index: %w", err)
+		}
+
+		manifests := index.Manifests
+		if len(opts.Platforms) > 0 {
+			manifests = nil
+			for _, platform := range opts.Platforms {
+				desc, err := selectPlatform(index, platform)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", src, err)
+				}
+				manifests = append(manifests, desc)
+			}
+		}
+
+		var childBody []byte
+		for _, desc := range manifests {
+			childBody, err = c.copyManifest(ctx, src, dst, desc, opts)
+			if err != nil {
+				return nil, err
+			}
+			if desc.Platform != nil && desc.Platform.OS != "unknown" {
+				result.Platforms = append(result.Platforms, desc.Platform.String())
+			}
+		}
+
+		switch {
+		case len(opts.Platforms) == 1:
+			body, result.MediaType = childBody, manifests[0].MediaType
+		case len(opts.Platforms) > 1:
+			index.Manifests = manifests
+			if index.MediaType == "" {
+				index.MediaType = top.MediaType
+			}
+			if body, err = json.Marshal(index); err != nil {
+				return nil, fmt.Errorf("encode image index: %w", err)
+			}
+		}
+
+	case IsManifest(top.MediaType):
+		var manifest Manifest
+		if err := json.Unmarshal(top.Body, &manifest); err != nil {
+			return nil, fmt.Errorf("decode manifest: %w", err)
+		}
+		platform, err := c.imagePlatform(ctx, src, manifest)
+		if err != nil {
+			return nil, err
+		}
+		for _, want := range opts.Platforms {
+			if !want.Matches(platform) {
+				return nil, fmt.Errorf("%s: %w %s (image is %s)", src, ErrPlatformNotFound, want, platform)
+			}
+		}
+		if err := c.copyBlobs(ctx, src, dst, manifest, opts); err != nil {
+			return nil, err
+		}
+		result.Platforms = []string{platform.String()}
+
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedMediaType, top.MediaType)
+	}
+
+	result.Digest, err = c.PutManifest(ctx, dst.Domain, dst.Path, dst.Identifier(), result.MediaType, body)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// copyManifest 复制子清单及其引用的内容，按摘要推送，返回清单内容
+func (c *RegistryClient) copyManifest(ctx context.Context, src, dst Reference, desc Descriptor, opts CopyOptions) ([]byte, error) {
+	resp, err := c.GetManifest(ctx, src.Domain, src.Path, desc.Digest)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case IsIndex(resp.MediaType):
+		// 嵌套的索引原样复制其中的全部清单
+		var index Index
+		if err := json.Unmarshal(resp.Body, &index); err != nil {
+			return nil, fmt.Errorf("decode image index: %w", err)
+		}
+		for _, child := range index.Manifests {
+			if _, err := c.copyManifest(ctx, src, dst, child, CopyOptions{OnBlob: opts.OnBlob}); err != nil {
+				return nil, err
+			}
+		}
+	case IsManifest(resp.MediaType):
+		var manifest Manifest
+		if err := json.Unmarshal(resp.Body, &manifest); err != nil {
+			return nil, fmt.Errorf("decode manifest: %w", err)
+		}
+		if err := c.copyBlobs(ctx, src, dst, manifest, opts); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedMediaType, resp.MediaType)
+	}
+
+	if _, err := c.PutManifest(ctx, dst.Domain, dst.Path, desc.Digest, resp.MediaType, resp.Body); err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// copyBlobs 复制清单引用的配置和所有层
+func (c *RegistryClient) copyBlobs(ctx context.Context, src, dst Reference, manifest Manifest, opts CopyOptions) error {
+	for _, desc := range append([]Descriptor{manifest.Config}, manifest.Layers...) {
+		// Windows基础镜像等不可分发的层不在仓库中，拉取时从外部地址下载
+		if strings.Contains(desc.MediaType, "foreign") || strings.Contains(desc.MediaType, "nondistributable") {
+			continue
+		}
+		action, err := c.copyBlob(ctx, src, dst, desc)
+		if err != nil {
+			return err
+		}
+		if opts.OnBlob != nil {
+			opts.OnBlob(desc, action)
+		}
+	}
+	return nil
+}
+
+// copyBlob 复制单个blob：目标已有时跳过，同一仓库服务内先尝试挂载，否则边下载边上传
+func (c *RegistryClient) copyBlob(ctx context.Context, src, dst Reference, desc Descriptor) (BlobAction, error) {
+	exists, err := c.BlobExists(ctx, dst.Domain, dst.Path, desc.Digest)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		return BlobExisted, nil
+	}
+
+	if apiHost(src.Domain) == apiHost(dst.Domain) {
+		mounted, err := c.MountBlob(ctx, dst.Domain, dst.Path, desc.Digest, src.Path)
+		if err != nil {
+			return "", err
+		}
+		if mounted {
+			return BlobMounted, nil
+		}
+	}
+
+	err = c.PushBlob(ctx, dst.Domain, dst.Path, desc, func() (io.ReadCloser, error) {
+		rc, _, err := c.GetBlob(ctx, src.Domain, src.Path, desc.Digest)
+		return rc, err
+	})
+	if err != nil {
+		return "", err
+	}
+	return BlobUploaded, nil
+}
+
+// imagePlatform 读取单平台镜像配置中的平台
+func (c *RegistryClient) imagePlatform(ctx context.Context, src Reference, manifest Manifest) (Platform, error) {
+	rc, _, err := c.GetBlob(ctx, src.Domain, src.Path, manifest.Config.Digest)
+	if err != nil {
+		return Platform{}, err
+	}
+	defer rc.Close()
+
+	var platform Platform
+	if err := json.NewDecoder(rc).Decode(&platform); err != nil {
+		return Platform{}, fmt.Errorf("decode image config: %w", err)
+	}
+	return platform, nil
+}
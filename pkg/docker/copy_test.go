@@ -0,0 +1,353 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var (
+	linuxAmd64 = Platform{OS: "linux", Architecture: "amd64"}
+	linuxArm64 = Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}
+	linuxArmV7 = Platform{OS: "linux", Architecture: "arm", Variant: "v7"}
+)
+
+// addMultiPlatformImage 写入包含amd64、arm64和arm/v7三个平台的镜像 app:v1
+func addMultiPlatformImage(t *testing.T, reg *fakeRegistry) (index Descriptor, platforms map[string]Descriptor) {
+	t.Helper()
+	platforms = map[string]Descriptor{
+		"linux/amd64":  reg.addImage(t, "app", "", linuxAmd64, "base", "amd64 layer"),
+		"linux/arm64":  reg.addImage(t, "app", "", linuxArm64, "base", "arm64 layer"),
+		"linux/arm/v7": reg.addImage(t, "app", "", linuxArmV7, "base", "armv7 layer"),
+	}
+	index = reg.addIndex(t, "app", "v1", platforms["linux/amd64"], platforms["linux/arm64"], platforms["linux/arm/v7"])
+	return index, platforms
+}
+
+// recordActions 返回记录每个blob处理方式的OnBlob回调
+func recordActions(actions *[]BlobAction) func(Descriptor, BlobAction) {
+	return func(_ Descriptor, action BlobAction) {
+		*actions = append(*actions, action)
+	}
+}
+
+func TestCopyImageAcrossRegistries(t *testing.T) {
+	src, dst := newFakeRegistry(t), newFakeRegistry(t)
+	index, _ := addMultiPlatformImage(t, src)
+
+	client := NewRegistryClient()
+	var actions []BlobAction
+	result, err := client.CopyImage(context.Background(), src.ref(t, "app:v1"), dst.ref(t, "mirror/app:v1"), CopyOptions{OnBlob: recordActions(&actions)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Digest != index.Digest || result.MediaType != MediaTypeOCIIndex {
+		t.Errorf("CopyImage() = %s %s, want %s %s", result.MediaType, result.Digest, MediaTypeOCIIndex, index.Digest)
+	}
+	if want := []string{"linux/amd64", "linux/arm64/v8", "linux/arm/v7"}; !slices.Equal(result.Platforms, want) {
+		t.Errorf("CopyImage() platforms = %q, want %q", result.Platforms, want)
+	}
+	got, ok := dst.manifest("mirror/app", "v1")
+	srcIndex, _ := src.manifest("app", "v1")
+	if !ok || !bytes.Equal(got.body, srcIndex.body) {
+		t.Errorf("target index differs from source index")
+	}
+
+	// 共享的base层在第二个平台时已存在
+	want := []BlobAction{
+		BlobUploaded, BlobUploaded, BlobUploaded,
+		BlobUploaded, BlobExisted, BlobUploaded,
+		BlobUploaded, BlobExisted, BlobUploaded,
+	}
+	if !slices.Equal(actions, want) {
+		t.Errorf("blob actions = %q, want %q", actions, want)
+	}
+
+	// 顶层清单最后推送，目标标签出现时引用的内容都已就绪
+	log := dst.log()
+	if last := log[len(log)-1]; last != "PUT /v2/mirror/app/manifests/v1" {
+		t.Errorf("last request to target = %q, want the tag manifest push", last)
+	}
+	for _, req := range log[:len(log)-1] {
+		if strings.HasPrefix(req, "PUT /v2/mirror/app/manifests/") && !strings.Contains(req, "sha256:") {
+			t.Errorf("tag pushed before the content it references: %q", req)
+		}
+	}
+
+	// 再次复制时所有blob都已存在
+	actions = nil
+	if _, err := client.CopyImage(context.Background(), src.ref(t, "app:v1"), dst.ref(t, "mirror/app:v2"), CopyOptions{OnBlob: recordActions(&actions)}); err != nil {
+		t.Fatal(err)
+	}
+	for _, action := range actions {
+		if action != BlobExisted {
+			t.Fatalf("blob actions on second copy = %q, want all existed", actions)
+		}
+	}
+}
+
+func TestCopyImageMountsWithinRegistry(t *testing.T) {
+	reg := newFakeRegistry(t)
+	reg.addImage(t, "app", "v1", linuxAmd64, "layer-1", "layer-2")
+
+	var actions []BlobAction
+	_, err := NewRegistryClient().CopyImage(context.Background(), reg.ref(t, "app:v1"), reg.ref(t, "mirror/app:v1"), CopyOptions{OnBlob: recordActions(&actions)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []BlobAction{BlobMounted, BlobMounted, BlobMounted}; !slices.Equal(actions, want) {
+		t.Errorf("blob actions = %q, want %q", actions, want)
+	}
+	for _, req := range reg.log() {
+		if strings.HasPrefix(req, "PUT /v2/mirror/app/blobs/uploads/") {
+			t.Errorf("blob uploaded although it could be mounted: %q", req)
+		}
+	}
+	if _, ok := reg.manifest("mirror/app", "v1"); !ok {
+		t.Error("target tag not pushed")
+	}
+}
+
+func TestCopyImageMountUnsupported(t *testing.T) {
+	reg := newFakeRegistry(t)
+	reg.noMount = true
+	reg.addImage(t, "app", "v1", linuxAmd64, "layer")
+
+	var actions []BlobAction
+	_, err := NewRegistryClient().CopyImage(context.Background(), reg.ref(t, "app:v1"), reg.ref(t, "mirror/app:v1"), CopyOptions{OnBlob: recordActions(&actions)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []BlobAction{BlobUploaded, BlobUploaded}; !slices.Equal(actions, want) {
+		t.Errorf("blob actions = %q, want %q", actions, want)
+	}
+
+	// 挂载失败时仓库开始的上传会话应被取消
+	var cancelled int
+	for _, req := range reg.log() {
+		if strings.HasPrefix(req, "DELETE /v2/mirror/app/blobs/uploads/") {
+			cancelled++
+		}
+	}
+	if cancelled != 2 {
+		t.Errorf("cancelled %d upload sessions, want 2", cancelled)
+	}
+}
+
+func TestCopyImagePlatforms(t *testing.T) {
+	tests := []struct {
+		name      string
+		platforms []string
+		// want 为空时目标应为只包含这些平台的新索引
+		want      string
+		wantIndex []string
+		copied    []string
+	}{
+		{name: "single", platforms: []string{"linux/arm64"}, want: "linux/arm64", copied: []string{"linux/arm64/v8"}},
+		{name: "single with variant", platforms: []string{"linux/arm/v7"}, want: "linux/arm/v7", copied: []string{"linux/arm/v7"}},
+		{name: "multiple", platforms: []string{"linux/amd64", "linux/arm64"}, wantIndex: []string{"linux/amd64", "linux/arm64"}, copied: []string{"linux/amd64", "linux/arm64/v8"}},
+		{name: "order follows request", platforms: []string{"linux/arm/v7", "linux/amd64"}, wantIndex: []string{"linux/arm/v7", "linux/amd64"}, copied: []string{"linux/arm/v7", "linux/amd64"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, dst := newFakeRegistry(t), newFakeRegistry(t)
+			_, platforms := addMultiPlatformImage(t, src)
+
+			var opts CopyOptions
+			for _, s := range tt.platforms {
+				p, err := ParsePlatform(s)
+				if err != nil {
+					t.Fatal(err)
+				}
+				opts.Platforms = append(opts.Platforms, p)
+			}
+			result, err := NewRegistryClient().CopyImage(context.Background(), src.ref(t, "app:v1"), dst.ref(t, "app:v1"), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(result.Platforms, tt.copied) {
+				t.Errorf("CopyImage() platforms = %q, want %q", result.Platforms, tt.copied)
+			}
+
+			got, ok := dst.manifest("app", "v1")
+			if !ok {
+				t.Fatal("target tag not pushed")
+			}
+			if result.Digest != Digest(got.body) {
+				t.Errorf("CopyImage() digest = %s, target has %s", result.Digest, Digest(got.body))
+			}
+
+			if tt.want != "" {
+				// 只选一个平台时目标为该平台的清单本身，摘要与源一致
+				want := platforms[tt.want]
+				if result.Digest != want.Digest || result.MediaType != MediaTypeOCIManifest || got.mediaType != MediaTypeOCIManifest {
+					t.Errorf("CopyImage() = %s %s, want %s %s", result.MediaType, result.Digest, MediaTypeOCIManifest, want.Digest)
+				}
+				return
+			}
+
+			if result.MediaType != MediaTypeOCIIndex {
+				t.Errorf("CopyImage() media type = %s, want %s", result.MediaType, MediaTypeOCIIndex)
+			}
+			var index Index
+			if err := json.Unmarshal(got.body, &index); err != nil {
+				t.Fatal(err)
+			}
+			var digests []string
+			for _, desc := range index.Manifests {
+				digests = append(digests, desc.Digest)
+			}
+			var want []string
+			for _, p := range tt.wantIndex {
+				want = append(want, platforms[p].Digest)
+			}
+			if !slices.Equal(digests, want) {
+				t.Errorf("target index manifests = %q, want %q", digests, want)
+			}
+			// 未选择的平台的内容不应复制
+			for name, desc := range platforms {
+				if _, copied := dst.manifest("app", desc.Digest); copied != slices.Contains(tt.wantIndex, name) {
+					t.Errorf("platform %s copied = %v", name, copied)
+				}
+			}
+		})
+	}
+}
+
+func TestCopyImagePlatformNotFound(t *testing.T) {
+	t.Run("index", func(t *testing.T) {
+		src, dst := newFakeRegistry(t), newFakeRegistry(t)
+		addMultiPlatformImage(t, src)
+
+		opts := CopyOptions{Platforms: []Platform{linuxAmd64, {OS: "linux", Architecture: "s390x"}}}
+		_, err := NewRegistryClient().CopyImage(context.Background(), src.ref(t, "app:v1"), dst.ref(t, "app:v1"), opts)
+		if !errors.Is(err, ErrPlatformNotFound) {
+			t.Errorf("CopyImage() error = %v, want ErrPlatformNotFound", err)
+		}
+		if len(dst.log()) != 0 {
+			t.Errorf("target received requests before platform selection failed: %q", dst.log())
+		}
+	})
+
+	t.Run("single platform image", func(t *testing.T) {
+		src, dst := newFakeRegistry(t), newFakeRegistry(t)
+		src.addImage(t, "app", "v1", linuxAmd64, "layer")
+
+		_, err := NewRegistryClient().CopyImage(context.Background(), src.ref(t, "app:v1"), dst.ref(t, "app:v1"), CopyOptions{Platforms: []Platform{linuxArm64}})
+		if !errors.Is(err, ErrPlatformNotFound) {
+			t.Errorf("CopyImage() error = %v, want ErrPlatformNotFound", err)
+		}
+
+		result, err := NewRegistryClient().CopyImage(context.Background(), src.ref(t, "app:v1"), dst.ref(t, "app:v1"), CopyOptions{Platforms: []Platform{linuxAmd64}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(result.Platforms, []string{"linux/amd64"}) {
+			t.Errorf("CopyImage() platforms = %q, want [linux/amd64]", result.Platforms)
+		}
+	})
+}
+
+func TestCopyImageStreamsBlobs(t *testing.T) {
+	src, dst := newFakeRegistry(t), newFakeRegistry(t)
+	layer := bytes.Repeat([]byte("0123456789abcdef"), 1<<16)
+	src.addImage(t, "app", "v1", linuxAmd64, string(layer))
+
+	// 源仓库先发送一半内容，等目标仓库收到一部分后再发送其余内容；
+	// 如果客户端先完整下载再上传，目标仓库在源仓库发送完之前收不到任何内容。
+	received := make(chan struct{}, 1)
+	var streamed atomic.Bool
+	src.sendBlob = func(w http.ResponseWriter, data []byte) {
+		if len(data) < len(layer) {
+			w.Write(data)
+			return
+		}
+		w.Write(data[:len(data)/2])
+		w.(http.Flusher).Flush()
+		select {
+		case <-received:
+			streamed.Store(true)
+		case <-time.After(5 * time.Second):
+		}
+		w.Write(data[len(data)/2:])
+	}
+	dst.receiveBlob = func(body io.Reader) ([]byte, error) {
+		head := make([]byte, 64<<10)
+		n, err := io.ReadFull(body, head)
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, err
+		}
+		if n == len(head) {
+			select {
+			case received <- struct{}{}:
+			default:
+			}
+		}
+		rest, err := io.ReadAll(body)
+		return append(head[:n], rest...), err
+	}
+
+	if _, err := NewRegistryClient().CopyImage(context.Background(), src.ref(t, "app:v1"), dst.ref(t, "app:v1"), CopyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if !streamed.Load() {
+		t.Error("layer was not streamed from source to target")
+	}
+}
+
+func TestCopyImageVerifiesDigest(t *testing.T) {
+	t.Run("layer", func(t *testing.T) {
+		src, dst := newFakeRegistry(t), newFakeRegistry(t)
+		desc := src.addImage(t, "app", "v1", linuxAmd64, "layer")
+		m, _ := src.manifest("app", desc.Digest)
+		var manifest Manifest
+		json.Unmarshal(m.body, &manifest)
+		src.corruptBlob("app", manifest.Layers[0].Digest)
+
+		_, err := NewRegistryClient().CopyImage(context.Background(), src.ref(t, "app:v1"), dst.ref(t, "app:v1"), CopyOptions{})
+		if !errors.Is(err, ErrDigestMismatch) {
+			t.Errorf("CopyImage() error = %v, want ErrDigestMismatch", err)
+		}
+		if dst.hasBlob("app", manifest.Layers[0].Digest) {
+			t.Error("corrupted layer stored in target")
+		}
+		if _, ok := dst.manifest("app", "v1"); ok {
+			t.Error("target tag pushed although a layer failed verification")
+		}
+	})
+
+	t.Run("platform manifest", func(t *testing.T) {
+		src, dst := newFakeRegistry(t), newFakeRegistry(t)
+		_, platforms := addMultiPlatformImage(t, src)
+		src.corruptManifest("app", platforms["linux/arm64"].Digest)
+
+		_, err := NewRegistryClient().CopyImage(context.Background(), src.ref(t, "app:v1"), dst.ref(t, "app:v1"), CopyOptions{})
+		if !errors.Is(err, ErrDigestMismatch) {
+			t.Errorf("CopyImage() error = %v, want ErrDigestMismatch", err)
+		}
+		if _, ok := dst.manifest("app", "v1"); ok {
+			t.Error("target tag pushed although a manifest failed verification")
+		}
+	})
+
+	t.Run("source by digest", func(t *testing.T) {
+		src, dst := newFakeRegistry(t), newFakeRegistry(t)
+		desc := src.addImage(t, "app", "v1", linuxAmd64, "layer")
+		src.corruptManifest("app", desc.Digest)
+
+		_, err := NewRegistryClient().CopyImage(context.Background(), src.ref(t, "app@"+desc.Digest), dst.ref(t, "app:v1"), CopyOptions{})
+		if !errors.Is(err, ErrDigestMismatch) {
+			t.Errorf("CopyImage() error = %v, want ErrDigestMismatch", err)
+		}
+	})
+}
@@ -0,0 +1,68 @@
+package docker
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// dockerConfig ~/.docker/config.json 中与登录凭据相关的部分
+type dockerConfig struct {
+	Auths map[string]struct {
+		Auth     string `json:"auth"`
+		Username string `json:"username"`
+		Password string `json:"password"`
+	} `json:"auths"`
+}
+
+// DockerConfigCredentials 从Docker客户端配置文件读取登录凭据
+// 配置文件位于 $DOCKER_CONFIG/config.json 或 ~/.docker/config.json。
+// 只支持直接保存在auths中的凭据，credsStore和credHelpers不会被调用。
+func DockerConfigCredentials() CredentialFunc {
+	path := filepath.Join(os.Getenv("DOCKER_CONFIG"), "config.json")
+	if os.Getenv("DOCKER_CONFIG") == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return func(string) (string, string) { return "", "" }
+		}
+		path = filepath.Join(home, ".docker", "config.json")
+	}
+
+	var cfg dockerConfig
+	if data, err := os.ReadFile(path); err == nil {
+		_ = json.Unmarshal(data, &cfg)
+	}
+
+	return func(registry string) (string, string) {
+		for key, entry := range cfg.Auths {
+			if normalizeAuthKey(key) != normalizeAuthKey(registry) {
+				continue
+			}
+			if entry.Username != "" {
+				return entry.Username, entry.Password
+			}
+			decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+			if err != nil {
+				continue
+			}
+			if user, pass, ok := strings.Cut(string(decoded), ":"); ok {
+				return user, pass
+			}
+		}
+		return "", ""
+	}
+}
+
+// normalizeAuthKey 统一auths中的键，兼容 https://index.docker.io/v1/ 这类历史写法
+func normalizeAuthKey(key string) string {
+	key = strings.TrimPrefix(key, "https://")
+	key = strings.TrimPrefix(key, "http://")
+	key = strings.SplitN(key, "/", 2)[0]
+	switch key {
+	case "", "index.docker.io", dockerHubHost:
+		return DockerHubRegistry
+	}
+	return key
+}
@@ -6,4 +6,12 @@ import "errors"
 var (
 	// ErrInvalidImageRef 无效的镜像引用
 	ErrInvalidImageRef = errors.New("invalid image reference")
-)
\ No newline at end of file
+	// ErrUnsupportedMediaType 不支持的清单媒体类型
+	ErrUnsupportedMediaType = errors.New("unsupported manifest media type")
+	// ErrDigestMismatch 下载内容的摘要与期望值不一致
+	ErrDigestMismatch = errors.New("digest mismatch")
+	// ErrPlatformNotFound 镜像索引中没有匹配的平台
+	ErrPlatformNotFound = errors.New("no manifest for platform")
+	// ErrUnauthorized 仓库拒绝了认证
+	ErrUnauthorized = errors.New("registry authentication failed")
+)
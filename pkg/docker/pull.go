@@ -0,0 +1,237 @@
+package docker
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Image 已解析到单个平台的镜像
+type Image struct {
+	Registry     string
+	Repository   string
+	Digest       string
+	MediaType    string
+	Manifest     Manifest
+	ManifestBody []byte
+	Config       []byte
+}
+
+// FetchImage 获取镜像清单和配置
+// reference为多平台索引时按platform选择对应的清单。
+func (c *RegistryClient) FetchImage(ctx context.Context, registry, repository, reference string, platform Platform) (*Image, error) {
+	resp, err := c.GetManifest(ctx, registry, repository, reference)
+	if err != nil {
+		return nil, err
+	}
+
+	if IsIndex(resp.MediaType) {
+		var index Index
+		if err := json.Unmarshal(resp.Body, &index); err != nil {
+			return nil, fmt.Errorf("decode image index: %w", err)
+		}
+		desc, err := selectPlatform(index, platform)
+		if err != nil {
+			return nil, fmt.Errorf("%s/%s:%s: %w", registry, repository, reference, err)
+		}
+		resp, err = c.GetManifest(ctx, registry, repository, desc.Digest)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !IsManifest(resp.MediaType) {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedMediaType, resp.MediaType)
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(resp.Body, &manifest); err != nil {
+		return nil, fmt.Errorf("decode manifest: %w", err)
+	}
+
+	rc, _, err := c.GetBlob(ctx, registry, repository, manifest.Config.Digest)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	config, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("read image config: %w", err)
+	}
+
+	return &Image{
+		Registry:     registry,
+		Repository:   repository,
+		Digest:       resp.Digest,
+		MediaType:    resp.MediaType,
+		Manifest:     manifest,
+		ManifestBody: resp.Body,
+		Config:       config,
+	}, nil
+}
+
+// selectPlatform 从索引中选择匹配平台的清单
+func selectPlatform(index Index, platform Platform) (Descriptor, error) {
+	for _, desc := range index.Manifests {
+		if desc.Platform != nil && platform.Matches(*desc.Platform) {
+			return desc, nil
+		}
+	}
+	return Descriptor{}, fmt.Errorf("%w %s", ErrPlatformNotFound, platform)
+}
+
+// WriteDockerArchive 将镜像以docker-archive格式写入w，可直接交给 docker load 或 podman load
+// 层以仓库中的压缩格式原样写入，加载时由容器运行时解压。
+func (c *RegistryClient) WriteDockerArchive(ctx context.Context, img *Image, w io.Writer, repoTag string) error {
+	tw := tar.NewWriter(w)
+
+	configName := digestHex(img.Manifest.Config.Digest) + ".json"
+	if err := writeTarFile(tw, configName, img.Config); err != nil {
+		return err
+	}
+
+	layers := make([]string, 0, len(img.Manifest.Layers))
+	for _, layer := range img.Manifest.Layers {
+		name := digestHex(layer.Digest) + "/layer.tar"
+		if err := c.copyBlobToTar(ctx, tw, img, layer, name); err != nil {
+			return err
+		}
+		layers = append(layers, name)
+	}
+
+	manifest := []map[string]interface{}{{
+		"Config":   configName,
+		"RepoTags": []string{repoTag},
+		"Layers":   layers,
+	}}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	if err := writeTarFile(tw, "manifest.json", data); err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
+
+// copyBlobToTar 将blob作为tar条目写入，条目大小取自描述符
+func (c *RegistryClient) copyBlobToTar(ctx context.Context, tw *tar.Writer, img *Image, desc Descriptor, name string) error {
+	rc, _, err := c.GetBlob(ctx, img.Registry, img.Repository, desc.Digest)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: desc.Size, Typeflag: tar.TypeReg}); err != nil {
+		return err
+	}
+	if _, err := io.Copy(tw, rc); err != nil {
+		return fmt.Errorf("copy layer %s: %w", desc.Digest, err)
+	}
+	return nil
+}
+
+// WriteOCILayout 将镜像写入OCI镜像布局目录，refName记录在index.json的注解中
+// 目录已存在时复用其中的blob，并替换index.json中同名的条目。
+func (c *RegistryClient) WriteOCILayout(ctx context.Context, img *Image, dir, refName string) error {
+	blobDir := filepath.Join(dir, "blobs", "sha256")
+	if err := os.MkdirAll(blobDir, 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "oci-layout"), []byte(`{"imageLayoutVersion":"1.0.0"}`), 0644); err != nil {
+		return err
+	}
+
+	for _, layer := range img.Manifest.Layers {
+		if err := c.writeBlobFile(ctx, img, layer.Digest, blobDir); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(filepath.Join(blobDir, digestHex(img.Manifest.Config.Digest)), img.Config, 0644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(blobDir, digestHex(img.Digest)), img.ManifestBody, 0644); err != nil {
+		return err
+	}
+
+	indexPath := filepath.Join(dir, "index.json")
+	index := Index{SchemaVersion: 2, MediaType: MediaTypeOCIIndex}
+	if data, err := os.ReadFile(indexPath); err == nil {
+		if err := json.Unmarshal(data, &index); err != nil {
+			return fmt.Errorf("decode %s: %w", indexPath, err)
+		}
+	}
+
+	entry := Descriptor{
+		MediaType:   img.MediaType,
+		Digest:      img.Digest,
+		Size:        int64(len(img.ManifestBody)),
+		Annotations: map[string]string{"org.opencontainers.image.ref.name": refName},
+	}
+	manifests := index.Manifests[:0]
+	for _, desc := range index.Manifests {
+		if desc.Annotations["org.opencontainers.image.ref.name"] != refName {
+			manifests = append(manifests, desc)
+		}
+	}
+	index.Manifests = append(manifests, entry)
+
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(indexPath, data, 0644)
+}
+
+// writeBlobFile 下载blob到布局目录，已存在的blob直接跳过
+func (c *RegistryClient) writeBlobFile(ctx context.Context, img *Image, digest, blobDir string) error {
+	path := filepath.Join(blobDir, digestHex(digest))
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	rc, _, err := c.GetBlob(ctx, img.Registry, img.Repository, digest)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	// 先写入临时文件，校验通过后再改名，避免留下不完整的blob
+	tmp, err := os.CreateTemp(blobDir, ".download-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, rc); err != nil {
+		tmp.Close()
+		return fmt.Errorf("download blob %s: %w", digest, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// writeTarFile 写入一个普通文件条目
+func writeTarFile(tw *tar.Writer, name string, data []byte) error {
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// digestHex 去掉摘要的算法前缀
+func digestHex(digest string) string {
+	if i := strings.IndexByte(digest, ':'); i >= 0 {
+		return digest[i+1:]
+	}
+	return digest
+}
@@ -0,0 +1,158 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// BlobExists 判断仓库中是否已有指定摘要的blob
+func (c *RegistryClient) BlobExists(ctx context.Context, registry, repository, digest string) (bool, error) {
+	endpoint := c.url(registry, "/v2/%s/blobs/%s", repository, digest)
+	resp, err := c.do(ctx, registry, pushScope(repository), func() (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodHead, endpoint, nil)
+	})
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, responseError(resp, "head blob %s/%s@%s", registry, repository, digest)
+}
+
+// MountBlob 尝试从同一仓库服务中的另一个仓库挂载blob，不需要传输内容
+// 仓库不支持挂载或源仓库中没有该blob时返回false，调用方应改为上传。
+func (c *RegistryClient) MountBlob(ctx context.Context, registry, repository, digest, fromRepository string) (bool, error) {
+	query := url.Values{"mount": {digest}, "from": {fromRepository}}
+	endpoint := c.url(registry, "/v2/%s/blobs/uploads/", repository) + "?" + query.Encode()
+	scopes := append(pushScope(repository), pullScope(fromRepository)...)
+	resp, err := c.do(ctx, registry, scopes, func() (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodPost, endpoint, nil)
+	})
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated:
+		return true, nil
+	case http.StatusAccepted:
+		// 仓库改为开始一次普通上传，取消该上传会话
+		if location, err := uploadLocation(resp); err == nil {
+			c.cancelUpload(ctx, registry, repository, location)
+		}
+		return false, nil
+	}
+	return false, responseError(resp, "mount blob %s/%s@%s from %s", registry, repository, digest, fromRepository)
+}
+
+// PushBlob 以单次PUT上传blob，open在每次发送请求时打开内容
+// 内容直接从open返回的读取器流式发送，不会缓存在内存或磁盘中。
+func (c *RegistryClient) PushBlob(ctx context.Context, registry, repository string, desc Descriptor, open func() (io.ReadCloser, error)) error {
+	endpoint := c.url(registry, "/v2/%s/blobs/uploads/", repository)
+	resp, err := c.do(ctx, registry, pushScope(repository), func() (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodPost, endpoint, nil)
+	})
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusAccepted {
+		defer resp.Body.Close()
+		return responseError(resp, "start upload %s/%s@%s", registry, repository, desc.Digest)
+	}
+	resp.Body.Close()
+	location, err := uploadLocation(resp)
+	if err != nil {
+		return err
+	}
+	query := location.Query()
+	query.Set("digest", desc.Digest)
+	location.RawQuery = query.Encode()
+
+	resp, err = c.do(ctx, registry, pushScope(repository), func() (*http.Request, error) {
+		body, err := open()
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, location.String(), body)
+		if err != nil {
+			body.Close()
+			return nil, err
+		}
+		req.ContentLength = desc.Size
+		req.Header.Set("Content-Type", "application/octet-stream")
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return responseError(resp, "upload blob %s/%s@%s", registry, repository, desc.Digest)
+	}
+	return nil
+}
+
+// PutManifest 推送清单，reference可以是标签或摘要，返回仓库记录的清单摘要
+func (c *RegistryClient) PutManifest(ctx context.Context, registry, repository, reference, mediaType string, body []byte) (string, error) {
+	endpoint := c.url(registry, "/v2/%s/manifests/%s", repository, reference)
+	resp, err := c.do(ctx, registry, pushScope(repository), func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", mediaType)
+		return req, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return "", responseError(resp, "put manifest %s/%s:%s", registry, repository, reference)
+	}
+
+	digest := Digest(body)
+	if header := resp.Header.Get("Docker-Content-Digest"); header != "" && header != digest {
+		return "", fmt.Errorf("%w: pushed manifest %s but registry reports %s", ErrDigestMismatch, digest, header)
+	}
+	return digest, nil
+}
+
+// cancelUpload 取消未使用的上传会话，失败时忽略，仓库会自行清理过期的会话
+func (c *RegistryClient) cancelUpload(ctx context.Context, registry, repository string, location *url.URL) {
+	resp, err := c.do(ctx, registry, pushScope(repository), func() (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodDelete, location.String(), nil)
+	})
+	if err == nil {
+		resp.Body.Close()
+	}
+}
+
+// uploadLocation 返回上传会话的地址，相对地址按请求地址补全
+func uploadLocation(resp *http.Response) (*url.URL, error) {
+	header := resp.Header.Get("Location")
+	if header == "" {
+		return nil, fmt.Errorf("upload response from %s has no Location header", resp.Request.URL.Host)
+	}
+	location, err := url.Parse(header)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upload location %q: %w", header, err)
+	}
+	return resp.Request.URL.ResolveReference(location), nil
+}
+
+// pushScope 返回推送到仓库所需的令牌权限范围
+func pushScope(repository string) []string {
+	return []string{"repository:" + repository + ":pull,push"}
+}
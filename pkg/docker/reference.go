@@ -0,0 +1,216 @@
+package docker
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// 镜像引用语法，参照 distribution/reference 中的定义：
+//
+//	reference       := name [ ":" tag ] [ "@" digest ]
+//	name            := [domain '/'] path-component ['/' path-component]*
+//	domain          := host [':' port-number]
+//	host            := domain-name | IPv4address | '[' IPv6address ']'
+//	path-component  := alpha-numeric [separator alpha-numeric]*
+//	alpha-numeric   := /[a-z0-9]+/
+//	separator       := /[_.]|__|[-]+/
+//	tag             := /[\w][\w.-]{0,127}/
+//	digest          := algorithm ":" hex
+//	algorithm       := /[A-Za-z][A-Za-z0-9]*(?:[-_+.][A-Za-z][A-Za-z0-9]*)*/
+//	hex             := /[0-9a-fA-F]{32,}/
+var (
+	domainComponentPattern = `(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9])`
+	domainPattern          = `(?:` + domainComponentPattern + `(?:\.` + domainComponentPattern + `)*|\[[a-fA-F0-9:]+\])(?::[0-9]+)?`
+	pathComponentPattern   = `[a-z0-9]+(?:(?:[._]|__|[-]+)[a-z0-9]+)*`
+
+	domainRegexp        = regexp.MustCompile(`^` + domainPattern + `$`)
+	pathComponentRegexp = regexp.MustCompile(`^` + pathComponentPattern + `$`)
+	tagRegexp           = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	digestRegexp        = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*(?:[-_+.][A-Za-z][A-Za-z0-9]*)*:[0-9a-fA-F]{32,}$`)
+	sha256Regexp        = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+)
+
+const (
+	// maxNameLength 仓库名称（含域名）的最大长度
+	maxNameLength = 255
+	// officialRepoPrefix Docker Hub官方镜像的命名空间
+	officialRepoPrefix = "library/"
+	// DefaultTag 未指定标签和摘要时使用的标签
+	DefaultTag = "latest"
+)
+
+// Reference 镜像引用
+type Reference struct {
+	// Domain 仓库域名，可带端口，如 docker.io、localhost:5000
+	Domain string
+	// Path 仓库路径，如 library/nginx
+	Path string
+	// Tag 标签，可为空
+	Tag string
+	// Digest 内容摘要，如 sha256:...，可为空
+	Digest string
+}
+
+// ParseReference 按原样解析镜像引用，不补全域名
+// 域名判定规则与Docker一致：第一段包含 '.' 或 ':'、等于 localhost 或含大写字母时视为域名。
+func ParseReference(s string) (Reference, error) {
+	if s == "" {
+		return Reference{}, fmt.Errorf("%w: empty reference", ErrInvalidImageRef)
+	}
+
+	var ref Reference
+	remainder := s
+
+	// 摘要在最后一个 '@' 之后
+	if i := strings.LastIndexByte(remainder, '@'); i >= 0 {
+		ref.Digest = remainder[i+1:]
+		remainder = remainder[:i]
+		if !digestRegexp.MatchString(ref.Digest) {
+			return Reference{}, fmt.Errorf("%w: %q: invalid digest %q", ErrInvalidImageRef, s, ref.Digest)
+		}
+		if strings.HasPrefix(ref.Digest, "sha256:") && !sha256Regexp.MatchString(ref.Digest) {
+			return Reference{}, fmt.Errorf("%w: %q: sha256 digest must be 64 lowercase hex characters", ErrInvalidImageRef, s)
+		}
+	}
+
+	// 标签在最后一个 ':' 之后，且该 ':' 必须位于最后一个 '/' 之后，否则是域名中的端口
+	if i := strings.LastIndexByte(remainder, ':'); i > strings.LastIndexByte(remainder, '/') {
+		ref.Tag = remainder[i+1:]
+		remainder = remainder[:i]
+		if !tagRegexp.MatchString(ref.Tag) {
+			return Reference{}, fmt.Errorf("%w: %q: invalid tag %q", ErrInvalidImageRef, s, ref.Tag)
+		}
+	}
+
+	if remainder == "" {
+		return Reference{}, fmt.Errorf("%w: %q: missing repository name", ErrInvalidImageRef, s)
+	}
+	if len(remainder) > maxNameLength {
+		return Reference{}, fmt.Errorf("%w: %q: repository name longer than %d characters", ErrInvalidImageRef, s, maxNameLength)
+	}
+
+	ref.Domain, ref.Path = splitDomain(remainder)
+	if ref.Domain != "" && !domainRegexp.MatchString(ref.Domain) {
+		return Reference{}, fmt.Errorf("%w: %q: invalid domain %q", ErrInvalidImageRef, s, ref.Domain)
+	}
+	for _, component := range strings.Split(ref.Path, "/") {
+		if !pathComponentRegexp.MatchString(component) {
+			if strings.ToLower(component) == component {
+				return Reference{}, fmt.Errorf("%w: %q: invalid path component %q", ErrInvalidImageRef, s, component)
+			}
+			return Reference{}, fmt.Errorf("%w: %q: repository name must be lowercase", ErrInvalidImageRef, s)
+		}
+	}
+
+	return ref, nil
+}
+
+// ParseNormalizedReference 解析镜像引用并补全为完整形式
+// 省略域名时补全为 docker.io，Docker Hub上的单段路径补全 library/ 前缀，如 nginx -> docker.io/library/nginx。
+func ParseNormalizedReference(s string) (Reference, error) {
+	ref, err := ParseReference(s)
+	if err != nil {
+		return Reference{}, err
+	}
+	return ref.Normalize(), nil
+}
+
+// Normalize 返回补全域名和官方镜像命名空间后的引用
+func (r Reference) Normalize() Reference {
+	if r.Domain == "" || r.Domain == "index.docker.io" {
+		r.Domain = DockerHubRegistry
+	}
+	if r.Domain == DockerHubRegistry && !strings.Contains(r.Path, "/") {
+		r.Path = officialRepoPrefix + r.Path
+	}
+	return r
+}
+
+// WithDefaultTag 未指定标签和摘要时补全为latest标签
+func (r Reference) WithDefaultTag() Reference {
+	if r.Tag == "" && r.Digest == "" {
+		r.Tag = DefaultTag
+	}
+	return r
+}
+
+// LocalTag 返回导入本地容器运行时使用的标签
+// 只带摘要的引用没有标签，使用 sha256-<摘要> 作为标签，与转存工作流推送时使用的标签一致。
+func (r Reference) LocalTag() string {
+	if r.Tag != "" {
+		return r.Tag
+	}
+	if r.Digest != "" {
+		return strings.Replace(r.Digest, ":", "-", 1)
+	}
+	return DefaultTag
+}
+
+// Name 返回仓库全名，如 docker.io/library/nginx
+func (r Reference) Name() string {
+	if r.Domain == "" {
+		return r.Path
+	}
+	return r.Domain + "/" + r.Path
+}
+
+// FamiliarName 返回Docker CLI中习惯使用的简写仓库名，如 nginx、user/app
+func (r Reference) FamiliarName() string {
+	n := r.Normalize()
+	if n.Domain != DockerHubRegistry {
+		return n.Name()
+	}
+	return strings.TrimPrefix(n.Path, officialRepoPrefix)
+}
+
+// Identifier 返回拉取清单时使用的标识：有摘要时返回摘要，否则返回标签（默认latest）
+func (r Reference) Identifier() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+	if r.Tag != "" {
+		return r.Tag
+	}
+	return DefaultTag
+}
+
+// String 返回引用的字符串形式，保持解析时的域名写法
+func (r Reference) String() string {
+	return r.Name() + r.suffix()
+}
+
+// NormalizedString 返回补全后的完整字符串形式，如 docker.io/library/nginx:latest
+func (r Reference) NormalizedString() string {
+	return r.Normalize().String()
+}
+
+// FamiliarString 返回简写形式的字符串，如 nginx:latest
+func (r Reference) FamiliarString() string {
+	return r.FamiliarName() + r.suffix()
+}
+
+// suffix 返回标签和摘要部分
+func (r Reference) suffix() string {
+	s := ""
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
+
+// splitDomain 拆分域名和路径
+func splitDomain(name string) (domain, path string) {
+	i := strings.IndexByte(name, '/')
+	if i < 0 {
+		return "", name
+	}
+	first := name[:i]
+	if first == "localhost" || strings.ContainsAny(first, ".:") || strings.ToLower(first) != first {
+		return first, name[i+1:]
+	}
+	return "", name
+}
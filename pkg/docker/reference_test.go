@@ -0,0 +1,158 @@
+package docker
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const testDigest = "sha256:" + "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		input      string
+		domain     string
+		path       string
+		tag        string
+		digest     string
+		normalized string
+	}{
+		// Docker Hub 补全
+		{input: "nginx", path: "nginx", normalized: "docker.io/library/nginx"},
+		{input: "nginx:1.25", path: "nginx", tag: "1.25", normalized: "docker.io/library/nginx:1.25"},
+		{input: "library/nginx", path: "library/nginx", normalized: "docker.io/library/nginx"},
+		{input: "user/app:v1", path: "user/app", tag: "v1", normalized: "docker.io/user/app:v1"},
+		{input: "docker.io/nginx", domain: "docker.io", path: "nginx", normalized: "docker.io/library/nginx"},
+		{input: "docker.io/library/nginx:latest", domain: "docker.io", path: "library/nginx", tag: "latest", normalized: "docker.io/library/nginx:latest"},
+		{input: "index.docker.io/nginx", domain: "index.docker.io", path: "nginx", normalized: "docker.io/library/nginx"},
+		{input: "docker.io/user/app", domain: "docker.io", path: "user/app", normalized: "docker.io/user/app"},
+
+		// 其他仓库与多级路径
+		{input: "ghcr.io/owner/app:main", domain: "ghcr.io", path: "owner/app", tag: "main", normalized: "ghcr.io/owner/app:main"},
+		{input: "registry.k8s.io/ingress-nginx/controller:v1.9.0", domain: "registry.k8s.io", path: "ingress-nginx/controller", tag: "v1.9.0", normalized: "registry.k8s.io/ingress-nginx/controller:v1.9.0"},
+		{input: "quay.io/a/b/c/d", domain: "quay.io", path: "a/b/c/d", normalized: "quay.io/a/b/c/d"},
+		{input: "example.com/a__b/c.d/e-f/g---h", domain: "example.com", path: "a__b/c.d/e-f/g---h", normalized: "example.com/a__b/c.d/e-f/g---h"},
+
+		// 端口与 localhost
+		{input: "localhost/app", domain: "localhost", path: "app", normalized: "localhost/app"},
+		{input: "localhost:5000/app:dev", domain: "localhost:5000", path: "app", tag: "dev", normalized: "localhost:5000/app:dev"},
+		{input: "registry:5000/team/app", domain: "registry:5000", path: "team/app", normalized: "registry:5000/team/app"},
+		{input: "10.0.0.1:5000/app:1", domain: "10.0.0.1:5000", path: "app", tag: "1", normalized: "10.0.0.1:5000/app:1"},
+		{input: "[::1]:5000/app", domain: "[::1]:5000", path: "app", normalized: "[::1]:5000/app"},
+		{input: "Registry.Example.com/app", domain: "Registry.Example.com", path: "app", normalized: "Registry.Example.com/app"},
+
+		// 标签与摘要
+		{input: "nginx@" + testDigest, path: "nginx", digest: testDigest, normalized: "docker.io/library/nginx@" + testDigest},
+		{input: "nginx:1.25@" + testDigest, path: "nginx", tag: "1.25", digest: testDigest, normalized: "docker.io/library/nginx:1.25@" + testDigest},
+		{input: "localhost:5000/app:v2@" + testDigest, domain: "localhost:5000", path: "app", tag: "v2", digest: testDigest, normalized: "localhost:5000/app:v2@" + testDigest},
+		{input: "app@sha512:" + strings.Repeat("ab", 64), path: "app", digest: "sha512:" + strings.Repeat("ab", 64), normalized: "docker.io/library/app@sha512:" + strings.Repeat("ab", 64)},
+		{input: "app:_under", path: "app", tag: "_under", normalized: "docker.io/library/app:_under"},
+		{input: "app:" + strings.Repeat("t", 128), path: "app", tag: strings.Repeat("t", 128), normalized: "docker.io/library/app:" + strings.Repeat("t", 128)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			ref, err := ParseReference(tt.input)
+			if err != nil {
+				t.Fatalf("ParseReference(%q) error: %v", tt.input, err)
+			}
+			if ref.Domain != tt.domain || ref.Path != tt.path || ref.Tag != tt.tag || ref.Digest != tt.digest {
+				t.Errorf("ParseReference(%q) = %+v, want domain=%q path=%q tag=%q digest=%q",
+					tt.input, ref, tt.domain, tt.path, tt.tag, tt.digest)
+			}
+			if got := ref.String(); got != tt.input {
+				t.Errorf("String() = %q, want %q", got, tt.input)
+			}
+			if got := ref.NormalizedString(); got != tt.normalized {
+				t.Errorf("NormalizedString() = %q, want %q", got, tt.normalized)
+			}
+		})
+	}
+}
+
+func TestParseReferenceInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"empty", ""},
+		{"uppercase repository", "Nginx"},
+		{"uppercase path after domain", "docker.io/library/Nginx"},
+		{"uppercase namespace", "user/App"},
+		{"missing repository", ":latest"},
+		{"empty path component", "example.com//app"},
+		{"trailing slash", "example.com/app/"},
+		{"leading separator", "example.com/-app"},
+		{"trailing separator", "example.com/app-"},
+		{"triple underscore", "example.com/a___b"},
+		{"invalid tag character", "nginx:1.25!"},
+		{"tag starting with dot", "nginx:.hidden"},
+		{"tag too long", "nginx:" + strings.Repeat("t", 129)},
+		{"empty tag", "nginx:"},
+		{"empty digest", "nginx@"},
+		{"digest without algorithm", "nginx@" + strings.Repeat("a", 64)},
+		{"non-hex digest", "nginx@sha256:zz"},
+		{"short digest", "nginx@sha256:abc"},
+		{"uppercase sha256 digest", "nginx@sha256:" + strings.Repeat("A", 64)},
+		{"sha256 digest wrong length", "nginx@sha256:" + strings.Repeat("a", 63)},
+		{"non-hex digest of unknown algorithm", "nginx@foo:" + strings.Repeat("z", 32)},
+		{"invalid domain", "-bad.example.com/app"},
+		{"invalid port", "localhost:port/app"},
+		{"name too long", "example.com/" + strings.Repeat("a", 244)},
+		{"whitespace", "nginx latest"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ref, err := ParseReference(tt.input)
+			if err == nil {
+				t.Fatalf("ParseReference(%q) = %+v, want error", tt.input, ref)
+			}
+			if !errors.Is(err, ErrInvalidImageRef) {
+				t.Errorf("ParseReference(%q) error = %v, want ErrInvalidImageRef", tt.input, err)
+			}
+		})
+	}
+}
+
+func TestParseReferenceNameLength(t *testing.T) {
+	// 名称（含域名）恰好为上限时有效
+	name := "example.com/" + strings.Repeat("a", maxNameLength-len("example.com/"))
+	if _, err := ParseReference(name + ":v1"); err != nil {
+		t.Errorf("name of %d characters: %v", len(name), err)
+	}
+}
+
+func TestReferenceHelpers(t *testing.T) {
+	tests := []struct {
+		input      string
+		familiar   string
+		identifier string
+		localTag   string
+	}{
+		{"nginx", "nginx", "latest", "latest"},
+		{"docker.io/library/nginx:1.25", "nginx:1.25", "1.25", "1.25"},
+		{"docker.io/user/app:v1", "user/app:v1", "v1", "v1"},
+		{"ghcr.io/owner/app", "ghcr.io/owner/app", "latest", "latest"},
+		{"nginx@" + testDigest, "nginx@" + testDigest, testDigest, strings.Replace(testDigest, ":", "-", 1)},
+		{"nginx:1.25@" + testDigest, "nginx:1.25@" + testDigest, testDigest, "1.25"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			ref, err := ParseReference(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ref.FamiliarString(); got != tt.familiar {
+				t.Errorf("FamiliarString() = %q, want %q", got, tt.familiar)
+			}
+			if got := ref.Identifier(); got != tt.identifier {
+				t.Errorf("Identifier() = %q, want %q", got, tt.identifier)
+			}
+			if got := ref.LocalTag(); got != tt.localTag {
+				t.Errorf("LocalTag() = %q, want %q", got, tt.localTag)
+			}
+		})
+	}
+}
@@ -0,0 +1,403 @@
+package docker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/keevingness/image-shipper/internal/httputil"
+)
+
+// DockerHubRegistry Docker Hub在镜像引用中使用的仓库域名
+const DockerHubRegistry = "docker.io"
+
+// dockerHubHost Docker Hub实际提供Registry API的主机
+const dockerHubHost = "registry-1.docker.io"
+
+const (
+	// registryDialTimeout 连接仓库的超时时间
+	registryDialTimeout = 30 * time.Second
+	// registryResponseHeaderTimeout 发出请求后等待响应头的超时时间
+	// 不限制整个请求的时间，较大的层需要的下载时间不确定。
+	registryResponseHeaderTimeout = 60 * time.Second
+)
+
+// CredentialFunc 根据仓库域名返回登录凭据，无凭据时返回空字符串
+type CredentialFunc func(registry string) (username, password string)
+
+// RegistryOption 仓库客户端选项
+type RegistryOption func(*RegistryClient)
+
+// WithHTTPClient 使用自定义的HTTP客户端
+func WithHTTPClient(client *http.Client) RegistryOption {
+	return func(c *RegistryClient) {
+		c.httpClient = client
+	}
+}
+
+// WithCredentials 设置登录凭据来源
+func WithCredentials(fn CredentialFunc) RegistryOption {
+	return func(c *RegistryClient) {
+		c.credentials = fn
+	}
+}
+
+// WithPlainHTTP 指定使用HTTP而不是HTTPS访问的仓库
+func WithPlainHTTP(registries ...string) RegistryOption {
+	return func(c *RegistryClient) {
+		for _, registry := range registries {
+			c.plainHTTP[registry] = true
+		}
+	}
+}
+
+// RegistryClient 实现OCI Distribution规范的镜像仓库客户端
+// 支持匿名访问、Basic认证以及Bearer令牌认证，令牌按仓库和权限范围缓存。
+type RegistryClient struct {
+	httpClient  *http.Client
+	credentials CredentialFunc
+	plainHTTP   map[string]bool
+
+	mu   sync.Mutex
+	auth map[string]string
+}
+
+// NewRegistryClient 创建仓库客户端
+func NewRegistryClient(opts ...RegistryOption) *RegistryClient {
+	c := &RegistryClient{
+		httpClient:  newRegistryHTTPClient(),
+		credentials: func(string) (string, string) { return "", "" },
+		plainHTTP:   map[string]bool{},
+		auth:        map[string]string{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// newRegistryHTTPClient 创建默认的HTTP客户端
+// 代理从HTTPS_PROXY等环境变量读取，连接和等待响应头设有超时，避免仓库无响应时一直阻塞。
+func newRegistryHTTPClient() *http.Client {
+	// 不指定代理和CA证书时不会出错
+	client, _ := httputil.NewClient("", "")
+	transport := client.Transport.(*http.Transport)
+	transport.DialContext = (&net.Dialer{Timeout: registryDialTimeout, KeepAlive: 30 * time.Second}).DialContext
+	transport.ResponseHeaderTimeout = registryResponseHeaderTimeout
+	return client
+}
+
+// ManifestResponse 获取到的清单内容
+type ManifestResponse struct {
+	MediaType string
+	Digest    string
+	Body      []byte
+}
+
+// GetManifest 获取清单，reference可以是标签或摘要
+// 按摘要获取时会校验内容摘要。
+func (c *RegistryClient) GetManifest(ctx context.Context, registry, repository, reference string) (*ManifestResponse, error) {
+	endpoint := c.url(registry, "/v2/%s/manifests/%s", repository, reference)
+	resp, err := c.do(ctx, registry, pullScope(repository), func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", strings.Join(manifestAccept, ", "))
+		return req, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp, "get manifest %s/%s:%s", registry, repository, reference)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read manifest: %w", err)
+	}
+
+	digest := Digest(body)
+	if strings.HasPrefix(reference, "sha256:") && reference != digest {
+		return nil, fmt.Errorf("%w: manifest %s has digest %s", ErrDigestMismatch, reference, digest)
+	}
+
+	mediaType := strings.TrimSpace(strings.Split(resp.Header.Get("Content-Type"), ";")[0])
+	if !IsIndex(mediaType) && !IsManifest(mediaType) {
+		mediaType = detectMediaType(body)
+	}
+
+	return &ManifestResponse{MediaType: mediaType, Digest: digest, Body: body}, nil
+}
+
+// GetBlob 获取blob内容，读取完毕时校验摘要
+// 返回的读取器在内容摘要不匹配时于EOF处返回ErrDigestMismatch。
+func (c *RegistryClient) GetBlob(ctx context.Context, registry, repository, digest string) (io.ReadCloser, int64, error) {
+	endpoint := c.url(registry, "/v2/%s/blobs/%s", repository, digest)
+	resp, err := c.do(ctx, registry, pullScope(repository), func() (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, 0, responseError(resp, "get blob %s/%s@%s", registry, repository, digest)
+	}
+
+	return newVerifyingReader(resp.Body, digest), resp.ContentLength, nil
+}
+
+// url 拼接Registry API地址
+func (c *RegistryClient) url(registry, format string, args ...interface{}) string {
+	scheme := "https"
+	if c.plainHTTP[registry] || isLocalRegistry(registry) {
+		scheme = "http"
+	}
+	return fmt.Sprintf("%s://%s", scheme, apiHost(registry)) + fmt.Sprintf(format, args...)
+}
+
+// do 发送请求并处理认证质询
+// 首次请求使用缓存的认证信息；收到401时按质询获取令牌或使用Basic认证后重试一次。
+func (c *RegistryClient) do(ctx context.Context, registry string, scopes []string, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	cacheKey := registry + "|" + strings.Join(scopes, " ")
+
+	send := func() (*http.Response, error) {
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		if header := c.auth[cacheKey]; header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		c.mu.Unlock()
+		return c.httpClient.Do(req)
+	}
+
+	resp, err := send()
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		return resp, nil
+	}
+
+	challenge := resp.Header.Get("WWW-Authenticate")
+	resp.Body.Close()
+
+	header, err := c.authorize(ctx, registry, challenge, scopes)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.auth[cacheKey] = header
+	c.mu.Unlock()
+
+	resp, err = send()
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s", ErrUnauthorized, registry)
+	}
+	return resp, nil
+}
+
+// authorize 根据WWW-Authenticate质询生成Authorization请求头
+func (c *RegistryClient) authorize(ctx context.Context, registry, challenge string, scopes []string) (string, error) {
+	scheme, params := parseChallenge(challenge)
+	username, password := c.credentials(registry)
+
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if username == "" {
+			return "", fmt.Errorf("%w: %s requires credentials", ErrUnauthorized, registry)
+		}
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		req.SetBasicAuth(username, password)
+		return req.Header.Get("Authorization"), nil
+
+	case "bearer":
+		realm := params["realm"]
+		if realm == "" {
+			return "", fmt.Errorf("%w: bearer challenge without realm from %s", ErrUnauthorized, registry)
+		}
+		query := url.Values{}
+		if service := params["service"]; service != "" {
+			query.Set("service", service)
+		}
+		for _, scope := range scopes {
+			query.Add("scope", scope)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm+"?"+query.Encode(), nil)
+		if err != nil {
+			return "", err
+		}
+		if username != "" {
+			req.SetBasicAuth(username, password)
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return "", fmt.Errorf("request token from %s: %w", realm, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("%w: token endpoint %s returned %s", ErrUnauthorized, realm, resp.Status)
+		}
+
+		var token struct {
+			Token       string `json:"token"`
+			AccessToken string `json:"access_token"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+			return "", fmt.Errorf("decode token response: %w", err)
+		}
+		if token.Token == "" {
+			token.Token = token.AccessToken
+		}
+		if token.Token == "" {
+			return "", fmt.Errorf("%w: empty token from %s", ErrUnauthorized, realm)
+		}
+		return "Bearer " + token.Token, nil
+	}
+
+	return "", fmt.Errorf("%w: unsupported auth challenge %q from %s", ErrUnauthorized, challenge, registry)
+}
+
+// parseChallenge 解析 WWW-Authenticate: Bearer realm="...",service="..." 形式的质询
+func parseChallenge(header string) (string, map[string]string) {
+	params := map[string]string{}
+	header = strings.TrimSpace(header)
+	i := strings.IndexByte(header, ' ')
+	if i < 0 {
+		return header, params
+	}
+	scheme, rest := header[:i], header[i+1:]
+
+	for rest != "" {
+		rest = strings.TrimLeft(rest, " ,")
+		eq := strings.IndexByte(rest, '=')
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = rest[eq+1:]
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			end := strings.IndexByte(rest, ',')
+			if end < 0 {
+				value, rest = rest, ""
+			} else {
+				value, rest = rest[:end], rest[end:]
+			}
+		}
+		params[key] = value
+	}
+	return scheme, params
+}
+
+// responseError 将非预期的响应转换为错误，附带仓库返回的错误信息
+func responseError(resp *http.Response, format string, args ...interface{}) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var regErr struct {
+		Errors []struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	detail := strings.TrimSpace(string(body))
+	if json.Unmarshal(body, &regErr) == nil && len(regErr.Errors) > 0 {
+		detail = regErr.Errors[0].Code + ": " + regErr.Errors[0].Message
+	}
+	msg := fmt.Sprintf(format, args...)
+	if detail == "" {
+		return fmt.Errorf("%s: %s", msg, resp.Status)
+	}
+	return fmt.Errorf("%s: %s (%s)", msg, resp.Status, detail)
+}
+
+// pullScope 返回拉取仓库所需的令牌权限范围
+func pullScope(repository string) []string {
+	return []string{"repository:" + repository + ":pull"}
+}
+
+// apiHost 返回仓库域名对应的Registry API主机
+func apiHost(registry string) string {
+	if registry == "" || registry == DockerHubRegistry || registry == "index.docker.io" {
+		return dockerHubHost
+	}
+	return registry
+}
+
+// isLocalRegistry 判断是否为本机仓库，本机仓库默认使用HTTP访问
+func isLocalRegistry(registry string) bool {
+	host := registry
+	if i := strings.LastIndexByte(host, ':'); i >= 0 && !strings.HasSuffix(host, "]") {
+		host = host[:i]
+	}
+	return host == "localhost" || strings.HasPrefix(host, "127.") || host == "[::1]"
+}
+
+// Digest 计算内容的sha256摘要
+func Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// verifyingReader 读取时计算摘要，在EOF处与期望值比较
+type verifyingReader struct {
+	rc       io.ReadCloser
+	hash     hash.Hash
+	expected string
+}
+
+// newVerifyingReader 创建校验摘要的读取器，仅支持sha256摘要，其他算法不做校验
+func newVerifyingReader(rc io.ReadCloser, expected string) io.ReadCloser {
+	if !strings.HasPrefix(expected, "sha256:") {
+		return rc
+	}
+	return &verifyingReader{rc: rc, hash: sha256.New(), expected: expected}
+}
+
+// Read 实现io.Reader
+func (r *verifyingReader) Read(p []byte) (int, error) {
+	n, err := r.rc.Read(p)
+	r.hash.Write(p[:n])
+	if err == io.EOF {
+		if actual := "sha256:" + hex.EncodeToString(r.hash.Sum(nil)); actual != r.expected {
+			return n, fmt.Errorf("%w: expected %s, got %s", ErrDigestMismatch, r.expected, actual)
+		}
+	}
+	return n, err
+}
+
+// Close 实现io.Closer
+func (r *verifyingReader) Close() error {
+	return r.rc.Close()
+}
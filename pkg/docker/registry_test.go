@@ -0,0 +1,561 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeRegistry 进程内的OCI Distribution仓库，只实现客户端用到的接口
+// 设置token后所有/v2/请求都要求Bearer令牌，令牌由/token签发；设置username后签发令牌要求Basic认证。
+type fakeRegistry struct {
+	server   *httptest.Server
+	host     string
+	token    string
+	username string
+	password string
+	// noMount 为true时不支持跨仓库挂载，挂载请求改为开始普通上传
+	noMount bool
+	// sendBlob 和 receiveBlob 可替换blob的下载和上传方式
+	sendBlob    func(w http.ResponseWriter, data []byte)
+	receiveBlob func(body io.Reader) ([]byte, error)
+
+	mu            sync.Mutex
+	blobs         map[string][]byte
+	manifests     map[string]fakeManifest
+	uploads       map[string]string
+	requests      []string
+	tokenRequests []url.Values
+}
+
+// fakeManifest 仓库中保存的清单
+type fakeManifest struct {
+	mediaType string
+	body      []byte
+}
+
+// newFakeRegistry 启动进程内仓库，测试结束时关闭
+func newFakeRegistry(t *testing.T) *fakeRegistry {
+	t.Helper()
+	r := &fakeRegistry{
+		blobs:     map[string][]byte{},
+		manifests: map[string]fakeManifest{},
+		uploads:   map[string]string{},
+	}
+	r.server = httptest.NewServer(r)
+	t.Cleanup(r.server.Close)
+	r.host = strings.TrimPrefix(r.server.URL, "http://")
+	return r
+}
+
+// ref 返回仓库中镜像的引用
+func (r *fakeRegistry) ref(t *testing.T, name string) Reference {
+	t.Helper()
+	ref, err := ParseReference(r.host + "/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ref
+}
+
+// addBlob 写入blob，返回其描述符
+func (r *fakeRegistry) addBlob(repo, mediaType string, data []byte) Descriptor {
+	desc := Descriptor{MediaType: mediaType, Digest: Digest(data), Size: int64(len(data))}
+	r.mu.Lock()
+	r.blobs[repo+"@"+desc.Digest] = data
+	r.mu.Unlock()
+	return desc
+}
+
+// addManifest 写入清单，tag不为空时同时打上标签
+func (r *fakeRegistry) addManifest(repo, tag, mediaType string, body []byte) Descriptor {
+	desc := Descriptor{MediaType: mediaType, Digest: Digest(body), Size: int64(len(body))}
+	r.mu.Lock()
+	r.manifests[repo+"@"+desc.Digest] = fakeManifest{mediaType, body}
+	if tag != "" {
+		r.manifests[repo+":"+tag] = fakeManifest{mediaType, body}
+	}
+	r.mu.Unlock()
+	return desc
+}
+
+// addImage 写入单平台镜像，配置中记录平台，每个layers元素为一层的内容
+func (r *fakeRegistry) addImage(t *testing.T, repo, tag string, platform Platform, layers ...string) Descriptor {
+	t.Helper()
+	config, _ := json.Marshal(platform)
+	manifest := Manifest{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeOCIManifest,
+		Config:        r.addBlob(repo, MediaTypeOCIConfig, config),
+	}
+	for _, layer := range layers {
+		manifest.Layers = append(manifest.Layers, r.addBlob(repo, MediaTypeOCILayer, []byte(layer)))
+	}
+	body, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc := r.addManifest(repo, tag, MediaTypeOCIManifest, body)
+	desc.Platform = &platform
+	return desc
+}
+
+// addIndex 写入多平台索引并打上标签
+func (r *fakeRegistry) addIndex(t *testing.T, repo, tag string, manifests ...Descriptor) Descriptor {
+	t.Helper()
+	body, err := json.Marshal(Index{SchemaVersion: 2, MediaType: MediaTypeOCIIndex, Manifests: manifests})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r.addManifest(repo, tag, MediaTypeOCIIndex, body)
+}
+
+// corruptBlob 修改仓库中blob的最后一个字节，长度和摘要不变
+func (r *fakeRegistry) corruptBlob(repo, digest string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	data := bytes.Clone(r.blobs[repo+"@"+digest])
+	data[len(data)-1] ^= 0xff
+	r.blobs[repo+"@"+digest] = data
+}
+
+// corruptManifest 修改仓库中按摘要保存的清单内容而不改变其摘要
+func (r *fakeRegistry) corruptManifest(repo, digest string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m := r.manifests[repo+"@"+digest]
+	m.body = append(bytes.Clone(m.body), ' ')
+	r.manifests[repo+"@"+digest] = m
+}
+
+// manifest 返回仓库中的清单，不存在时ok为false
+func (r *fakeRegistry) manifest(repo, ref string) (fakeManifest, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m, ok := r.manifests[repo+":"+ref]
+	if !ok {
+		m, ok = r.manifests[repo+"@"+ref]
+	}
+	return m, ok
+}
+
+// hasBlob 判断仓库中是否有blob
+func (r *fakeRegistry) hasBlob(repo, digest string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.blobs[repo+"@"+digest]
+	return ok
+}
+
+// log 返回收到的请求，格式为 "METHOD path"
+func (r *fakeRegistry) log() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.requests)
+}
+
+// ServeHTTP 实现http.Handler
+func (r *fakeRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	r.requests = append(r.requests, req.Method+" "+req.URL.Path)
+	r.mu.Unlock()
+
+	if req.URL.Path == "/token" {
+		r.serveToken(w, req)
+		return
+	}
+	if r.token != "" && req.Header.Get("Authorization") != "Bearer "+r.token {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="fake-registry"`, r.server.URL))
+		registryError(w, http.StatusUnauthorized, "UNAUTHORIZED", "authentication required")
+		return
+	}
+
+	path := strings.TrimPrefix(req.URL.Path, "/v2/")
+	switch {
+	case strings.Contains(path, "/manifests/"):
+		repo, ref, _ := strings.Cut(path, "/manifests/")
+		r.serveManifest(w, req, repo, ref)
+	case strings.Contains(path, "/blobs/uploads/"):
+		repo, id, _ := strings.Cut(path, "/blobs/uploads/")
+		r.serveUpload(w, req, repo, id)
+	case strings.Contains(path, "/blobs/"):
+		repo, digest, _ := strings.Cut(path, "/blobs/")
+		r.serveBlob(w, req, repo, digest)
+	default:
+		registryError(w, http.StatusNotFound, "NAME_UNKNOWN", "unknown endpoint")
+	}
+}
+
+// serveToken 签发令牌
+func (r *fakeRegistry) serveToken(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	r.tokenRequests = append(r.tokenRequests, req.URL.Query())
+	r.mu.Unlock()
+
+	if r.username != "" {
+		username, password, ok := req.BasicAuth()
+		if !ok || username != r.username || password != r.password {
+			http.Error(w, "invalid credentials", http.StatusUnauthorized)
+			return
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]string{"token": r.token})
+}
+
+// serveManifest 获取或推送清单
+// 推送时检查清单引用的blob和子清单都已存在，与真实仓库一致。
+func (r *fakeRegistry) serveManifest(w http.ResponseWriter, req *http.Request, repo, ref string) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		m, ok := r.manifest(repo, ref)
+		if !ok {
+			registryError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest unknown")
+			return
+		}
+		w.Header().Set("Content-Type", m.mediaType)
+		w.Header().Set("Docker-Content-Digest", Digest(m.body))
+		w.Header().Set("Content-Length", fmt.Sprint(len(m.body)))
+		if req.Method == http.MethodGet {
+			w.Write(m.body)
+		}
+
+	case http.MethodPut:
+		body, _ := io.ReadAll(req.Body)
+		digest := Digest(body)
+		if strings.HasPrefix(ref, "sha256:") && ref != digest {
+			registryError(w, http.StatusBadRequest, "DIGEST_INVALID", "manifest digest does not match")
+			return
+		}
+		mediaType := req.Header.Get("Content-Type")
+		if IsIndex(mediaType) {
+			var index Index
+			json.Unmarshal(body, &index)
+			for _, desc := range index.Manifests {
+				if _, ok := r.manifest(repo, desc.Digest); !ok {
+					registryError(w, http.StatusBadRequest, "MANIFEST_UNKNOWN", "unknown child manifest "+desc.Digest)
+					return
+				}
+			}
+		} else {
+			var manifest Manifest
+			json.Unmarshal(body, &manifest)
+			for _, desc := range append([]Descriptor{manifest.Config}, manifest.Layers...) {
+				if !r.hasBlob(repo, desc.Digest) {
+					registryError(w, http.StatusBadRequest, "MANIFEST_BLOB_UNKNOWN", "unknown blob "+desc.Digest)
+					return
+				}
+			}
+		}
+
+		r.addManifest(repo, ref, mediaType, body)
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.WriteHeader(http.StatusCreated)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// serveBlob 获取blob
+func (r *fakeRegistry) serveBlob(w http.ResponseWriter, req *http.Request, repo, digest string) {
+	r.mu.Lock()
+	data, ok := r.blobs[repo+"@"+digest]
+	r.mu.Unlock()
+	if !ok {
+		registryError(w, http.StatusNotFound, "BLOB_UNKNOWN", "blob unknown")
+		return
+	}
+
+	w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+	w.Header().Set("Docker-Content-Digest", digest)
+	switch {
+	case req.Method == http.MethodHead:
+	case r.sendBlob != nil:
+		r.sendBlob(w, data)
+	default:
+		w.Write(data)
+	}
+}
+
+// serveUpload 处理挂载和单次PUT上传
+func (r *fakeRegistry) serveUpload(w http.ResponseWriter, req *http.Request, repo, id string) {
+	switch {
+	case req.Method == http.MethodPost && id == "":
+		query := req.URL.Query()
+		if digest, from := query.Get("mount"), query.Get("from"); digest != "" && !r.noMount {
+			r.mu.Lock()
+			data, ok := r.blobs[from+"@"+digest]
+			if ok {
+				r.blobs[repo+"@"+digest] = data
+			}
+			r.mu.Unlock()
+			if ok {
+				w.Header().Set("Location", "/v2/"+repo+"/blobs/"+digest)
+				w.WriteHeader(http.StatusCreated)
+				return
+			}
+		}
+
+		r.mu.Lock()
+		id = fmt.Sprintf("upload-%d", len(r.uploads)+1)
+		r.uploads[id] = repo
+		r.mu.Unlock()
+		w.Header().Set("Location", "/v2/"+repo+"/blobs/uploads/"+id+"?state=opaque")
+		w.WriteHeader(http.StatusAccepted)
+
+	case req.Method == http.MethodPut:
+		r.mu.Lock()
+		uploadRepo, ok := r.uploads[id]
+		r.mu.Unlock()
+		if !ok || uploadRepo != repo || req.URL.Query().Get("state") != "opaque" {
+			registryError(w, http.StatusNotFound, "BLOB_UPLOAD_UNKNOWN", "upload unknown")
+			return
+		}
+
+		var data []byte
+		var err error
+		if r.receiveBlob != nil {
+			data, err = r.receiveBlob(req.Body)
+		} else {
+			data, err = io.ReadAll(req.Body)
+		}
+		if err != nil {
+			registryError(w, http.StatusBadRequest, "BLOB_UPLOAD_INVALID", err.Error())
+			return
+		}
+		digest := req.URL.Query().Get("digest")
+		if Digest(data) != digest {
+			registryError(w, http.StatusBadRequest, "DIGEST_INVALID", "blob digest does not match")
+			return
+		}
+
+		r.mu.Lock()
+		r.blobs[repo+"@"+digest] = data
+		delete(r.uploads, id)
+		r.mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+
+	case req.Method == http.MethodDelete:
+		r.mu.Lock()
+		delete(r.uploads, id)
+		r.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// registryError 以Distribution规范的格式返回错误
+func registryError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `{"errors":[{"code":%q,"message":%q}]}`, code, message)
+}
+
+func TestFetchImageBearerToken(t *testing.T) {
+	reg := newFakeRegistry(t)
+	reg.token = "secret-token"
+	reg.username, reg.password = "user", "pass"
+	want := reg.addImage(t, "team/app", "v1", Platform{OS: "linux", Architecture: "amd64"}, "layer-1", "layer-2")
+
+	client := NewRegistryClient(WithCredentials(func(registry string) (string, string) {
+		if registry != reg.host {
+			t.Errorf("credentials requested for %q, want %q", registry, reg.host)
+		}
+		return "user", "pass"
+	}))
+	img, err := client.FetchImage(context.Background(), reg.host, "team/app", "v1", Platform{OS: "linux", Architecture: "amd64"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Digest != want.Digest || len(img.Manifest.Layers) != 2 {
+		t.Errorf("FetchImage() digest = %s with %d layers, want %s with 2 layers", img.Digest, len(img.Manifest.Layers), want.Digest)
+	}
+
+	// 令牌按权限范围缓存，清单和配置只需要获取一次
+	if len(reg.tokenRequests) != 1 {
+		t.Fatalf("token requested %d times, want 1", len(reg.tokenRequests))
+	}
+	query := reg.tokenRequests[0]
+	if query.Get("service") != "fake-registry" || query.Get("scope") != "repository:team/app:pull" {
+		t.Errorf("token request = %v, want service=fake-registry scope=repository:team/app:pull", query)
+	}
+}
+
+func TestFetchImageBadCredentials(t *testing.T) {
+	reg := newFakeRegistry(t)
+	reg.token = "secret-token"
+	reg.username, reg.password = "user", "pass"
+	reg.addImage(t, "app", "v1", Platform{OS: "linux", Architecture: "amd64"}, "layer")
+
+	client := NewRegistryClient(WithCredentials(func(string) (string, string) { return "user", "wrong" }))
+	_, err := client.FetchImage(context.Background(), reg.host, "app", "v1", Platform{OS: "linux", Architecture: "amd64"})
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("FetchImage() error = %v, want ErrUnauthorized", err)
+	}
+}
+
+func TestFetchImagePlatform(t *testing.T) {
+	reg := newFakeRegistry(t)
+	amd64 := reg.addImage(t, "app", "", Platform{OS: "linux", Architecture: "amd64"}, "amd64")
+	arm64 := reg.addImage(t, "app", "", Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}, "arm64")
+	armv7 := reg.addImage(t, "app", "", Platform{OS: "linux", Architecture: "arm", Variant: "v7"}, "armv7")
+	reg.addIndex(t, "app", "latest", amd64, arm64, armv7)
+
+	tests := []struct {
+		platform string
+		want     string
+	}{
+		{"linux/amd64", amd64.Digest},
+		{"linux/arm64", arm64.Digest},
+		{"linux/arm64/v8", arm64.Digest},
+		{"linux/arm", armv7.Digest},
+		{"linux/arm/v7", armv7.Digest},
+	}
+
+	client := NewRegistryClient()
+	for _, tt := range tests {
+		t.Run(tt.platform, func(t *testing.T) {
+			platform, err := ParsePlatform(tt.platform)
+			if err != nil {
+				t.Fatal(err)
+			}
+			img, err := client.FetchImage(context.Background(), reg.host, "app", "latest", platform)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if img.Digest != tt.want {
+				t.Errorf("FetchImage(%s) digest = %s, want %s", tt.platform, img.Digest, tt.want)
+			}
+			var config Platform
+			if err := json.Unmarshal(img.Config, &config); err != nil {
+				t.Fatal(err)
+			}
+			if !platform.Matches(config) {
+				t.Errorf("FetchImage(%s) returned config for %s", tt.platform, config)
+			}
+		})
+	}
+
+	for _, platform := range []string{"linux/s390x", "linux/arm/v6", "windows/amd64"} {
+		t.Run(platform+" missing", func(t *testing.T) {
+			p, _ := ParsePlatform(platform)
+			_, err := client.FetchImage(context.Background(), reg.host, "app", "latest", p)
+			if !errors.Is(err, ErrPlatformNotFound) {
+				t.Errorf("FetchImage(%s) error = %v, want ErrPlatformNotFound", platform, err)
+			}
+		})
+	}
+}
+
+func TestFetchImageDigestMismatch(t *testing.T) {
+	platform := Platform{OS: "linux", Architecture: "amd64"}
+
+	t.Run("manifest", func(t *testing.T) {
+		reg := newFakeRegistry(t)
+		desc := reg.addImage(t, "app", "v1", platform, "layer")
+		reg.corruptManifest("app", desc.Digest)
+
+		_, err := NewRegistryClient().FetchImage(context.Background(), reg.host, "app", desc.Digest, platform)
+		if !errors.Is(err, ErrDigestMismatch) {
+			t.Errorf("FetchImage() error = %v, want ErrDigestMismatch", err)
+		}
+	})
+
+	t.Run("platform manifest", func(t *testing.T) {
+		reg := newFakeRegistry(t)
+		desc := reg.addImage(t, "app", "", platform, "layer")
+		reg.addIndex(t, "app", "v1", desc)
+		reg.corruptManifest("app", desc.Digest)
+
+		_, err := NewRegistryClient().FetchImage(context.Background(), reg.host, "app", "v1", platform)
+		if !errors.Is(err, ErrDigestMismatch) {
+			t.Errorf("FetchImage() error = %v, want ErrDigestMismatch", err)
+		}
+	})
+
+	t.Run("config", func(t *testing.T) {
+		reg := newFakeRegistry(t)
+		desc := reg.addImage(t, "app", "v1", platform, "layer")
+		m, _ := reg.manifest("app", desc.Digest)
+		var manifest Manifest
+		json.Unmarshal(m.body, &manifest)
+		reg.corruptBlob("app", manifest.Config.Digest)
+
+		_, err := NewRegistryClient().FetchImage(context.Background(), reg.host, "app", "v1", platform)
+		if !errors.Is(err, ErrDigestMismatch) {
+			t.Errorf("FetchImage() error = %v, want ErrDigestMismatch", err)
+		}
+	})
+
+	t.Run("layer", func(t *testing.T) {
+		reg := newFakeRegistry(t)
+		reg.addImage(t, "app", "v1", platform, "layer")
+		client := NewRegistryClient()
+		img, err := client.FetchImage(context.Background(), reg.host, "app", "v1", platform)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reg.corruptBlob("app", img.Manifest.Layers[0].Digest)
+
+		err = client.WriteDockerArchive(context.Background(), img, io.Discard, "app:v1")
+		if !errors.Is(err, ErrDigestMismatch) {
+			t.Errorf("WriteDockerArchive() error = %v, want ErrDigestMismatch", err)
+		}
+		err = client.WriteOCILayout(context.Background(), img, t.TempDir(), "app:v1")
+		if !errors.Is(err, ErrDigestMismatch) {
+			t.Errorf("WriteOCILayout() error = %v, want ErrDigestMismatch", err)
+		}
+	})
+}
+
+func TestParseChallenge(t *testing.T) {
+	scheme, params := parseChallenge(`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/nginx:pull,push"`)
+	if scheme != "Bearer" {
+		t.Errorf("scheme = %q, want Bearer", scheme)
+	}
+	want := map[string]string{
+		"realm":   "https://auth.docker.io/token",
+		"service": "registry.docker.io",
+		"scope":   "repository:library/nginx:pull,push",
+	}
+	for key, value := range want {
+		if params[key] != value {
+			t.Errorf("params[%q] = %q, want %q", key, params[key], value)
+		}
+	}
+}
+
+func TestNewRegistryClientDefaultTransport(t *testing.T) {
+	client := NewRegistryClient()
+	transport, ok := client.httpClient.Transport.(*http.Transport)
+	if !ok {
+		t.Fatalf("default transport is %T, want *http.Transport", client.httpClient.Transport)
+	}
+	// 默认客户端读取代理环境变量，并设置等待响应头的超时
+	if transport.Proxy == nil || transport.DialContext == nil {
+		t.Error("default transport has no proxy or dialer")
+	}
+	if transport.ResponseHeaderTimeout != registryResponseHeaderTimeout {
+		t.Errorf("ResponseHeaderTimeout = %s, want %s", transport.ResponseHeaderTimeout, registryResponseHeaderTimeout)
+	}
+	if client.httpClient == http.DefaultClient || transport == http.DefaultTransport {
+		t.Error("default client shares the global http.DefaultClient")
+	}
+
+	custom := &http.Client{}
+	if got := NewRegistryClient(WithHTTPClient(custom)).httpClient; got != custom {
+		t.Error("WithHTTPClient did not replace the default client")
+	}
+}
@@ -1,74 +1,283 @@
 package yamlparser
 
 import (
+	"context"
 	"fmt"
-	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 
-	"gopkg.in/yaml.v2"
+	"github.com/compose-spec/compose-go/v2/cli"
+	"github.com/compose-spec/compose-go/v2/loader"
+	"github.com/compose-spec/compose-go/v2/types"
+	"gopkg.in/yaml.v3"
 )
 
-// ComposeConfig docker-compose.yaml配置结构
-type ComposeConfig struct {
-	Version  string                 `yaml:"version"`
-	Services map[string]ServiceConfig `yaml:"services"`
+// composeProjectName 从内容解析Compose时使用的项目名称
+const composeProjectName = "image-shipper"
+
+// ComposeImages Compose项目中的镜像
+type ComposeImages struct {
+	// Images 需要从仓库拉取的镜像，按服务名排序
+	Images []FoundImage
+	// Builds 需要在本地构建镜像的服务，构建结果不包含在Images中
+	Builds []ComposeBuild
 }
 
-// ServiceConfig docker-compose服务配置
-type ServiceConfig struct {
-	Image string `yaml:"image"`
-	Build string `yaml:"build"`
+// ComposeBuild 需要构建镜像的服务
+type ComposeBuild struct {
+	Service string
+	// ContainerName 服务的container_name，未设置时为空
+	ContainerName string
+	// Image 构建结果的镜像名称，服务未设置image时为空
+	Image string
+	// Context 构建上下文
+	Context string
+	// Dockerfile 相对于构建上下文的Dockerfile路径，使用dockerfile_inline时为空
+	Dockerfile string
+	// DockerfileInline dockerfile_inline中的Dockerfile内容
+	DockerfileInline string
+	// Args 构建参数，只包含设置了值的参数
+	Args map[string]string
+	// Target 构建的目标阶段
+	Target string
 }
 
-// ParseComposeFile 解析docker-compose.yaml文件并提取所有镜像
-func ParseComposeFile(filePath string) ([]string, error) {
-	// 读取文件内容
-	data, err := ioutil.ReadFile(filePath)
+// LoadComposeFiles 按Compose规范加载一组Compose文件
+// 多个文件按顺序合并，与 docker compose -f a.yaml -f b.yaml 相同；支持 include、extends，
+// 使用系统环境变量和项目目录下的 .env 进行 ${VAR:-default} 插值。
+// profiles为空时读取 COMPOSE_PROFILES 环境变量，未启用的profile中的服务会被忽略。
+func LoadComposeFiles(files []string, profiles []string) (*ComposeImages, error) {
+	options, err := cli.NewProjectOptions(files,
+		cli.WithOsEnv,
+		cli.WithEnvFiles(),
+		cli.WithDotEnv,
+		cli.WithDefaultProfiles(profiles...),
+	)
 	if err != nil {
-		return nil, fmt.Errorf("无法读取文件 %s: %w", filePath, err)
+		return nil, fmt.Errorf("无法加载Compose文件: %w", err)
 	}
 
-	// 解析YAML
-	var config ComposeConfig
-	err = yaml.Unmarshal(data, &config)
+	project, err := options.LoadProject(context.Background())
 	if err != nil {
-		return nil, fmt.Errorf("解析YAML文件失败: %w", err)
+		return nil, fmt.Errorf("解析Compose文件失败: %w", err)
 	}
 
-	// 提取镜像
-	images := []string{}
-	for serviceName, service := range config.Services {
-		// 如果服务有image字段，则提取镜像
-		if service.Image != "" {
-			images = append(images, service.Image)
-		} else if service.Build != "" {
-			// 如果服务是构建的，则忽略
-			fmt.Printf("服务 %s 是构建的，跳过\n", serviceName)
-		}
-	}
+	result := composeImages(project)
+	locateComposeImages(result.Images, files)
+	return result, nil
+}
+
+// ParseComposeFile 解析docker-compose.yaml文件并提取所有镜像
+func ParseComposeFile(filePath string) ([]FoundImage, error) {
+	return parseComposeFiles([]string{filePath}, ParseOptions{})
+}
 
-	return images, nil
+// parseComposeFiles 加载Compose文件并提取需要拉取的镜像，构建镜像的服务单独列出
+func parseComposeFiles(files []string, opts ParseOptions) ([]FoundImage, error) {
+	result, err := LoadComposeFiles(files, opts.Profiles)
+	if err != nil {
+		return nil, err
+	}
+	return append(result.Images, composeBuildImages(result.Builds, files[0])...), nil
 }
 
 // ParseComposeContent 解析docker-compose.yaml内容并提取所有镜像
-func ParseComposeContent(content string) ([]string, error) {
-	// 解析YAML
-	var config ComposeConfig
-	err := yaml.Unmarshal([]byte(content), &config)
+// 相对路径（include、extends、env_file等）以当前工作目录为基准。
+func ParseComposeContent(content string) ([]FoundImage, error) {
+	return ParseComposeContentWithOptions(content, ParseOptions{})
+}
+
+// ParseComposeContentWithOptions 按指定选项解析docker-compose.yaml内容，profile的处理与LoadComposeFiles相同
+func ParseComposeContentWithOptions(content string, opts ParseOptions) ([]FoundImage, error) {
+	workingDir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	project, err := loader.LoadWithContext(context.Background(), types.ConfigDetails{
+		WorkingDir:  workingDir,
+		ConfigFiles: []types.ConfigFile{{Filename: "compose.yaml", Content: []byte(content)}},
+		Environment: types.NewMapping(os.Environ()),
+	}, func(o *loader.Options) {
+		o.SetProjectName(composeProjectName, false)
+		o.Profiles = composeProfiles(opts.Profiles)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("解析YAML内容失败: %w", err)
 	}
 
-	// 提取镜像
-	images := []string{}
-	for serviceName, service := range config.Services {
-		// 如果服务有image字段，则提取镜像
+	result := composeImages(project)
+	nodes := composeImageNodes([]byte(content))
+	for i := range result.Images {
+		if node, ok := nodes[result.Images[i].Name]; ok {
+			result.Images[i].Line = node.Line
+			result.Images[i].Column = node.Column
+		}
+	}
+	return append(result.Images, composeBuildImages(result.Builds, "")...), nil
+}
+
+// composeProfiles 返回启用的profile，未指定时读取 COMPOSE_PROFILES 环境变量
+func composeProfiles(profiles []string) []string {
+	if len(profiles) > 0 {
+		return profiles
+	}
+	for _, profile := range strings.Split(os.Getenv("COMPOSE_PROFILES"), ",") {
+		if profile = strings.TrimSpace(profile); profile != "" {
+			profiles = append(profiles, profile)
+		}
+	}
+	return profiles
+}
+
+// composeImages 区分项目中拉取的镜像和构建的镜像
+func composeImages(project *types.Project) *ComposeImages {
+	names := make([]string, 0, len(project.Services))
+	for name := range project.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := &ComposeImages{Images: []FoundImage{}}
+	for _, name := range names {
+		service := project.Services[name]
+		if service.Build != nil {
+			// 同时设置image时，image是构建结果的名称，不需要从仓库拉取
+			args := map[string]string{}
+			for key, value := range service.Build.Args {
+				if value != nil {
+					args[key] = *value
+				}
+			}
+			result.Builds = append(result.Builds, ComposeBuild{
+				Service:          name,
+				ContainerName:    service.ContainerName,
+				Image:            service.Image,
+				Context:          service.Build.Context,
+				Dockerfile:       service.Build.Dockerfile,
+				DockerfileInline: service.Build.DockerfileInline,
+				Args:             args,
+				Target:           service.Build.Target,
+			})
+			continue
+		}
 		if service.Image != "" {
-			images = append(images, service.Image)
-		} else if service.Build != "" {
-			// 如果服务是构建的，则忽略
-			fmt.Printf("服务 %s 是构建的，跳过\n", serviceName)
+			result.Images = append(result.Images, FoundImage{Image: service.Image, Name: name, Container: service.ContainerName})
 		}
 	}
+	return result
+}
+
+// locateComposeImages 查找每个服务的image字段所在的文件和位置
+// 多个文件中都设置了image时以最后一个为准，与合并规则一致；来自include或extends的服务只记录第一个文件。
+func locateComposeImages(images []FoundImage, files []string) {
+	nodes := make([]map[string]*yaml.Node, len(files))
+	for i, file := range files {
+		if data, err := os.ReadFile(file); err == nil {
+			nodes[i] = composeImageNodes(data)
+		}
+	}
+
+	for i := range images {
+		images[i].File = files[0]
+		for j := len(files) - 1; j >= 0; j-- {
+			if node, ok := nodes[j][images[i].Name]; ok {
+				images[i].File = files[j]
+				images[i].Line = node.Line
+				images[i].Column = node.Column
+				break
+			}
+		}
+	}
+}
+
+// composeImageNodes 返回Compose文件中每个服务的image字段值，键为服务名
+func composeImageNodes(content []byte) map[string]*yaml.Node {
+	nodes := map[string]*yaml.Node{}
+	for _, service := range composeServiceNodes(content) {
+		if image := mappingValue(service.Node, "image"); image != nil && image.Kind == yaml.ScalarNode {
+			nodes[service.Name] = image
+		}
+	}
+	return nodes
+}
+
+// composeServiceNode Compose文件中的单个服务
+type composeServiceNode struct {
+	Name string
+	Node *yaml.Node
+}
 
-	return images, nil
+// composeServiceNodes 按文件中的顺序返回services下的所有服务，内容不是Compose文件时返回nil
+func composeServiceNodes(content []byte) []composeServiceNode {
+	var root yaml.Node
+	if err := yaml.Unmarshal(content, &root); err != nil || len(root.Content) == 0 {
+		return nil
+	}
+
+	services := mappingValue(root.Content[0], "services")
+	if services == nil || services.Kind != yaml.MappingNode {
+		return nil
+	}
+	var result []composeServiceNode
+	for i := 0; i+1 < len(services.Content); i += 2 {
+		result = append(result, composeServiceNode{Name: services.Content[i].Value, Node: services.Content[i+1]})
+	}
+	return result
+}
+
+// printComposeBuild 列出需要构建镜像的服务，构建结果不需要从仓库拉取
+func printComposeBuild(build ComposeBuild) {
+	if build.Image != "" {
+		fmt.Printf("服务 %s 需要构建镜像 %s（上下文 %s），只提取Dockerfile中的基础镜像\n", build.Service, build.Image, build.Context)
+	} else {
+		fmt.Printf("服务 %s 需要构建镜像（上下文 %s），只提取Dockerfile中的基础镜像\n", build.Service, build.Context)
+	}
+}
+
+// composeBuildImages 列出构建镜像的服务，并提取其Dockerfile中引用的基础镜像
+// 构建参数和目标阶段与 docker compose build 一致；远程构建上下文和无法读取的Dockerfile给出提示后跳过。
+// 基础镜像的Name和Container为所属的服务；dockerfile_inline中的镜像记录在composeFile中，没有行号。
+func composeBuildImages(builds []ComposeBuild, composeFile string) []FoundImage {
+	var images []FoundImage
+	for _, build := range builds {
+		printComposeBuild(build)
+		name := build.Service
+		if build.Image != "" {
+			name = fmt.Sprintf("%s（%s）", build.Service, build.Image)
+		}
+
+		var found []FoundImage
+		if build.DockerfileInline != "" {
+			inline, err := parseDockerfileContent(build.DockerfileInline, "", build.Args, build.Target)
+			if err != nil {
+				fmt.Printf("警告: 服务 %s 的dockerfile_inline无法解析: %v，跳过\n", name, err)
+				continue
+			}
+			found = renderedImages(inline, composeFile)
+		} else {
+			if strings.Contains(build.Context, "://") || strings.HasPrefix(build.Context, "git@") {
+				fmt.Printf("服务 %s 使用远程构建上下文 %s，跳过\n", name, build.Context)
+				continue
+			}
+			dockerfile := build.Dockerfile
+			if !filepath.IsAbs(dockerfile) {
+				dockerfile = filepath.Join(build.Context, dockerfile)
+			}
+			var err error
+			found, err = parseDockerfile(dockerfile, build.Args, build.Target)
+			if err != nil {
+				fmt.Printf("警告: 服务 %s 的Dockerfile无法解析: %v，跳过\n", name, err)
+				continue
+			}
+		}
+		for i := range found {
+			found[i].Name = build.Service
+			found[i].Container = build.ContainerName
+		}
+		images = append(images, found...)
+	}
+	return images
 }
@@ -0,0 +1,239 @@
+package yamlparser
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// composeImage Compose测试中比较的字段
+type composeImage struct {
+	Image     string
+	File      string
+	Kind      string
+	Name      string
+	Container string
+	Line      int
+	Column    int
+}
+
+// wantComposeImages 按顺序比较镜像记录，File为空时不比较
+func wantComposeImages(t *testing.T, got []FoundImage, want []composeImage) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("found %d images, want %d:\n%s", len(got), len(want), formatImages(got))
+	}
+	for i, w := range want {
+		g := got[i]
+		if g.Image != w.Image || (w.File != "" && g.File != w.File) || g.Kind != w.Kind || g.Name != w.Name ||
+			g.Container != w.Container || g.Line != w.Line || g.Column != w.Column {
+			t.Errorf("image %d:\n got %+v\nwant %+v", i, g, w)
+		}
+	}
+}
+
+func TestLoadComposeFiles(t *testing.T) {
+	base := filepath.Join("testdata", "compose", "compose.yaml")
+	prod := filepath.Join("testdata", "compose", "compose.prod.yaml")
+
+	tests := []struct {
+		name     string
+		files    []string
+		profiles []string
+		env      map[string]string
+		want     []composeImage
+	}{
+		{
+			// .env中的变量参与插值，include和extends的服务没有对应的image字段，只记录第一个文件
+			name:  "single file",
+			files: []string{base},
+			want: []composeImage{
+				{Image: "ghcr.io/example/api:1.0", File: base, Name: "api", Line: 12, Column: 12},
+				{Image: "redis:7", File: base, Name: "cache"},
+				{Image: "nginx:1.27", File: base, Name: "proxy", Line: 14, Column: 12},
+				{Image: "python:3.12-alpine", File: base, Name: "worker", Container: "shop-worker"},
+			},
+		},
+		{
+			// 后面的文件覆盖前面的文件，位置指向最后设置image的文件
+			name:  "override file",
+			files: []string{base, prod},
+			want: []composeImage{
+				{Image: "ghcr.io/example/api:2.0", File: prod, Name: "api", Line: 4, Column: 12},
+				{Image: "redis:7", File: base, Name: "cache"},
+				{Image: "nginx:1.27", File: base, Name: "proxy", Line: 14, Column: 12},
+				{Image: "python:3.12-alpine", File: base, Name: "worker", Container: "shop-worker"},
+			},
+		},
+		{
+			// 环境变量优先于.env
+			name:  "environment",
+			files: []string{base},
+			env:   map[string]string{"NGINX_TAG": "1.28", "API_TAG": "1.1"},
+			want: []composeImage{
+				{Image: "ghcr.io/example/api:1.1", File: base, Name: "api", Line: 12, Column: 12},
+				{Image: "redis:7", File: base, Name: "cache"},
+				{Image: "nginx:1.28", File: base, Name: "proxy", Line: 14, Column: 12},
+				{Image: "python:3.12-alpine", File: base, Name: "worker", Container: "shop-worker"},
+			},
+		},
+		{
+			name:     "profile",
+			files:    []string{base, prod},
+			profiles: []string{"debug"},
+			want: []composeImage{
+				{Image: "ghcr.io/example/api:2.0", File: prod, Name: "api", Line: 4, Column: 12},
+				{Image: "redis:7", File: base, Name: "cache"},
+				{Image: "busybox:1.36", File: base, Name: "debug", Line: 22, Column: 12},
+				{Image: "nginx:1.27", File: base, Name: "proxy", Line: 14, Column: 12},
+				{Image: "python:3.12-alpine", File: base, Name: "worker", Container: "shop-worker"},
+			},
+		},
+		{
+			name:  "COMPOSE_PROFILES",
+			files: []string{base},
+			env:   map[string]string{"COMPOSE_PROFILES": "debug"},
+			want: []composeImage{
+				{Image: "ghcr.io/example/api:1.0", File: base, Name: "api", Line: 12, Column: 12},
+				{Image: "redis:7", File: base, Name: "cache"},
+				{Image: "busybox:1.36", File: base, Name: "debug", Line: 22, Column: 12},
+				{Image: "nginx:1.27", File: base, Name: "proxy", Line: 14, Column: 12},
+				{Image: "python:3.12-alpine", File: base, Name: "worker", Container: "shop-worker"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("COMPOSE_PROFILES", "")
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			result, err := LoadComposeFiles(tt.files, tt.profiles)
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantComposeImages(t, result.Images, tt.want)
+
+			// 构建镜像的服务单独列出，image是构建结果的名称
+			if len(result.Builds) != 1 {
+				t.Fatalf("Builds = %+v, want web", result.Builds)
+			}
+			build := result.Builds[0]
+			if build.Service != "web" || build.Image != "shop/web:dev" || filepath.Base(build.Context) != "web" ||
+				build.Dockerfile != "Dockerfile" || build.Args["GO_VERSION"] != "1.24" {
+				t.Errorf("Builds[0] = %+v", build)
+			}
+		})
+	}
+}
+
+func TestParseComposeFileBuilds(t *testing.T) {
+	t.Setenv("COMPOSE_PROFILES", "")
+	file := filepath.Join("testdata", "compose", "compose.yaml")
+	images, err := ParseComposeFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 构建服务的基础镜像按构建参数展开，并记录所属的服务
+	dockerfile, err := filepath.Abs(filepath.Join("testdata", "compose", "web", "Dockerfile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantComposeImages(t, images, []composeImage{
+		{Image: "ghcr.io/example/api:1.0", File: file, Name: "api", Line: 12, Column: 12},
+		{Image: "redis:7", File: file, Name: "cache"},
+		{Image: "nginx:1.27", File: file, Name: "proxy", Line: 14, Column: 12},
+		{Image: "python:3.12-alpine", File: file, Name: "worker", Container: "shop-worker"},
+		{Image: "golang:1.24", File: dockerfile, Kind: "FROM", Name: "web", Line: 2, Column: 6},
+		{Image: "gcr.io/distroless/static:nonroot", File: dockerfile, Kind: "FROM", Name: "web", Line: 5, Column: 6},
+	})
+	if source := images[4].Source(); source != dockerfile+":2 (服务 web, FROM, 阶段 build)" {
+		t.Errorf("Source() = %q", source)
+	}
+}
+
+func TestParseComposeContent(t *testing.T) {
+	content := `services:
+  app:
+    image: 'registry.example.com/app:${APP_TAG:-1.0}'
+    container_name: app-1
+  tools:
+    image: alpine:3.19
+    profiles: ["tools"]
+  inline:
+    image: example/inline:dev
+    build:
+      dockerfile_inline: |
+        FROM node:22-alpine
+        COPY --from=busybox:1.36 /bin/sh /bin/sh
+`
+
+	tests := []struct {
+		name string
+		opts ParseOptions
+		env  map[string]string
+		want []composeImage
+	}{
+		{
+			name: "default",
+			want: []composeImage{
+				{Image: "registry.example.com/app:1.0", Name: "app", Container: "app-1", Line: 3, Column: 12},
+				{Image: "node:22-alpine", Kind: "FROM", Name: "inline"},
+				{Image: "busybox:1.36", Kind: "COPY --from", Name: "inline"},
+			},
+		},
+		{
+			name: "profile",
+			opts: ParseOptions{Profiles: []string{"tools"}},
+			env:  map[string]string{"APP_TAG": "2.0"},
+			want: []composeImage{
+				{Image: "registry.example.com/app:2.0", Name: "app", Container: "app-1", Line: 3, Column: 12},
+				{Image: "alpine:3.19", Name: "tools", Line: 6, Column: 12},
+				{Image: "node:22-alpine", Kind: "FROM", Name: "inline"},
+				{Image: "busybox:1.36", Kind: "COPY --from", Name: "inline"},
+			},
+		},
+		{
+			name: "COMPOSE_PROFILES",
+			env:  map[string]string{"COMPOSE_PROFILES": " tools , other"},
+			want: []composeImage{
+				{Image: "registry.example.com/app:1.0", Name: "app", Container: "app-1", Line: 3, Column: 12},
+				{Image: "alpine:3.19", Name: "tools", Line: 6, Column: 12},
+				{Image: "node:22-alpine", Kind: "FROM", Name: "inline"},
+				{Image: "busybox:1.36", Kind: "COPY --from", Name: "inline"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("COMPOSE_PROFILES", "")
+			t.Setenv("APP_TAG", "")
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			images, err := ParseComposeContentWithOptions(content, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, image := range images {
+				if image.File != "" {
+					t.Errorf("%s has file %q, want none for content", image.Image, image.File)
+				}
+			}
+			wantComposeImages(t, images, tt.want)
+		})
+	}
+}
+
+func TestComposeErrors(t *testing.T) {
+	if _, err := ParseComposeContent("services: [\n"); err == nil || !strings.Contains(err.Error(), "解析YAML内容失败") {
+		t.Errorf("ParseComposeContent() error = %v", err)
+	}
+	missing := filepath.Join(t.TempDir(), "compose.yaml")
+	if _, err := LoadComposeFiles([]string{missing}, nil); err == nil {
+		t.Error("LoadComposeFiles() of a missing file succeeded")
+	}
+}
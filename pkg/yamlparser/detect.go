@@ -0,0 +1,248 @@
+package yamlparser
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"sigs.k8s.io/kustomize/api/konfig"
+)
+
+// Confidence 文件类型判断的可信程度
+type Confidence int
+
+const (
+	// ConfidenceLow 只有文件名等间接线索
+	ConfidenceLow Confidence = iota
+	// ConfidenceMedium 内容大体符合，但存在不符合的部分
+	ConfidenceMedium
+	// ConfidenceHigh 内容中有明确的标志
+	ConfidenceHigh
+)
+
+// String 返回可信程度的描述
+func (c Confidence) String() string {
+	switch c {
+	case ConfidenceHigh:
+		return "高"
+	case ConfidenceMedium:
+		return "中"
+	default:
+		return "低"
+	}
+}
+
+// Detection 文件类型的判断结果
+type Detection struct {
+	Type       FileType
+	Confidence Confidence
+	// Reason 判断依据
+	Reason string
+}
+
+// String 返回判断结果的描述，如 k8s（置信度高：所有文档都包含apiVersion和kind）
+func (d Detection) String() string {
+	return fmt.Sprintf("%s（置信度%s：%s）", d.Type, d.Confidence, d.Reason)
+}
+
+// ParseFileType 解析 --type 参数指定的文件类型
+func ParseFileType(s string) (FileType, error) {
+	types := []FileType{FileTypeCompose, FileTypeK8s, FileTypeHelm, FileTypeKustomize, FileTypeDockerfile}
+	for _, fileType := range types {
+		if string(fileType) == s {
+			return fileType, nil
+		}
+	}
+	names := make([]string, len(types))
+	for i, fileType := range types {
+		names[i] = string(fileType)
+	}
+	return FileTypeUnknown, fmt.Errorf("不支持的文件类型 %q，可选: %s", s, strings.Join(names, ", "))
+}
+
+// DetectFileType 检测文件类型，判断依据见DetectFile
+func DetectFileType(filePath string) FileType {
+	return DetectFile(filePath).Type
+}
+
+// detectFile 返回解析时使用的类型：opts.Type指定了类型时直接使用（目录除外），否则按DetectFile判断
+func detectFile(filePath string, opts ParseOptions) Detection {
+	if opts.Type != "" && opts.Type != FileTypeUnknown {
+		if info, err := os.Stat(filePath); err != nil || !info.IsDir() {
+			return Detection{opts.Type, ConfidenceHigh, "--type 指定"}
+		}
+	}
+	return DetectFile(filePath)
+}
+
+// detectContent 返回解析标准输入或URL内容时使用的类型
+func detectContent(content []byte, opts ParseOptions) Detection {
+	if opts.Type != "" && opts.Type != FileTypeUnknown {
+		return Detection{opts.Type, ConfidenceHigh, "--type 指定"}
+	}
+	return DetectContent(content)
+}
+
+// reportDetection 将判断结果通知调用方，只能按文件名判断时给出警告
+func reportDetection(name string, detection Detection, opts ParseOptions) {
+	if opts.OnDetect != nil {
+		opts.OnDetect(name, detection)
+	}
+	if detection.Type != FileTypeUnknown && detection.Confidence == ConfidenceLow {
+		fmt.Printf("警告: %s 的内容中没有明确的类型标志，根据%s按 %s 解析，如不正确请使用 --type 指定\n", name, detection.Reason, detection.Type)
+	}
+}
+
+// DetectFile 根据路径和内容判断文件类型
+// Helm Chart和kustomization由目录结构和固定的文件名确定，Dockerfile由文件名和指令确定，
+// YAML文件按内容判断：包含apiVersion和kind的是Kubernetes清单，顶层有services的是Compose文件。
+// 内容中没有明确标志时才参考文件名，此时置信度为低。
+func DetectFile(filePath string) Detection {
+	base := filepath.Base(filePath)
+	switch {
+	case base == chartutil.ChartfileName:
+		return Detection{FileTypeHelm, ConfidenceHigh, "Chart.yaml"}
+	case slices.Contains(konfig.RecognizedKustomizationFileNames(), base):
+		return Detection{FileTypeKustomize, ConfidenceHigh, "kustomization文件"}
+	case strings.HasSuffix(base, ".tgz") || strings.HasSuffix(base, ".tar.gz"):
+		return Detection{FileTypeHelm, ConfidenceMedium, "打包的Chart"}
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return Detection{FileTypeUnknown, ConfidenceLow, err.Error()}
+	}
+	if info.IsDir() {
+		if IsHelmChart(filePath) {
+			return Detection{FileTypeHelm, ConfidenceHigh, "目录中包含Chart.yaml"}
+		}
+		if IsKustomization(filePath) {
+			return Detection{FileTypeKustomize, ConfidenceHigh, "目录中包含kustomization文件"}
+		}
+		return Detection{FileTypeUnknown, ConfidenceLow, "普通目录"}
+	}
+
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return Detection{FileTypeUnknown, ConfidenceLow, err.Error()}
+	}
+	detection := DetectContent(content)
+
+	if isDockerfileName(base) {
+		if detection.Type == FileTypeDockerfile {
+			return Detection{FileTypeDockerfile, ConfidenceHigh, "Dockerfile文件名和FROM指令"}
+		}
+		return Detection{FileTypeDockerfile, ConfidenceMedium, "Dockerfile文件名"}
+	}
+	if detection.Type != FileTypeUnknown {
+		return detection
+	}
+
+	// 内容中没有明确的标志，退回到按文件名判断
+	lower := strings.ToLower(base)
+	if strings.Contains(lower, "compose") {
+		return Detection{FileTypeCompose, ConfidenceLow, "文件名包含compose"}
+	}
+	if strings.Contains(lower, "k8s") || strings.Contains(lower, "kubernetes") {
+		return Detection{FileTypeK8s, ConfidenceLow, "文件名包含k8s"}
+	}
+	return detection
+}
+
+// DetectContent 根据内容判断清单类型
+func DetectContent(content []byte) Detection {
+	if isDockerfileContent(content) {
+		return Detection{FileTypeDockerfile, ConfidenceMedium, "第一条指令为FROM"}
+	}
+
+	docs := splitYAML(string(content))
+	if len(docs) == 0 {
+		return Detection{FileTypeUnknown, ConfidenceLow, "内容为空"}
+	}
+
+	resources, composeDocs := 0, 0
+	composeConfident := false
+	for _, doc := range docs {
+		var root yaml.Node
+		if err := yaml.Unmarshal([]byte(doc.Content), &root); err != nil || len(root.Content) == 0 {
+			continue
+		}
+		top := root.Content[0]
+		if top.Kind != yaml.MappingNode {
+			continue
+		}
+
+		if scalarValue(mappingValue(top, "apiVersion")) != "" && scalarValue(mappingValue(top, "kind")) != "" {
+			// 名称不是kustomization.yaml的Kustomization无法单独构建，仍按普通资源处理
+			resources++
+			continue
+		}
+		if services := mappingValue(top, "services"); services != nil && services.Kind == yaml.MappingNode {
+			composeDocs++
+			composeConfident = composeConfident || looksLikeComposeServices(services)
+			continue
+		}
+	}
+
+	switch {
+	case resources > 0 && resources == len(docs):
+		return Detection{FileTypeK8s, ConfidenceHigh, "所有文档都包含apiVersion和kind"}
+	case resources > 0:
+		return Detection{FileTypeK8s, ConfidenceMedium, fmt.Sprintf("%d/%d 个文档包含apiVersion和kind", resources, len(docs))}
+	case composeDocs > 0 && composeConfident:
+		return Detection{FileTypeCompose, ConfidenceHigh, "顶层services中的服务包含image或build"}
+	case composeDocs > 0:
+		return Detection{FileTypeCompose, ConfidenceMedium, "顶层包含services"}
+	}
+	if bytes.Contains(content, []byte("{{")) {
+		return Detection{FileTypeUnknown, ConfidenceLow, "包含Helm模板语法，请指定Chart目录"}
+	}
+	return Detection{FileTypeUnknown, ConfidenceLow, "没有找到apiVersion、kind或services"}
+}
+
+// looksLikeComposeServices 判断services中是否有设置了image或build的服务
+func looksLikeComposeServices(services *yaml.Node) bool {
+	for i := 1; i < len(services.Content); i += 2 {
+		if mappingValue(services.Content[i], "image") != nil || mappingValue(services.Content[i], "build") != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// isDockerfileName 判断文件名是否为Dockerfile的常见命名，如 Dockerfile、Dockerfile.prod、app.Dockerfile、Containerfile
+func isDockerfileName(name string) bool {
+	lower := strings.ToLower(name)
+	for _, base := range []string{"dockerfile", "containerfile"} {
+		if lower == base || strings.HasPrefix(lower, base+".") || strings.HasSuffix(lower, "."+base) {
+			return true
+		}
+	}
+	return false
+}
+
+// isDockerfileContent 判断内容是否为Dockerfile：跳过注释、空行和ARG后，第一条指令是FROM
+func isDockerfileContent(content []byte) bool {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		switch strings.ToUpper(fields[0]) {
+		case "ARG":
+			continue
+		case "FROM":
+			return len(fields) > 1
+		}
+		return false
+	}
+	return false
+}
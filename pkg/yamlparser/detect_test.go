@@ -0,0 +1,209 @@
+package yamlparser
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	detectDeployment = "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\n"
+	detectCompose    = "services:\n  web:\n    image: nginx:1.25\n"
+	detectDockerfile = "# syntax=docker/dockerfile:1\nARG REGISTRY=docker.io\nARG TAG=3.19\n\nFROM ${REGISTRY}/alpine:${TAG}\nRUN apk add curl\n"
+	detectHelm       = "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: {{ .Release.Name }}\n  labels:\n    {{- include \"app.labels\" . | nindent 4 }}\n"
+)
+
+func TestDetectContent(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    string
+		want       FileType
+		confidence Confidence
+		reason     string
+	}{
+		{
+			name:       "kubernetes",
+			content:    "---\n" + detectDeployment + "---\napiVersion: v1\nkind: Service\nmetadata:\n  name: web\n",
+			want:       FileTypeK8s,
+			confidence: ConfidenceHigh,
+			reason:     "所有文档都包含apiVersion和kind",
+		},
+		{
+			name:       "kubernetes with other documents",
+			content:    detectDeployment + "---\nname: not-a-resource\n",
+			want:       FileTypeK8s,
+			confidence: ConfidenceMedium,
+			reason:     "1/2 个文档包含apiVersion和kind",
+		},
+		{
+			name:       "compose",
+			content:    detectCompose,
+			want:       FileTypeCompose,
+			confidence: ConfidenceHigh,
+			reason:     "顶层services中的服务包含image或build",
+		},
+		{
+			name:       "compose with build only",
+			content:    "services:\n  app:\n    build: .\n",
+			want:       FileTypeCompose,
+			confidence: ConfidenceHigh,
+		},
+		{
+			name:       "services without images",
+			content:    "services:\n  web:\n    ports: [\"80:80\"]\n",
+			want:       FileTypeCompose,
+			confidence: ConfidenceMedium,
+			reason:     "顶层包含services",
+		},
+		{
+			// services是序列时不是Compose文件
+			name:       "services list",
+			content:    "services:\n  - web\n",
+			want:       FileTypeUnknown,
+			confidence: ConfidenceLow,
+			reason:     "没有找到apiVersion、kind或services",
+		},
+		{
+			name:       "dockerfile with leading args",
+			content:    detectDockerfile,
+			want:       FileTypeDockerfile,
+			confidence: ConfidenceMedium,
+			reason:     "第一条指令为FROM",
+		},
+		{
+			name:       "instruction before FROM",
+			content:    "RUN echo hi\nFROM alpine\n",
+			want:       FileTypeUnknown,
+			confidence: ConfidenceLow,
+		},
+		{
+			name:       "helm template",
+			content:    detectHelm,
+			want:       FileTypeUnknown,
+			confidence: ConfidenceLow,
+			reason:     "包含Helm模板语法",
+		},
+		{
+			name:       "empty",
+			content:    "\n---\n# only a comment\n",
+			want:       FileTypeUnknown,
+			confidence: ConfidenceLow,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DetectContent([]byte(tt.content))
+			if got.Type != tt.want || got.Confidence != tt.confidence || !strings.Contains(got.Reason, tt.reason) {
+				t.Errorf("DetectContent() = %s, want %s with confidence %s and reason %q", got, tt.want, tt.confidence, tt.reason)
+			}
+		})
+	}
+}
+
+func TestDetectFile(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"composer-deploy.yaml":         detectDeployment,
+		"app.yaml":                     detectDeployment,
+		"docker-compose.yml":           detectCompose,
+		"k8s-compose.yaml":             detectCompose,
+		"compose.override.yaml":        "x-common: &common\n  restart: always\n",
+		"composer-values.yaml":         "replicaCount: 1\n",
+		"k8s-values.yaml":              "replicaCount: 1\n",
+		"values.yaml":                  "replicaCount: 1\n",
+		"Dockerfile":                   detectDockerfile,
+		"Dockerfile.prod":              "FROM golang:1.24\n",
+		"api.Dockerfile":               "# 没有指令\n",
+		"Containerfile":                "FROM alpine\n",
+		"build.docker":                 detectDockerfile,
+		"deployment.tpl.yaml":          detectHelm,
+		"Chart.yaml":                   "apiVersion: v2\nname: app\nversion: 0.1.0\n",
+		"kustomization.yaml":           "resources: []\n",
+		"chart/Chart.yaml":             "apiVersion: v2\nname: app\nversion: 0.1.0\n",
+		"chart/templates/service.yaml": detectHelm,
+		"overlay/kustomization.yml":    "resources: []\n",
+		"plain/readme.yaml":            "name: readme\n",
+		"packaged/app-0.1.0.tgz":       "not really a tarball",
+		"packaged/app-0.1.0.tar.gz":    "not really a tarball",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		path       string
+		want       FileType
+		confidence Confidence
+	}{
+		// 内容优先于文件名
+		{"composer-deploy.yaml", FileTypeK8s, ConfidenceHigh},
+		{"app.yaml", FileTypeK8s, ConfidenceHigh},
+		{"docker-compose.yml", FileTypeCompose, ConfidenceHigh},
+		{"k8s-compose.yaml", FileTypeCompose, ConfidenceHigh},
+		// 内容中没有标志时才按文件名判断
+		{"compose.override.yaml", FileTypeCompose, ConfidenceLow},
+		{"composer-values.yaml", FileTypeCompose, ConfidenceLow},
+		{"k8s-values.yaml", FileTypeK8s, ConfidenceLow},
+		{"values.yaml", FileTypeUnknown, ConfidenceLow},
+		{"Dockerfile", FileTypeDockerfile, ConfidenceHigh},
+		{"Dockerfile.prod", FileTypeDockerfile, ConfidenceHigh},
+		{"api.Dockerfile", FileTypeDockerfile, ConfidenceMedium},
+		{"Containerfile", FileTypeDockerfile, ConfidenceHigh},
+		{"build.docker", FileTypeDockerfile, ConfidenceMedium},
+		{"deployment.tpl.yaml", FileTypeUnknown, ConfidenceLow},
+		{"Chart.yaml", FileTypeHelm, ConfidenceHigh},
+		{"kustomization.yaml", FileTypeKustomize, ConfidenceHigh},
+		{"chart", FileTypeHelm, ConfidenceHigh},
+		{"overlay", FileTypeKustomize, ConfidenceHigh},
+		{"plain", FileTypeUnknown, ConfidenceLow},
+		{"packaged/app-0.1.0.tgz", FileTypeHelm, ConfidenceMedium},
+		{"packaged/app-0.1.0.tar.gz", FileTypeHelm, ConfidenceMedium},
+		{"missing.yaml", FileTypeUnknown, ConfidenceLow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got := DetectFile(filepath.Join(dir, filepath.FromSlash(tt.path)))
+			if got.Type != tt.want || got.Confidence != tt.confidence {
+				t.Errorf("DetectFile() = %s, want %s with confidence %s", got, tt.want, tt.confidence)
+			}
+		})
+	}
+}
+
+func TestDetectFileWithType(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.yaml")
+	if err := os.WriteFile(path, []byte(detectDeployment), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// --type 覆盖文件的判断结果，但不改变目录的判断
+	if got := detectFile(path, ParseOptions{Type: FileTypeCompose}); got.Type != FileTypeCompose || got.Confidence != ConfidenceHigh {
+		t.Errorf("detectFile(file, compose) = %s", got)
+	}
+	if got := detectFile(dir, ParseOptions{Type: FileTypeCompose}); got.Type != FileTypeUnknown {
+		t.Errorf("detectFile(dir, compose) = %s", got)
+	}
+	if got := detectContent([]byte(detectCompose), ParseOptions{Type: FileTypeK8s}); got.Type != FileTypeK8s {
+		t.Errorf("detectContent(compose, k8s) = %s", got)
+	}
+}
+
+func TestParseFileType(t *testing.T) {
+	for _, s := range []string{"compose", "k8s", "helm", "kustomize", "dockerfile"} {
+		if got, err := ParseFileType(s); err != nil || string(got) != s {
+			t.Errorf("ParseFileType(%q) = %s, %v", s, got, err)
+		}
+	}
+	if _, err := ParseFileType("kubernetes"); err == nil || !strings.Contains(err.Error(), "可选: compose, k8s, helm, kustomize, dockerfile") {
+		t.Errorf("ParseFileType(kubernetes) error = %v", err)
+	}
+}
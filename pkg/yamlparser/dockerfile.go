@@ -0,0 +1,382 @@
+package yamlparser
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// dockerfileKindFrom FROM指令中的基础镜像
+	dockerfileKindFrom = "FROM"
+	// dockerfileKindCopy COPY --from引用的镜像
+	dockerfileKindCopy = "COPY --from"
+	// dockerfileKindSyntax # syntax= 指定的前端镜像
+	dockerfileKindSyntax = "syntax"
+)
+
+var (
+	// dockerfileDirective 文件开头的解析器指令，如 # syntax=docker/dockerfile:1
+	dockerfileDirective = regexp.MustCompile(`^#\s*([a-zA-Z][a-zA-Z0-9]*)\s*=\s*(.+?)\s*$`)
+	// dockerfileHeredoc RUN、COPY等指令中的heredoc，如 <<EOF、<<-"EOF"
+	dockerfileHeredoc = regexp.MustCompile(`<<-?["']?([A-Za-z0-9_]+)["']?`)
+	// dockerfileVariable 变量引用：$NAME、${NAME}、${NAME:-默认值}、${NAME:+替换值}
+	dockerfileVariable = regexp.MustCompile(`\$(?:([A-Za-z_][A-Za-z0-9_]*)|\{([A-Za-z_][A-Za-z0-9_]*)(?:(:?[-+])([^}]*))?\})`)
+)
+
+// dockerfileToken 指令中的一个参数及其位置
+type dockerfileToken struct {
+	Value  string
+	Line   int
+	Column int
+}
+
+// dockerfileInstruction Dockerfile中的一条指令，续行已经合并
+type dockerfileInstruction struct {
+	// Command 大写的指令名
+	Command string
+	Args    []dockerfileToken
+	// Line 指令所在的第一行
+	Line int
+}
+
+// dockerfileStage 构建阶段及其引用的镜像
+type dockerfileStage struct {
+	Name   string
+	Images []FoundImage
+	// Depends 通过FROM或COPY --from引用的其他阶段的序号
+	Depends []int
+}
+
+// ParseDockerfile 解析Dockerfile并提取构建时需要拉取的镜像
+// 包括FROM中的基础镜像、COPY --from引用的镜像和 # syntax= 指定的前端镜像；对其他阶段的引用和scratch会被跳过。
+// 镜像中的变量按ARG的默认值展开，无法确定的镜像给出警告后跳过。
+func ParseDockerfile(filePath string) ([]FoundImage, error) {
+	return parseDockerfile(filePath, nil, "")
+}
+
+// parseDockerfile 按构建参数解析Dockerfile，target不为空时只提取该阶段依赖的镜像
+func parseDockerfile(filePath string, buildArgs map[string]string, target string) ([]FoundImage, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("无法读取文件 %s: %w", filePath, err)
+	}
+	images, err := parseDockerfileContent(string(content), filePath, buildArgs, target)
+	if err != nil {
+		return nil, fmt.Errorf("解析Dockerfile %s 失败: %w", filePath, err)
+	}
+	for i := range images {
+		images[i].File = filePath
+	}
+	return images, nil
+}
+
+// ParseDockerfileContent 解析Dockerfile内容并提取镜像，规则与ParseDockerfile相同
+func ParseDockerfileContent(content string) ([]FoundImage, error) {
+	return parseDockerfileContent(content, "", nil, "")
+}
+
+// parseDockerfileContent 按构建参数提取镜像，target不为空时只保留该阶段及其依赖的阶段，name只用于警告信息
+func parseDockerfileContent(content, name string, buildArgs map[string]string, target string) ([]FoundImage, error) {
+	directives, instructions := splitDockerfile(content)
+
+	var images []FoundImage
+	if syntax, ok := directives["syntax"]; ok {
+		images = append(images, FoundImage{Image: syntax.Value, Kind: dockerfileKindSyntax, Line: syntax.Line, Column: syntax.Column})
+	}
+
+	// FROM之前的ARG是全局参数，只能在FROM中使用；阶段内需要重新声明才能使用
+	globalArgs := map[string]string{}
+	var stageArgs map[string]string
+	var stages []dockerfileStage
+	for _, instruction := range instructions {
+		switch instruction.Command {
+		case "ARG":
+			if len(stages) == 0 {
+				declareArgs(globalArgs, instruction.Args, buildArgs, nil)
+			} else {
+				declareArgs(stageArgs, instruction.Args, buildArgs, globalArgs)
+			}
+
+		case "FROM":
+			args := withoutFlags(instruction.Args)
+			if len(args) == 0 {
+				return nil, fmt.Errorf("第 %d 行的FROM缺少镜像", instruction.Line)
+			}
+			stage := dockerfileStage{}
+			if len(args) >= 3 && strings.EqualFold(args[1].Value, "as") {
+				stage.Name = strings.ToLower(args[2].Value)
+			}
+			stageArgs = map[string]string{}
+
+			image, ok := expandDockerfileVars(args[0].Value, globalArgs)
+			switch {
+			case !ok:
+				fmt.Printf("警告: %s: 镜像 %s 包含无法确定的变量，跳过\n", dockerfileLocation(name, args[0].Line), args[0].Value)
+			case stageIndex(stages, image) >= 0:
+				stage.Depends = append(stage.Depends, stageIndex(stages, image))
+			case strings.EqualFold(image, "scratch"):
+			default:
+				stage.Images = append(stage.Images, FoundImage{Image: image, Kind: dockerfileKindFrom, Stage: stage.Name, Line: args[0].Line, Column: args[0].Column})
+			}
+			stages = append(stages, stage)
+
+		case "COPY":
+			if len(stages) == 0 {
+				continue
+			}
+			current := &stages[len(stages)-1]
+			for _, arg := range instruction.Args {
+				value, ok := strings.CutPrefix(arg.Value, "--from=")
+				if !ok {
+					continue
+				}
+				source, ok := expandDockerfileVars(value, stageArgs)
+				if !ok {
+					fmt.Printf("警告: %s: --from=%s 包含无法确定的变量，跳过\n", dockerfileLocation(name, arg.Line), value)
+					continue
+				}
+				if index := stageIndex(stages, source); index >= 0 {
+					current.Depends = append(current.Depends, index)
+					continue
+				}
+				current.Images = append(current.Images, FoundImage{
+					Image:  source,
+					Kind:   dockerfileKindCopy,
+					Stage:  current.Name,
+					Line:   arg.Line,
+					Column: arg.Column + utf8.RuneCountInString("--from="),
+				})
+			}
+		}
+	}
+
+	if len(stages) == 0 {
+		return nil, fmt.Errorf("没有找到FROM指令")
+	}
+
+	selected := make([]bool, len(stages))
+	if target == "" {
+		for i := range selected {
+			selected[i] = true
+		}
+	} else {
+		index := slices.IndexFunc(stages, func(stage dockerfileStage) bool { return stage.Name == strings.ToLower(target) })
+		if index < 0 {
+			return nil, fmt.Errorf("没有找到构建阶段 %s", target)
+		}
+		markStage(stages, index, selected)
+	}
+	for i, stage := range stages {
+		if selected[i] {
+			images = append(images, stage.Images...)
+		}
+	}
+	return images, nil
+}
+
+// isDockerfileKind 判断Kind是否为Dockerfile中引用镜像的指令
+func isDockerfileKind(kind string) bool {
+	return kind == dockerfileKindFrom || kind == dockerfileKindCopy || kind == dockerfileKindSyntax
+}
+
+// dockerfileLocation 返回警告中使用的位置，如 Dockerfile:3，没有文件名时为 第 3 行
+func dockerfileLocation(name string, line int) string {
+	if name == "" {
+		return fmt.Sprintf("第 %d 行", line)
+	}
+	return fmt.Sprintf("%s:%d", name, line)
+}
+
+// markStage 标记阶段及其依赖的所有阶段
+func markStage(stages []dockerfileStage, index int, selected []bool) {
+	if selected[index] {
+		return
+	}
+	selected[index] = true
+	for _, depend := range stages[index].Depends {
+		markStage(stages, depend, selected)
+	}
+}
+
+// stageIndex 返回名称或序号对应的已定义阶段，不是阶段时返回-1
+func stageIndex(stages []dockerfileStage, name string) int {
+	if index, err := strconv.Atoi(name); err == nil {
+		if index >= 0 && index < len(stages) {
+			return index
+		}
+		return -1
+	}
+	lower := strings.ToLower(name)
+	return slices.IndexFunc(stages, func(stage dockerfileStage) bool { return stage.Name != "" && stage.Name == lower })
+}
+
+// declareArgs 记录ARG声明的参数值：构建参数优先，其次是默认值；
+// 阶段内重新声明的全局参数没有默认值时继承全局参数的值，无法确定值的参数不记录。
+func declareArgs(args map[string]string, tokens []dockerfileToken, buildArgs, inherited map[string]string) {
+	for _, token := range tokens {
+		name, value, hasDefault := strings.Cut(token.Value, "=")
+		if override, ok := buildArgs[name]; ok {
+			args[name] = override
+			continue
+		}
+		if hasDefault {
+			args[name] = unquoteDockerfileValue(value)
+			continue
+		}
+		if inherited, ok := inherited[name]; ok {
+			args[name] = inherited
+		}
+	}
+}
+
+// unquoteDockerfileValue 去掉参数值两端的引号
+func unquoteDockerfileValue(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// withoutFlags 去掉指令开头的 --platform 等选项
+func withoutFlags(args []dockerfileToken) []dockerfileToken {
+	for len(args) > 0 && strings.HasPrefix(args[0].Value, "--") {
+		args = args[1:]
+	}
+	return args
+}
+
+// expandDockerfileVars 按参数值展开变量，引用了值未知的参数时返回false
+func expandDockerfileVars(value string, args map[string]string) (string, bool) {
+	ok := true
+	expanded := dockerfileVariable.ReplaceAllStringFunc(value, func(match string) string {
+		groups := dockerfileVariable.FindStringSubmatch(match)
+		name := groups[1] + groups[2]
+		current, set := args[name]
+		switch groups[3] {
+		case ":-":
+			if !set || current == "" {
+				return groups[4]
+			}
+		case "-":
+			if !set {
+				return groups[4]
+			}
+		case ":+":
+			if set && current != "" {
+				return groups[4]
+			}
+			return ""
+		case "+":
+			if set {
+				return groups[4]
+			}
+			return ""
+		}
+		if !set {
+			ok = false
+		}
+		return current
+	})
+	return expanded, ok
+}
+
+// splitDockerfile 读取文件开头的解析器指令，并将其余内容拆分为指令
+// 注释和空行被跳过，以转义字符（默认 \，可通过 # escape= 修改）结尾的行与下一行合并，heredoc的内容不作为指令解析。
+func splitDockerfile(content string) (map[string]dockerfileToken, []dockerfileInstruction) {
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+
+	directives := map[string]dockerfileToken{}
+	for i, line := range lines {
+		groups := dockerfileDirective.FindStringSubmatchIndex(line)
+		if groups == nil {
+			break
+		}
+		name := strings.ToLower(line[groups[2]:groups[3]])
+		if _, ok := directives[name]; ok {
+			break
+		}
+		directives[name] = dockerfileToken{
+			Value:  line[groups[4]:groups[5]],
+			Line:   i + 1,
+			Column: utf8.RuneCountInString(line[:groups[4]]) + 1,
+		}
+	}
+	escape := "\\"
+	if directive, ok := directives["escape"]; ok && directive.Value == "`" {
+		escape = "`"
+	}
+
+	var instructions []dockerfileInstruction
+	var current []dockerfileToken
+	var heredocs []string
+	for i, line := range lines {
+		if len(heredocs) > 0 {
+			if strings.TrimSpace(line) == heredocs[0] {
+				heredocs = heredocs[1:]
+			}
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		body, continued := strings.CutSuffix(strings.TrimRightFunc(line, unicode.IsSpace), escape)
+		current = append(current, dockerfileTokens(body, i+1)...)
+		if continued {
+			continue
+		}
+
+		if len(current) > 0 {
+			instruction := newDockerfileInstruction(current)
+			instructions = append(instructions, instruction)
+			if instruction.Command == "RUN" || instruction.Command == "COPY" || instruction.Command == "ADD" {
+				for _, token := range instruction.Args {
+					for _, match := range dockerfileHeredoc.FindAllStringSubmatch(token.Value, -1) {
+						heredocs = append(heredocs, match[1])
+					}
+				}
+			}
+		}
+		current = nil
+	}
+	if len(current) > 0 {
+		instructions = append(instructions, newDockerfileInstruction(current))
+	}
+	return directives, instructions
+}
+
+// newDockerfileInstruction 由一条指令的所有参数创建指令，第一个参数是指令名
+func newDockerfileInstruction(tokens []dockerfileToken) dockerfileInstruction {
+	return dockerfileInstruction{Command: strings.ToUpper(tokens[0].Value), Args: tokens[1:], Line: tokens[0].Line}
+}
+
+// dockerfileTokens 按空白拆分一行，记录每个参数的行号和列号
+func dockerfileTokens(line string, lineNumber int) []dockerfileToken {
+	var tokens []dockerfileToken
+	column, start := 0, -1
+	startColumn := 0
+	for offset, r := range line {
+		column++
+		if unicode.IsSpace(r) {
+			if start >= 0 {
+				tokens = append(tokens, dockerfileToken{Value: line[start:offset], Line: lineNumber, Column: startColumn})
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start, startColumn = offset, column
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, dockerfileToken{Value: line[start:], Line: lineNumber, Column: startColumn})
+	}
+	return tokens
+}
@@ -0,0 +1,186 @@
+package yamlparser
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseDockerfileContent(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		buildArgs map[string]string
+		target    string
+		want      []FoundImage
+	}{
+		{
+			name:    "single stage",
+			content: "FROM alpine:3.19\nRUN apk add curl\n",
+			want: []FoundImage{
+				{Image: "alpine:3.19", Kind: "FROM", Line: 1, Column: 6},
+			},
+		},
+		{
+			name:    "syntax directive and platform flag",
+			content: "# syntax=docker/dockerfile:1.7\n# escape=\\\nFROM --platform=$BUILDPLATFORM golang:1.24 AS build\n",
+			want: []FoundImage{
+				{Image: "docker/dockerfile:1.7", Kind: "syntax", Line: 1, Column: 10},
+				{Image: "golang:1.24", Kind: "FROM", Stage: "build", Line: 3, Column: 32},
+			},
+		},
+		{
+			// 注释之后的 # syntax= 不是解析器指令
+			name:    "syntax after comment",
+			content: "# base image\n# syntax=docker/dockerfile:1\nFROM alpine\n",
+			want: []FoundImage{
+				{Image: "alpine", Kind: "FROM", Line: 3, Column: 6},
+			},
+		},
+		{
+			name:    "arg defaults",
+			content: "ARG REGISTRY=docker.io\nARG IMAGE=\"library/golang\"\nARG TAG\nARG VARIANT\nFROM ${REGISTRY}/${IMAGE}:${TAG:-1.24}\nFROM $REGISTRY/alpine:3.19${VARIANT:+-$VARIANT}\n",
+			want: []FoundImage{
+				{Image: "docker.io/library/golang:1.24", Kind: "FROM", Line: 5, Column: 6},
+				{Image: "docker.io/alpine:3.19", Kind: "FROM", Line: 6, Column: 6},
+			},
+		},
+		{
+			name:      "build args override defaults",
+			content:   "ARG REGISTRY=docker.io\nARG TAG\nARG VARIANT=slim\nFROM ${REGISTRY}/golang:${TAG:-1.24}\nFROM $REGISTRY/debian:12${VARIANT:+-slim}\n",
+			buildArgs: map[string]string{"REGISTRY": "mirror.example.com", "TAG": "1.25", "VARIANT": ""},
+			want: []FoundImage{
+				{Image: "mirror.example.com/golang:1.25", Kind: "FROM", Line: 4, Column: 6},
+				{Image: "mirror.example.com/debian:12", Kind: "FROM", Line: 5, Column: 6},
+			},
+		},
+		{
+			// 值未知的参数无法确定镜像，跳过
+			name:    "unresolved arg",
+			content: "ARG BASE\nFROM $BASE\nFROM alpine\n",
+			want: []FoundImage{
+				{Image: "alpine", Kind: "FROM", Line: 3, Column: 6},
+			},
+		},
+		{
+			// 全局参数只能在FROM中使用，阶段内需要重新声明
+			name:    "stage args",
+			content: "ARG VERSION=3.19\nFROM alpine:$VERSION AS base\nCOPY --from=alpine:$VERSION /a /a\nARG VERSION\nCOPY --from=busybox:$VERSION /b /b\n",
+			want: []FoundImage{
+				{Image: "alpine:3.19", Kind: "FROM", Stage: "base", Line: 2, Column: 6},
+				{Image: "busybox:3.19", Kind: "COPY --from", Stage: "base", Line: 5, Column: 13},
+			},
+		},
+		{
+			name:    "stage references",
+			content: "FROM golang:1.24 AS Build\nRUN go build\nFROM build AS test\nFROM scratch\nCOPY --from=BUILD /out /app\nCOPY --from=0 /out /app\nCOPY --from=nginx:1.25 /etc/nginx /etc/nginx\n",
+			want: []FoundImage{
+				{Image: "golang:1.24", Kind: "FROM", Stage: "build", Line: 1, Column: 6},
+				{Image: "nginx:1.25", Kind: "COPY --from", Line: 7, Column: 13},
+			},
+		},
+		{
+			// 引用之后才定义的阶段名不是阶段，按镜像处理
+			name:    "forward reference",
+			content: "FROM alpine\nCOPY --from=later /a /a\nFROM busybox AS later\n",
+			want: []FoundImage{
+				{Image: "alpine", Kind: "FROM", Line: 1, Column: 6},
+				{Image: "later", Kind: "COPY --from", Line: 2, Column: 13},
+				{Image: "busybox", Kind: "FROM", Stage: "later", Line: 3, Column: 6},
+			},
+		},
+		{
+			name:    "line continuations and heredocs",
+			content: "FROM \\\n    alpine:3.19\nRUN <<EOF\nFROM not-an-image\nEOF\nCOPY \\\n  --from=busybox:1.36 /bin/sh /bin/sh\n",
+			want: []FoundImage{
+				{Image: "alpine:3.19", Kind: "FROM", Line: 2, Column: 5},
+				{Image: "busybox:1.36", Kind: "COPY --from", Line: 7, Column: 10},
+			},
+		},
+		{
+			name:    "escape directive",
+			content: "# escape=`\nFROM `\n  mcr.microsoft.com/windows/servercore:ltsc2022\n",
+			want: []FoundImage{
+				{Image: "mcr.microsoft.com/windows/servercore:ltsc2022", Kind: "FROM", Line: 3, Column: 3},
+			},
+		},
+		{
+			// 只保留目标阶段及其依赖的阶段
+			name:    "target",
+			content: "# syntax=docker/dockerfile:1\nFROM golang:1.24 AS build\nFROM node:22 AS web\nFROM alpine:3.19 AS release\nCOPY --from=build /out /app\nCOPY --from=redis:7 /usr/local/bin/redis-server /bin/\nFROM busybox AS debug\n",
+			target:  "Release",
+			want: []FoundImage{
+				{Image: "docker/dockerfile:1", Kind: "syntax", Line: 1, Column: 10},
+				{Image: "golang:1.24", Kind: "FROM", Stage: "build", Line: 2, Column: 6},
+				{Image: "alpine:3.19", Kind: "FROM", Stage: "release", Line: 4, Column: 6},
+				{Image: "redis:7", Kind: "COPY --from", Stage: "release", Line: 6, Column: 13},
+			},
+		},
+		{
+			name:    "target based on another stage",
+			content: "FROM golang:1.24 AS build\nFROM build AS test\nFROM alpine AS release\n",
+			target:  "test",
+			want: []FoundImage{
+				{Image: "golang:1.24", Kind: "FROM", Stage: "build", Line: 1, Column: 6},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDockerfileContent(tt.content, "Dockerfile", tt.buildArgs, tt.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("found %d images, want %d:\n%s", len(got), len(tt.want), formatImages(got))
+			}
+			for i, want := range tt.want {
+				if got[i].Image != want.Image || got[i].Kind != want.Kind || got[i].Stage != want.Stage ||
+					got[i].Line != want.Line || got[i].Column != want.Column {
+					t.Errorf("image %d:\n got %+v\nwant %+v", i, got[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseDockerfileContentErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		target  string
+		want    string
+	}{
+		{name: "no FROM", content: "# empty\nRUN echo hi\n", want: "没有找到FROM指令"},
+		{name: "FROM without image", content: "FROM --platform=linux/amd64\n", want: "第 1 行的FROM缺少镜像"},
+		{name: "unknown target", content: "FROM alpine AS base\n", target: "release", want: "没有找到构建阶段 release"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseDockerfileContent(tt.content, "", nil, tt.target)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDockerfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "Dockerfile")
+	if err := os.WriteFile(path, []byte("FROM golang:1.24 AS build\nFROM alpine\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseDockerfile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].File != path || got[1].File != path || got[1].Source() != path+":2 (FROM)" {
+		t.Errorf("ParseDockerfile() =\n%s", formatImages(got))
+	}
+
+	if _, err := ParseDockerfile(filepath.Join(t.TempDir(), "missing")); err == nil || !strings.Contains(err.Error(), "无法读取文件") {
+		t.Errorf("missing Dockerfile error = %v", err)
+	}
+}
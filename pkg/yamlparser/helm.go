@@ -0,0 +1,215 @@
+package yamlparser
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/engine"
+)
+
+const (
+	// helmReleaseName 渲染Chart时使用的发布名称，与 helm template 的默认值一致
+	helmReleaseName = "release-name"
+	// helmNamespace 渲染Chart时使用的命名空间
+	helmNamespace = "default"
+)
+
+// IsHelmChart 判断路径是否为Helm Chart：包含Chart.yaml的目录、Chart.yaml文件本身或打包的.tgz文件
+func IsHelmChart(path string) bool {
+	if strings.HasSuffix(path, ".tgz") || strings.HasSuffix(path, ".tar.gz") {
+		return true
+	}
+	if filepath.Base(path) == chartutil.ChartfileName {
+		return true
+	}
+	info, err := os.Stat(path)
+	if err != nil || !info.IsDir() {
+		return false
+	}
+	_, err = os.Stat(filepath.Join(path, chartutil.ChartfileName))
+	return err == nil
+}
+
+// ParseHelmChart 渲染本地Helm Chart并提取所有镜像
+// chartPath可以是Chart目录、Chart.yaml或.tgz文件，opts.ValuesFiles按顺序合并，靠后的文件优先。
+// 渲染在本地完成，不需要连接集群；渲染失败时（例如缺少必填的values）退回到按常见约定扫描values中的镜像。
+// 渲染结果中的行号与模板文件对应不上，记录中只保留Chart路径和资源信息。
+func ParseHelmChart(chartPath string, opts ParseOptions) ([]FoundImage, error) {
+	if filepath.Base(chartPath) == chartutil.ChartfileName {
+		chartPath = filepath.Dir(chartPath)
+	}
+
+	chrt, err := loader.Load(chartPath)
+	if err != nil {
+		return nil, fmt.Errorf("加载Helm Chart %s 失败: %w", chartPath, err)
+	}
+
+	values := map[string]interface{}{}
+	for _, file := range opts.ValuesFiles {
+		fileValues, err := chartutil.ReadValuesFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("读取values文件 %s 失败: %w", file, err)
+		}
+		mergeValues(values, fileValues)
+	}
+
+	manifests, err := renderHelmChart(chrt, values)
+	if err != nil {
+		fmt.Printf("警告: 渲染Helm Chart失败，改为从values中查找镜像: %v\n", err)
+		merged, coalesceErr := chartutil.CoalesceValues(chrt, values)
+		if coalesceErr != nil {
+			return nil, fmt.Errorf("合并Chart values失败: %w", coalesceErr)
+		}
+		images := []FoundImage{}
+		for _, image := range ParseHelmValues(merged, chrt.Metadata.AppVersion) {
+			images = append(images, FoundImage{Image: image, File: chartPath})
+		}
+		return images, nil
+	}
+	if strings.TrimSpace(manifests) == "" {
+		return []FoundImage{}, nil
+	}
+
+	images, err := ParseK8sContentWithOptions(manifests, opts)
+	return renderedImages(images, chartPath), err
+}
+
+// renderHelmChart 按 helm template 的方式渲染Chart，返回拼接后的多文档YAML
+func renderHelmChart(chrt *chart.Chart, values map[string]interface{}) (string, error) {
+	if err := chartutil.ProcessDependenciesWithMerge(chrt, values); err != nil {
+		return "", err
+	}
+
+	options := chartutil.ReleaseOptions{
+		Name:      helmReleaseName,
+		Namespace: helmNamespace,
+		Revision:  1,
+		IsInstall: true,
+	}
+	renderValues, err := chartutil.ToRenderValues(chrt, values, options, chartutil.DefaultCapabilities)
+	if err != nil {
+		return "", err
+	}
+
+	rendered, err := engine.Render(chrt, renderValues)
+	if err != nil {
+		return "", err
+	}
+
+	// 按模板路径排序，保证输出的镜像顺序稳定
+	names := make([]string, 0, len(rendered))
+	for name := range rendered {
+		if strings.HasSuffix(name, ".yaml") || strings.HasSuffix(name, ".yml") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	for _, name := range names {
+		if strings.TrimSpace(rendered[name]) == "" {
+			continue
+		}
+		sb.WriteString("\n---\n")
+		sb.WriteString(rendered[name])
+	}
+	return sb.String(), nil
+}
+
+// ParseHelmValues 按Helm Chart的常见约定从values中查找镜像
+// 识别包含 repository 的映射（可带 registry、tag、digest），以及值为字符串的 image 字段；
+// 没有 tag 和 digest 时使用Chart的appVersion作为标签。
+func ParseHelmValues(values map[string]interface{}, appVersion string) []string {
+	var images []string
+	seen := map[string]bool{}
+	add := func(image string) {
+		if image == "" || strings.Contains(image, "{{") || seen[image] {
+			return
+		}
+		seen[image] = true
+		images = append(images, image)
+	}
+
+	var walk func(value interface{})
+	walk = func(value interface{}) {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if repository, ok := v["repository"].(string); ok && repository != "" {
+				add(imageFromValues(v, repository, appVersion))
+			}
+			keys := make([]string, 0, len(v))
+			for key := range v {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				if image, ok := v[key].(string); ok && key == "image" {
+					add(image)
+					continue
+				}
+				walk(v[key])
+			}
+		case []interface{}:
+			for _, item := range v {
+				walk(item)
+			}
+		}
+	}
+	walk(values)
+
+	return images
+}
+
+// imageFromValues 由 registry、repository、tag、digest 拼出完整的镜像地址
+func imageFromValues(values map[string]interface{}, repository, appVersion string) string {
+	image := repository
+	if registry := scalarString(values["registry"]); registry != "" {
+		image = strings.TrimSuffix(registry, "/") + "/" + repository
+	}
+
+	tag := scalarString(values["tag"])
+	digest := scalarString(values["digest"])
+	if tag == "" && digest == "" {
+		tag = appVersion
+	}
+	if tag != "" {
+		image += ":" + tag
+	}
+	if digest != "" {
+		image += "@" + digest
+	}
+	return image
+}
+
+// scalarString 将values中的标量转换为字符串，数字形式的标签（如 1.25）按原样输出
+func scalarString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int, int64:
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+// mergeValues 将src合并到dst，嵌套的映射逐层合并，其余值由src覆盖
+func mergeValues(dst, src map[string]interface{}) {
+	for key, value := range src {
+		if nested, ok := value.(map[string]interface{}); ok {
+			if existing, ok := dst[key].(map[string]interface{}); ok {
+				mergeValues(existing, nested)
+				continue
+			}
+		}
+		dst[key] = value
+	}
+}
@@ -0,0 +1,202 @@
+package yamlparser
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+// renderedImage Helm和kustomize测试中比较的字段，渲染结果没有行号
+type renderedImage struct {
+	Image     string
+	Kind      string
+	Name      string
+	Container string
+}
+
+// wantRenderedImages 按顺序比较镜像记录，并检查出处都是path
+func wantRenderedImages(t *testing.T, got []FoundImage, path string, want []renderedImage) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("found %d images, want %d:\n%s", len(got), len(want), formatImages(got))
+	}
+	for i, w := range want {
+		g := got[i]
+		if g.Image != w.Image || g.Kind != w.Kind || g.Name != w.Name || g.Container != w.Container {
+			t.Errorf("image %d:\n got %+v\nwant %+v", i, g, w)
+		}
+		if g.File != path || g.Line != 0 || g.Document != 0 {
+			t.Errorf("image %d has location %s, want %s", i, g.Location(), path)
+		}
+	}
+}
+
+func TestParseHelmChart(t *testing.T) {
+	chart := filepath.Join("testdata", "helm", "app")
+
+	tests := []struct {
+		name string
+		// path 相对于Chart目录，为空时使用目录本身
+		path   string
+		values []string
+		want   []renderedImage
+	}{
+		{
+			// 没有tag时模板使用appVersion，NOTES.txt等非YAML文件不参与解析
+			name: "defaults",
+			want: []renderedImage{
+				{Image: "docker.io/library/nginx:1.25", Kind: "Deployment", Name: "release-name-app", Container: "init"},
+				{Image: "docker.io/library/nginx:1.25", Kind: "Deployment", Name: "release-name-app", Container: "app"},
+			},
+		},
+		{
+			name: "Chart.yaml",
+			path: "Chart.yaml",
+			want: []renderedImage{
+				{Image: "docker.io/library/nginx:1.25", Kind: "Deployment", Name: "release-name-app", Container: "init"},
+				{Image: "docker.io/library/nginx:1.25", Kind: "Deployment", Name: "release-name-app", Container: "app"},
+			},
+		},
+		{
+			// values文件逐层合并，靠后的文件优先
+			name:   "values files",
+			values: []string{"values-prod.yaml", "values-tag.yaml"},
+			want: []renderedImage{
+				{Image: "registry.example.com/library/nginx:1.27", Kind: "Deployment", Name: "release-name-app", Container: "init"},
+				{Image: "registry.example.com/library/nginx:1.27", Kind: "Deployment", Name: "release-name-app", Container: "app"},
+				{Image: "busybox:1.36", Kind: "Deployment", Name: "release-name-app", Container: "sidecar"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(chart, tt.path)
+			var opts ParseOptions
+			for _, file := range tt.values {
+				opts.ValuesFiles = append(opts.ValuesFiles, filepath.Join(chart, file))
+			}
+			images, err := ParseHelmChart(path, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantRenderedImages(t, images, chart, tt.want)
+		})
+	}
+}
+
+func TestParseHelmChartFallback(t *testing.T) {
+	// 缺少必填的values时渲染失败，改为从values中查找镜像
+	chart := filepath.Join("testdata", "helm", "required")
+	images, err := ParseHelmChart(chart, ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRenderedImages(t, images, chart, []renderedImage{
+		{Image: "oliver006/redis_exporter:v1.62.0"},
+		{Image: "redis:7.2"},
+	})
+
+	// 提供values之后正常渲染
+	values := filepath.Join(t.TempDir(), "values.yaml")
+	if err := os.WriteFile(values, []byte("host: redis\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	images, err = ParseHelmChart(chart, ParseOptions{ValuesFiles: []string{values}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRenderedImages(t, images, chart, []renderedImage{
+		{Image: "redis:7.2", Kind: "StatefulSet", Name: "redis", Container: "redis"},
+	})
+}
+
+func TestParseHelmChartErrors(t *testing.T) {
+	chart := filepath.Join("testdata", "helm", "app")
+	if _, err := ParseHelmChart(t.TempDir(), ParseOptions{}); err == nil || !strings.Contains(err.Error(), "加载Helm Chart") {
+		t.Errorf("ParseHelmChart(empty dir) error = %v", err)
+	}
+	missing := filepath.Join(t.TempDir(), "values.yaml")
+	if _, err := ParseHelmChart(chart, ParseOptions{ValuesFiles: []string{missing}}); err == nil || !strings.Contains(err.Error(), "读取values文件") {
+		t.Errorf("ParseHelmChart(missing values) error = %v", err)
+	}
+}
+
+// packageChart 将testdata中的Chart打包为.tgz，返回文件路径
+func packageChart(t *testing.T, name string) string {
+	t.Helper()
+	chrt, err := loader.Load(filepath.Join("testdata", "helm", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, err := chartutil.Save(chrt, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseHelmChartPackaged(t *testing.T) {
+	// 同一镜像合并为一条记录，app容器记录在Duplicates中
+	want := []renderedImage{
+		{Image: "docker.io/library/nginx:1.25", Kind: "Deployment", Name: "release-name-app", Container: "init"},
+	}
+	archive := packageChart(t, "app")
+
+	images, err := ParseFileWithOptions(archive, ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRenderedImages(t, images, archive, want)
+	if len(images[0].Duplicates) != 1 || images[0].Duplicates[0].Container != "app" {
+		t.Errorf("Duplicates = %+v", images[0].Duplicates)
+	}
+
+	// URL指向.tgz时下载后渲染，出处为URL
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, archive)
+	}))
+	defer server.Close()
+	url := server.URL + "/charts/app-0.1.0.tgz?download=1"
+	images, err = ParseFileWithOptions(url, ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRenderedImages(t, images, url, want)
+	if len(images[0].Duplicates) != 1 || images[0].Duplicates[0].File != url {
+		t.Errorf("Duplicates = %+v", images[0].Duplicates)
+	}
+}
+
+func TestParseHelmValues(t *testing.T) {
+	values := map[string]interface{}{
+		"image": map[string]interface{}{
+			"registry":   "ghcr.io/",
+			"repository": "example/api",
+		},
+		"worker": map[string]interface{}{
+			"image": map[string]interface{}{
+				"repository": "example/worker",
+				"tag":        1.5,
+				"digest":     "sha256:abc",
+			},
+		},
+		"sidecars": []interface{}{
+			map[string]interface{}{"image": "busybox:1.36"},
+			map[string]interface{}{"image": "{{ .Values.custom }}"},
+			map[string]interface{}{"image": "busybox:1.36"},
+		},
+		"name": "api",
+	}
+	got := ParseHelmValues(values, "2.0.0")
+	want := []string{"ghcr.io/example/api:2.0.0", "busybox:1.36", "example/worker:1.5@sha256:abc"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("ParseHelmValues() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,161 @@
+package yamlparser
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/keevingness/image-shipper/pkg/docker"
+)
+
+// FoundImage 从文件中找到的镜像及其出处
+type FoundImage struct {
+	// Image 镜像地址，与文件中的写法一致
+	Image string
+	// File 镜像所在的文件；Helm Chart和kustomization为Chart或kustomization的路径，解析内容时为空
+	File string
+	// Document 镜像所在的YAML文档序号，从1开始，Compose文件和渲染结果中为0
+	Document int
+	// Kind 资源类型，Compose文件中为空；Dockerfile中为引用镜像的指令，如 FROM
+	Kind string
+	// Name 资源名称，Compose文件中为服务名
+	Name string
+	// Container 容器名称，没有名称时为空
+	Container string
+	// Stage Dockerfile中镜像所在的构建阶段，阶段没有名称时为空
+	Stage string
+	// Line 镜像字段所在的行号，从1开始，无法确定时为0（如Helm Chart和kustomization的渲染结果）
+	Line int
+	// Column 镜像字段值所在的列号，从1开始，行号为0时同样为0
+	Column int
+	// Duplicates 去重时合并进来的同一镜像的其他出处
+	Duplicates []FoundImage
+}
+
+// Location 返回镜像所在的文件和行号，如 deploy.yaml:12
+func (f FoundImage) Location() string {
+	if f.Line > 0 {
+		return fmt.Sprintf("%s:%d", f.File, f.Line)
+	}
+	return f.File
+}
+
+// Source 返回镜像出处的描述，如 deploy.yaml:12 (文档 2, Deployment/web, 容器 nginx)
+func (f FoundImage) Source() string {
+	var details []string
+	if f.Document > 0 {
+		details = append(details, fmt.Sprintf("文档 %d", f.Document))
+	}
+	switch {
+	case f.Kind != "" && f.Name != "" && isDockerfileKind(f.Kind):
+		// Compose服务构建时使用的基础镜像
+		details = append(details, "服务 "+f.Name, f.Kind)
+	case f.Kind != "" && f.Name != "":
+		details = append(details, f.Kind+"/"+f.Name)
+	case f.Kind != "":
+		details = append(details, f.Kind)
+	case f.Name != "":
+		details = append(details, "服务 "+f.Name)
+	}
+	if f.Container != "" {
+		details = append(details, "容器 "+f.Container)
+	}
+	if f.Stage != "" {
+		details = append(details, "阶段 "+f.Stage)
+	}
+
+	location := f.Location()
+	if len(details) == 0 {
+		return location
+	}
+	if location == "" {
+		return strings.Join(details, ", ")
+	}
+	return fmt.Sprintf("%s (%s)", location, strings.Join(details, ", "))
+}
+
+// sameLocation 判断两条记录是否指向文件中的同一个位置
+func (f FoundImage) sameLocation(other FoundImage) bool {
+	return f.File == other.File && f.Document == other.Document && f.Line == other.Line && f.Column == other.Column &&
+		f.Kind == other.Kind && f.Name == other.Name && f.Container == other.Container && f.Stage == other.Stage
+}
+
+// DedupImages 合并指向同一镜像的记录，保持首次出现的顺序
+// nginx、nginx:latest 和 docker.io/library/nginx:latest 视为同一镜像，其余出处记录在Duplicates中。
+func DedupImages(images []FoundImage) []FoundImage {
+	result := []FoundImage{}
+	index := map[string]int{}
+	for _, image := range images {
+		key := dedupKey(image.Image)
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(result)
+			result = append(result, image)
+			continue
+		}
+		// 被合并的记录自身也可能带有已合并的出处
+		others := append([]FoundImage{image}, image.Duplicates...)
+		for _, other := range others {
+			other.Duplicates = nil
+			if !result[i].hasLocation(other) {
+				result[i].Duplicates = append(result[i].Duplicates, other)
+			}
+		}
+	}
+	return result
+}
+
+// hasLocation 判断记录本身或已合并的出处中是否已有相同位置
+func (f FoundImage) hasLocation(other FoundImage) bool {
+	if f.sameLocation(other) {
+		return true
+	}
+	for _, duplicate := range f.Duplicates {
+		if duplicate.sameLocation(other) {
+			return true
+		}
+	}
+	return false
+}
+
+// dedupKey 返回去重使用的键，无法解析的镜像地址按原样比较
+func dedupKey(image string) string {
+	ref, err := docker.ParseNormalizedReference(image)
+	if err != nil {
+		return image
+	}
+	return ref.WithDefaultTag().String()
+}
+
+// renderedImages 将渲染结果中的记录指向原始路径
+// 渲染结果中的文档序号和行号在原始文件中没有对应位置，予以清除。
+func renderedImages(images []FoundImage, path string) []FoundImage {
+	for i := range images {
+		images[i].File = path
+		images[i].Document = 0
+		images[i].Line = 0
+		images[i].Column = 0
+	}
+	return images
+}
+
+// PrintFoundImages 按序号列出镜像，每个镜像下列出全部出处
+func PrintFoundImages(w io.Writer, images []FoundImage) {
+	for i, image := range images {
+		fmt.Fprintf(w, "%d. %s\n", i+1, image.Image)
+		for _, source := range append([]FoundImage{image}, image.Duplicates...) {
+			if s := source.Source(); s != "" {
+				fmt.Fprintf(w, "   来源: %s\n", s)
+			}
+		}
+	}
+}
+
+// ImageNames 返回所有记录中的镜像地址
+func ImageNames(images []FoundImage) []string {
+	names := make([]string, len(images))
+	for i, image := range images {
+		names[i] = image.Image
+	}
+	return names
+}
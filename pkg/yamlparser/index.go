@@ -2,7 +2,6 @@ package yamlparser
 
 import (
 	"fmt"
-	"strings"
 )
 
 // FileType YAML文件类型
@@ -15,93 +14,162 @@ const (
 	FileTypeCompose FileType = "compose"
 	// FileTypeK8s Kubernetes文件
 	FileTypeK8s FileType = "k8s"
+	// FileTypeHelm Helm Chart目录或打包文件
+	FileTypeHelm FileType = "helm"
+	// FileTypeKustomize kustomization目录
+	FileTypeKustomize FileType = "kustomize"
+	// FileTypeDockerfile Dockerfile
+	FileTypeDockerfile FileType = "dockerfile"
 )
 
-// ParseFile 解析YAML文件并提取镜像
-// 根据文件名和内容综合判断是docker-compose还是k8s文件
-func ParseFile(filePath string) ([]string, error) {
-	// 首先根据文件名判断文件类型
-	fileType := DetectFileType(filePath)
-	
-	// 根据检测到的文件类型优先使用对应解析器
-	switch fileType {
-	case FileTypeCompose:
-		// 优先尝试作为docker-compose文件解析
-		composeImages, err := ParseComposeFile(filePath)
-		if err == nil {
-			return composeImages, nil
+// ParseOptions 解析文件时的附加选项
+type ParseOptions struct {
+	// ValuesFiles 渲染Helm Chart时使用的values文件，按顺序合并
+	ValuesFiles []string
+	// ImagePaths 在Kubernetes资源中额外查找镜像的路径
+	ImagePaths []ImagePath
+	// Profiles 解析Compose文件时启用的profile
+	Profiles []string
+	// Include 扫描目录时包含的文件模式，为空时包含所有 .yaml 和 .yml 文件
+	Include []string
+	// Exclude 扫描目录时排除的文件和目录模式
+	Exclude []string
+	// Type 强制使用的解析器，为空时按内容判断
+	Type FileType
+	// OnDetect 判断出每个文件的类型后调用，用于展示判断结果
+	OnDetect func(name string, detection Detection)
+}
+
+// ParseFilesWithOptions 解析多个文件并按顺序合并提取到的镜像
+// 直接指定的多个Compose文件与 docker compose -f a.yaml -f b.yaml 相同，按顺序合并为一个项目后再提取；
+// 目录和通配符按ExpandPaths展开，其中的文件逐个解析，无法解析的文件只给出警告。
+// 同一镜像只保留一条记录，顺序为首次出现的顺序。
+func ParseFilesWithOptions(filePaths []string, opts ParseOptions) ([]FoundImage, error) {
+	if len(filePaths) == 1 && !IsScanPath(filePaths[0]) {
+		return ParseFileWithOptions(filePaths[0], opts)
+	}
+
+	var composeFiles []string
+	for _, filePath := range filePaths {
+		if isLocalCompose(filePath, opts) {
+			composeFiles = append(composeFiles, filePath)
 		}
-		// 如果失败，再尝试作为k8s文件解析
-		return ParseK8sFile(filePath)
-	case FileTypeK8s:
-		// 优先尝试作为k8s文件解析
-		k8sImages, err := ParseK8sFile(filePath)
-		if err == nil {
-			return k8sImages, nil
+	}
+
+	// 合并后的Compose项目放在第一个Compose文件的位置，其余文件保持命令行中的顺序
+	images := []FoundImage{}
+	composeParsed := false
+	for _, filePath := range filePaths {
+		if IsScanPath(filePath) {
+			scanned, err := ExpandPaths([]string{filePath}, opts)
+			if err != nil {
+				return nil, err
+			}
+			for _, file := range scanned {
+				fileImages, err := parseFile(file, opts)
+				if err != nil {
+					fmt.Printf("警告: 跳过 %s: %v\n", file, err)
+					continue
+				}
+				images = append(images, fileImages...)
+			}
+			continue
 		}
-		// 如果失败，再尝试作为docker-compose文件解析
-		return ParseComposeFile(filePath)
-	default:
-		// 对于未知类型，按照原逻辑尝试
-		// 首先尝试作为docker-compose文件解析
-		composeImages, err := ParseComposeFile(filePath)
-		if err == nil {
-			return composeImages, nil
+		if isLocalCompose(filePath, opts) {
+			if composeParsed {
+				continue
+			}
+			composeParsed = true
+			for _, composeFile := range composeFiles {
+				reportDetection(composeFile, detectFile(composeFile, opts), opts)
+			}
+			composeImages, err := parseComposeFiles(composeFiles, opts)
+			if err != nil {
+				return nil, err
+			}
+			images = append(images, composeImages...)
+			continue
 		}
+		fileImages, err := parseFile(filePath, opts)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filePath, err)
+		}
+		images = append(images, fileImages...)
+	}
+	return DedupImages(images), nil
+}
+
+// isLocalCompose 判断参数是否为直接指定的本地Compose文件，只有这些文件会被合并
+func isLocalCompose(p string, opts ParseOptions) bool {
+	return !IsRemotePath(p) && !IsScanPath(p) && detectFile(p, opts).Type == FileTypeCompose
+}
 
-		// 如果docker-compose解析失败，尝试作为k8s文件解析
-		return ParseK8sFile(filePath)
+// ParseFile 解析YAML文件并提取镜像
+// 根据内容判断是docker-compose还是k8s文件，判断依据见DetectFile
+func ParseFile(filePath string) ([]FoundImage, error) {
+	return ParseFileWithOptions(filePath, ParseOptions{})
+}
+
+// ParseFileWithOptions 按指定选项解析文件并提取镜像，同一镜像只保留一条记录
+func ParseFileWithOptions(filePath string, opts ParseOptions) ([]FoundImage, error) {
+	images, err := parseFile(filePath, opts)
+	if err != nil {
+		return nil, err
+	}
+	return DedupImages(images), nil
+}
+
+// parseFile 按文件类型选择解析器，返回所有出现位置的镜像
+func parseFile(filePath string, opts ParseOptions) ([]FoundImage, error) {
+	// 标准输入和URL没有可靠的文件名，按内容判断类型
+	if IsRemotePath(filePath) {
+		return parseRemote(filePath, opts)
+	}
+
+	detection := detectFile(filePath, opts)
+	reportDetection(filePath, detection, opts)
+
+	switch detection.Type {
+	case FileTypeHelm:
+		return ParseHelmChart(filePath, opts)
+	case FileTypeKustomize:
+		return ParseKustomization(filePath, opts)
+	case FileTypeCompose:
+		return parseComposeFiles([]string{filePath}, opts)
+	case FileTypeK8s:
+		return parseK8sFile(filePath, opts)
+	case FileTypeDockerfile:
+		return ParseDockerfile(filePath)
+	default:
+		return nil, fmt.Errorf("无法判断文件类型（%s），请使用 --type 指定", detection.Reason)
 	}
 }
 
 // ParseContent 解析YAML内容并提取镜像
-// 根据内容自动判断是docker-compose还是k8s文件
-func ParseContent(content string, fileType FileType) ([]string, error) {
+// 根据内容自动判断是docker-compose还是k8s文件，结果不去重
+func ParseContent(content string, fileType FileType) ([]FoundImage, error) {
+	return ParseContentWithOptions(content, fileType, ParseOptions{})
+}
+
+// ParseContentWithOptions 按指定选项解析YAML内容并提取镜像，结果不去重
+func ParseContentWithOptions(content string, fileType FileType, opts ParseOptions) ([]FoundImage, error) {
 	// 如果指定了文件类型，直接使用指定的解析器
 	if fileType != FileTypeUnknown {
 		switch fileType {
 		case FileTypeCompose:
-			return ParseComposeContent(content)
+			return ParseComposeContentWithOptions(content, opts)
 		case FileTypeK8s:
-			return ParseK8sContent(content)
+			return ParseK8sContentWithOptions(content, opts)
+		case FileTypeDockerfile:
+			return ParseDockerfileContent(content)
 		default:
 			return nil, fmt.Errorf("不支持的文件类型: %s", fileType)
 		}
 	}
 
-	// 否则自动判断文件类型
-	// 首先尝试作为docker-compose文件解析
-	composeImages, err := ParseComposeContent(content)
-	if err == nil {
-		// 只要解析成功，即使没有找到镜像也认为是有效的compose文件
-		return composeImages, nil
-	}
-
-	// 如果docker-compose解析失败，尝试作为k8s文件解析
-	k8sImages, err := ParseK8sContent(content)
-	if err == nil {
-		// 只要解析成功，即使没有找到镜像也认为是有效的k8s文件
-		return k8sImages, nil
-	}
-
-	// 如果两种解析都失败，返回详细错误
-	return nil, fmt.Errorf("无法解析内容: 既不是有效的docker-compose内容，也不是有效的k8s内容")
-}
-
-// DetectFileType 根据文件路径或内容检测YAML文件类型
-func DetectFileType(filePath string) FileType {
-	// 简单根据文件名判断
-	if strings.Contains(filePath, "docker-compose") || strings.Contains(filePath, "compose") {
-		return FileTypeCompose
-	}
-	// 识别k8s相关文件名
-	if strings.Contains(filePath, "k8s") || strings.Contains(filePath, "kubernetes") || strings.Contains(filePath, "istio") {
-		return FileTypeK8s
-	}
-	// 其他可能的YAML文件扩展名
-	if strings.HasSuffix(filePath, ".yaml") || strings.HasSuffix(filePath, ".yml") {
-		// 暂时返回未知类型，让ParseFile函数自动尝试解析
-		return FileTypeUnknown
+	detection := DetectContent([]byte(content))
+	if detection.Type == FileTypeUnknown {
+		return nil, fmt.Errorf("无法判断内容类型（%s）", detection.Reason)
 	}
-	return FileTypeUnknown
+	return ParseContentWithOptions(content, detection.Type, opts)
 }
@@ -3,9 +3,11 @@ package yamlparser
 import (
 	"fmt"
 	"io/ioutil"
+	"regexp"
 	"strings"
+	"unicode"
 
-	"gopkg.in/yaml.v2"
+	"gopkg.in/yaml.v3"
 )
 
 // 简化的Kubernetes资源结构
@@ -16,34 +18,69 @@ type K8sResource struct {
 	Spec       interface{} `yaml:"spec"`
 }
 
+// podSpecContainerFields Pod规格中包含容器列表的字段
+var podSpecContainerFields = map[string]bool{
+	"containers":          true,
+	"initContainers":      true,
+	"ephemeralContainers": true,
+}
+
+// documentSeparator YAML多文档分隔行
+var documentSeparator = regexp.MustCompile(`(?m)^---[ \t]*(?:#.*)?$`)
+
 // ParseK8sFile 解析Kubernetes YAML文件并提取所有镜像
-func ParseK8sFile(filePath string) ([]string, error) {
+func ParseK8sFile(filePath string) ([]FoundImage, error) {
+	return parseK8sFile(filePath, ParseOptions{})
+}
+
+// parseK8sFile 按指定选项解析Kubernetes YAML文件
+func parseK8sFile(filePath string, opts ParseOptions) ([]FoundImage, error) {
 	// 读取文件内容
 	data, err := ioutil.ReadFile(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("无法读取文件 %s: %w", filePath, err)
 	}
 
-	return ParseK8sContent(string(data))
+	images, err := ParseK8sContentWithOptions(string(data), opts)
+	for i := range images {
+		images[i].File = filePath
+	}
+	return images, err
 }
 
 // ParseK8sContent 解析Kubernetes YAML内容并提取所有镜像
-func ParseK8sContent(content string) ([]string, error) {
+func ParseK8sContent(content string) ([]FoundImage, error) {
+	return ParseK8sContentWithOptions(content, ParseOptions{})
+}
+
+// ParseK8sContentWithOptions 解析Kubernetes YAML内容并提取所有镜像
+// 除了任意深度的Pod规格外，还会按已知CRD的镜像路径和opts.ImagePaths中的附加路径查找镜像。
+// 结果按文档顺序排列，不去重，行号相对于content。
+func ParseK8sContentWithOptions(content string, opts ParseOptions) ([]FoundImage, error) {
+	paths, err := compileImagePaths(append(knownImagePaths, opts.ImagePaths...))
+	if err != nil {
+		return nil, err
+	}
+
 	// 处理多文档YAML
-	var images []string
+	images := []FoundImage{}
 	docs := splitYAML(content)
 
 	// 至少需要包含有效的Kubernetes资源
 	hasValidResource := false
 
-	for _, doc := range docs {
-		docImages, err := parseSingleK8sDoc(doc)
+	for i, doc := range docs {
+		docImages, err := parseSingleK8sDoc(doc.Content, paths)
 		if err != nil {
 			// 对于单个文档解析失败，继续尝试其他文档
-			fmt.Printf("警告: 解析单个文档失败: %v\n", err)
+			fmt.Printf("警告: 解析第 %d 个文档失败: %v\n", i+1, err)
 			continue
 		}
-		images = append(images, docImages...)
+		for _, image := range docImages {
+			image.Document = i + 1
+			image.Line += doc.Line
+			images = append(images, image)
+		}
 		// 只要有一个文档能被解析，就认为是有效的K8s文件
 		hasValidResource = true
 	}
@@ -56,88 +93,208 @@ func ParseK8sContent(content string) ([]string, error) {
 	return images, nil
 }
 
-// parseSingleK8sDoc 解析单个Kubernetes YAML文档并提取镜像
-func parseSingleK8sDoc(doc string) ([]string, error) {
-	// 使用通用map来解析YAML
-	var data map[interface{}]interface{}
-	if err := yaml.Unmarshal([]byte(doc), &data); err != nil {
+// parseSingleK8sDoc 解析单个Kubernetes YAML文档并提取镜像，行号相对于文档开头
+func parseSingleK8sDoc(doc string, paths []compiledImagePath) ([]FoundImage, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal([]byte(doc), &root); err != nil {
 		return nil, fmt.Errorf("解析YAML失败: %w", err)
 	}
+	if root.Kind != yaml.DocumentNode || len(root.Content) == 0 {
+		return nil, fmt.Errorf("缺少必需的资源字段(apiVersion或kind)")
+	}
+	return extractImagesFromResource(root.Content[0], paths)
+}
 
+// extractImagesFromResource 从单个资源中提取镜像，List类资源逐个处理items
+func extractImagesFromResource(resource *yaml.Node, paths []compiledImagePath) ([]FoundImage, error) {
 	// 检查是否是有效的Kubernetes资源
-	_, hasAPIVersion := data["apiVersion"]
-	_, hasKind := data["kind"]
-	if !hasAPIVersion || !hasKind {
+	apiVersion := mappingValue(resource, "apiVersion")
+	kind := mappingValue(resource, "kind")
+	if apiVersion == nil || kind == nil {
 		return nil, fmt.Errorf("缺少必需的资源字段(apiVersion或kind)")
 	}
 
-	// 提取资源名称（如果有）
-	// 可以移除对metadata和name的解析，因为我们不再需要输出调试日志
+	// v1.List、DeploymentList等列表资源
+	if items := mappingValue(resource, "items"); items != nil && items.Kind == yaml.SequenceNode && strings.HasSuffix(kind.Value, "List") {
+		var images []FoundImage
+		for _, item := range items.Content {
+			itemImages, err := extractImagesFromResource(item, paths)
+			if err != nil {
+				fmt.Printf("警告: 解析列表中的资源失败: %v\n", err)
+				continue
+			}
+			images = append(images, itemImages...)
+		}
+		return images, nil
+	}
+
+	// 任意深度的Pod规格，覆盖Deployment、CronJob以及大多数内嵌Pod模板的CRD
+	images := extractImagesFromNode(resource)
+
+	// 已知CRD和用户配置的镜像路径
+	var data interface{}
+	if err := resource.Decode(&data); err != nil {
+		return nil, fmt.Errorf("解析YAML失败: %w", err)
+	}
+	claimed := map[*yaml.Node]bool{}
+	for _, path := range paths {
+		if !path.matches(apiVersion.Value, kind.Value) {
+			continue
+		}
+		found, err := path.find(data)
+		if err != nil {
+			return nil, fmt.Errorf("按路径 %s 查找镜像失败: %w", path.Path, err)
+		}
+		// JSONPath的结果不带位置，回到YAML节点中查找对应的字段
+		for _, image := range found {
+			record := FoundImage{Image: image}
+			if container, node := findImageNode(resource, image, claimed); node != nil {
+				claimed[node] = true
+				record.Line = node.Line
+				record.Column = node.Column
+				record.Container = scalarValue(mappingValue(container, "name"))
+			}
+			images = append(images, record)
+		}
+	}
 
-	// 尝试从spec中提取镜像
-	var images []string
-	if spec, ok := data["spec"].(map[interface{}]interface{}); ok {
-		images = extractImagesFromSpec(spec)
+	name := scalarValue(mappingValue(mappingValue(resource, "metadata"), "name"))
+	for i := range images {
+		images[i].Kind = kind.Value
+		images[i].Name = name
 	}
 
 	// 即使没有找到镜像，也返回空切片而不是错误
 	return images, nil
 }
 
-// extractImagesFromSpec 从spec中提取镜像
-func extractImagesFromSpec(spec map[interface{}]interface{}) []string {
-	var images []string
+// extractImagesFromNode 按文档顺序递归查找容器列表中的镜像
+func extractImagesFromNode(node *yaml.Node) []FoundImage {
+	var images []FoundImage
 
-	// 1. 直接从spec中提取容器镜像（Pod资源）
-	if containers, ok := spec["containers"].([]interface{}); ok {
-		images = append(images, extractImagesFromContainerList(containers)...)  
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if podSpecContainerFields[key.Value] && value.Kind == yaml.SequenceNode {
+				images = append(images, extractImagesFromContainerList(value)...)
+				continue
+			}
+			images = append(images, extractImagesFromNode(value)...)
+		}
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			images = append(images, extractImagesFromNode(item)...)
+		}
 	}
 
-	// 提取initContainers镜像
-	if initContainers, ok := spec["initContainers"].([]interface{}); ok {
-		images = append(images, extractImagesFromContainerList(initContainers)...)  
-	}
+	return images
+}
 
-	// 提取ephemeralContainers镜像
-	if ephemeralContainers, ok := spec["ephemeralContainers"].([]interface{}); ok {
-		images = append(images, extractImagesFromContainerList(ephemeralContainers)...)  
-	}
+// extractImagesFromContainerList 从容器列表中提取镜像
+func extractImagesFromContainerList(containers *yaml.Node) []FoundImage {
+	var images []FoundImage
 
-	// 2. 从template.spec中提取镜像（Deployment, StatefulSet等资源）
-	if template, ok := spec["template"].(map[interface{}]interface{}); ok {
-		if podSpec, ok := template["spec"].(map[interface{}]interface{}); ok {
-			images = append(images, extractImagesFromSpec(podSpec)...)  
+	for _, container := range containers.Content {
+		if image := mappingValue(container, "image"); image != nil && image.Kind == yaml.ScalarNode && image.Value != "" {
+			images = append(images, FoundImage{
+				Image:     image.Value,
+				Container: scalarValue(mappingValue(container, "name")),
+				Line:      image.Line,
+				Column:    image.Column,
+			})
 		}
 	}
 
 	return images
 }
 
-// extractImagesFromContainerList 从容器列表中提取镜像
-func extractImagesFromContainerList(containers []interface{}) []string {
-	var images []string
+// findImageNode 查找值为image且尚未对应过记录的标量节点，返回其所在的映射和节点本身
+// 优先匹配image字段，找不到时再匹配任意字段，适用于用户配置的其他字段名。
+func findImageNode(node *yaml.Node, image string, claimed map[*yaml.Node]bool) (*yaml.Node, *yaml.Node) {
+	if parent, found := findScalar(node, image, "image", claimed); found != nil {
+		return parent, found
+	}
+	return findScalar(node, image, "", claimed)
+}
 
-	for _, container := range containers {
-		if containerMap, ok := container.(map[interface{}]interface{}); ok {
-			if image, ok := containerMap["image"].(string); ok && image != "" {
-				images = append(images, image)
+// findScalar 按文档顺序查找映射中值为value的标量字段，key为空时匹配任意字段以及列表中的元素
+func findScalar(node *yaml.Node, value, key string, claimed map[*yaml.Node]bool) (*yaml.Node, *yaml.Node) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			k, v := node.Content[i], node.Content[i+1]
+			if v.Kind == yaml.ScalarNode && v.Value == value && (key == "" || k.Value == key) && !claimed[v] {
+				return node, v
+			}
+			if parent, found := findScalar(v, value, key, claimed); found != nil {
+				return parent, found
+			}
+		}
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			if item.Kind == yaml.ScalarNode && item.Value == value && key == "" && !claimed[item] {
+				return node, item
+			}
+			if parent, found := findScalar(item, value, key, claimed); found != nil {
+				return parent, found
 			}
 		}
 	}
+	return nil, nil
+}
 
-	return images
+// mappingValue 返回映射节点中指定键的值，不存在时返回nil
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// scalarValue 返回标量节点的值，节点不存在或不是标量时返回空字符串
+func scalarValue(node *yaml.Node) string {
+	if node == nil || node.Kind != yaml.ScalarNode {
+		return ""
+	}
+	return node.Value
+}
+
+// yamlDocument 多文档YAML中的单个文档
+type yamlDocument struct {
+	Content string
+	// Line 文档之前的行数，文档内的行号加上该值即为在整个内容中的行号
+	Line int
 }
 
 // splitYAML 分割多文档YAML内容
-func splitYAML(content string) []string {
-	var docs []string
-	parts := strings.Split(content, "---")
+// 只把单独成行的 --- 视为文档分隔符，字符串中出现的 --- 不受影响。
+func splitYAML(content string) []yamlDocument {
+	var docs []yamlDocument
+
+	start := 0
+	bounds := append(documentSeparator.FindAllStringIndex(content, -1), []int{len(content), len(content)})
+	for _, bound := range bounds {
+		part := content[start:bound[0]]
+		offset := start
+		start = bound[1]
 
-	for _, part := range parts {
 		trimmed := strings.TrimSpace(part)
-		if trimmed != "" {
-			docs = append(docs, trimmed)
+		if trimmed == "" {
+			continue
 		}
+		// 只去掉开头的空行，保留第一行的缩进，否则整体缩进的文档无法解析，列号也会偏移
+		body := part[strings.LastIndex(part[:strings.Index(part, trimmed)], "\n")+1:]
+		leading := offset + len(part) - len(body)
+		docs = append(docs, yamlDocument{
+			Content: strings.TrimRightFunc(body, unicode.IsSpace),
+			Line:    strings.Count(content[:leading], "\n"),
+		})
 	}
 
 	return docs
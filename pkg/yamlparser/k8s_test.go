@@ -0,0 +1,179 @@
+package yamlparser
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseK8sFile(t *testing.T) {
+	backupPaths := []ImagePath{
+		{APIVersion: "backup.example.com", Kind: "BackupPolicy", Path: "{.spec.agent.image}"},
+		{APIVersion: "backup.example.com/v1", Kind: "BackupPolicy", Path: ".spec.restore.runnerImage"},
+		{Kind: "BackupPolicy", Path: "{.spec.plugins}"},
+	}
+
+	tests := []struct {
+		file       string
+		imagePaths []ImagePath
+		want       []FoundImage
+	}{
+		{
+			file: "workloads.yaml",
+			want: []FoundImage{
+				{Image: "registry.example.com/web/migrate:1.0", Document: 1, Kind: "Deployment", Name: "web", Container: "migrate", Line: 11, Column: 18},
+				{Image: "nginx:1.25", Document: 1, Kind: "Deployment", Name: "web", Container: "nginx", Line: 14, Column: 18},
+				{Image: "busybox:1.36", Document: 1, Kind: "Deployment", Name: "web", Container: "sidecar", Line: 16, Column: 18},
+				{Image: "ghcr.io/example/backup@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", Document: 3, Kind: "CronJob", Name: "backup", Container: "backup", Line: 38, Column: 22},
+				{Image: "alpine:3.19", Document: 4, Kind: "Pod", Name: "debug", Container: "app", Line: 50, Column: 18},
+				{Image: "nicolaka/netshoot", Document: 4, Kind: "Pod", Name: "debug", Container: "debugger", Line: 53, Column: 18},
+				{Image: "postgres:16", Document: 4, Kind: "StatefulSet", Name: "db", Container: "postgres", Line: 62, Column: 39},
+			},
+		},
+		{
+			file: "tekton.yaml",
+			want: []FoundImage{
+				{Image: "alpine/git:2.43.0", Document: 1, Kind: "Task", Name: "build", Container: "clone", Line: 10, Column: 14},
+				{Image: "gcr.io/kaniko-project/executor:v1.19.2", Document: 1, Kind: "Task", Name: "build", Container: "build", Line: 12, Column: 14},
+				{Image: "registry:2", Document: 1, Kind: "Task", Name: "build", Container: "registry", Line: 15, Column: 14},
+				{Image: "alpine:3.19", Document: 1, Kind: "Task", Name: "build", Line: 7, Column: 12},
+				{Image: "golang:1.24", Document: 2, Kind: "PipelineRun", Name: "release", Container: "unit", Line: 28, Column: 22},
+			},
+		},
+		{
+			file: "argo.yaml",
+			want: []FoundImage{
+				{Image: "docker/whalesay:latest", Document: 1, Kind: "Workflow", Name: "hello", Line: 10, Column: 16},
+				{Image: "python:3.12-alpine", Document: 1, Kind: "Workflow", Name: "hello", Line: 13, Column: 16},
+				{Image: "quay.io/example/report:v2", Document: 2, Kind: "CronWorkflow", Name: "nightly", Line: 26, Column: 18},
+				{Image: "argoproj/rollouts-demo:blue", Document: 3, Kind: "Rollout", Name: "canary", Container: "app", Line: 38, Column: 18},
+			},
+		},
+		{
+			file: "prometheus.yaml",
+			want: []FoundImage{
+				{Image: "quay.io/prometheus-operator/prometheus-config-reloader:v0.70.0", Document: 1, Kind: "Prometheus", Name: "k8s", Container: "config-reloader", Line: 9, Column: 14},
+				{Image: "quay.io/prometheus/prometheus:v2.48.0", Document: 1, Kind: "Prometheus", Name: "k8s", Line: 6, Column: 10},
+				{Image: "quay.io/prometheus/alertmanager:v0.26.0", Document: 2, Kind: "Alertmanager", Name: "main", Line: 16, Column: 10},
+				{Image: "quay.io/thanos/thanos:v0.33.0", Document: 3, Kind: "ThanosRuler", Name: "ruler", Line: 23, Column: 10},
+			},
+		},
+		{
+			file: "kruise.yaml",
+			want: []FoundImage{
+				{Image: "nginx:1.25", Document: 1, Kind: "ImagePullJob", Name: "prewarm", Line: 6, Column: 10},
+				{Image: "registry.example.com/app:v3", Document: 2, Kind: "CloneSet", Name: "app", Container: "main", Line: 18, Column: 18},
+			},
+		},
+		{
+			// Knative Service的Pod模板由通用的Pod规格查找覆盖，未命名的容器没有容器名
+			file: "knative.yaml",
+			want: []FoundImage{
+				{Image: "registry.example.com/hello/migrate:1.2", Document: 1, Kind: "Service", Name: "hello", Container: "migrate", Line: 13, Column: 18},
+				{Image: "gcr.io/knative-samples/helloworld-go", Document: 1, Kind: "Service", Name: "hello", Line: 15, Column: 18},
+				{Image: "ghcr.io/example/envoy:v1.29", Document: 1, Kind: "Service", Name: "hello", Container: "sidecar", Line: 22, Column: 18},
+			},
+		},
+		{
+			// 未配置镜像路径时自定义CRD中没有可识别的镜像
+			file: "custom-crd.yaml",
+			want: []FoundImage{},
+		},
+		{
+			file:       "custom-crd.yaml",
+			imagePaths: backupPaths,
+			want: []FoundImage{
+				{Image: "registry.example.com/backup/agent:1.4", Document: 1, Kind: "BackupPolicy", Name: "daily", Container: "agent", Line: 9, Column: 12},
+				{Image: "registry.example.com/backup/runner:1.4", Document: 1, Kind: "BackupPolicy", Name: "daily", Line: 11, Column: 18},
+				{Image: "registry.example.com/backup/plugin-s3:1.0", Document: 1, Kind: "BackupPolicy", Name: "daily", Line: 13, Column: 7},
+				{Image: "registry.example.com/backup/plugin-gcs:1.0", Document: 1, Kind: "BackupPolicy", Name: "daily", Line: 14, Column: 7},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		name := tt.file
+		if len(tt.imagePaths) > 0 {
+			name += " with image paths"
+		}
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join("testdata", "k8s", tt.file)
+			got, err := parseK8sFile(path, ParseOptions{ImagePaths: tt.imagePaths})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("found %d images, want %d:\n%s", len(got), len(tt.want), formatImages(got))
+			}
+			for i, want := range tt.want {
+				want.File = path
+				got[i].Duplicates = nil
+				if got[i].Image != want.Image || got[i].File != want.File || got[i].Document != want.Document ||
+					got[i].Kind != want.Kind || got[i].Name != want.Name || got[i].Container != want.Container ||
+					got[i].Line != want.Line || got[i].Column != want.Column {
+					t.Errorf("image %d:\n got %+v\nwant %+v", i, got[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseK8sContentLineOffsets(t *testing.T) {
+	// 文档前的空行和注释不影响行号
+	content := "\n\n# leading comment\n---\n\napiVersion: v1\nkind: Pod\nmetadata:\n  name: a\nspec:\n  containers:\n    - image: nginx\n---\n---\napiVersion: v1\nkind: Pod\nmetadata:\n  name: b\nspec:\n  containers:\n  - image:   redis\n"
+	got, err := ParseK8sContent(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FoundImage{
+		{Image: "nginx", Document: 2, Kind: "Pod", Name: "a", Line: 12, Column: 14},
+		{Image: "redis", Document: 3, Kind: "Pod", Name: "b", Line: 21, Column: 14},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("found %d images, want %d:\n%s", len(got), len(want), formatImages(got))
+	}
+	for i := range want {
+		if got[i].Image != want[i].Image || got[i].Document != want[i].Document || got[i].Name != want[i].Name ||
+			got[i].Line != want[i].Line || got[i].Column != want[i].Column {
+			t.Errorf("image %d:\n got %+v\nwant %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestParseK8sContentErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		opts    ParseOptions
+		want    string
+	}{
+		{
+			name:    "no resources",
+			content: "name: web\nimage: nginx\n",
+			want:    "没有找到有效的Kubernetes资源",
+		},
+		{
+			name:    "invalid image path",
+			content: "apiVersion: v1\nkind: Pod\n",
+			opts:    ParseOptions{ImagePaths: []ImagePath{{Path: "{.spec[}"}}},
+			want:    "无效的镜像路径",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseK8sContentWithOptions(tt.content, tt.opts)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// formatImages 每行一个镜像，用于失败时显示实际结果
+func formatImages(images []FoundImage) string {
+	var sb strings.Builder
+	for _, image := range images {
+		sb.WriteString(image.Image + " " + image.Location() + " " + image.Kind + "/" + image.Name + " " + image.Container + "\n")
+	}
+	return sb.String()
+}
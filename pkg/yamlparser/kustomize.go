@@ -0,0 +1,56 @@
+package yamlparser
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"sigs.k8s.io/kustomize/api/konfig"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+// IsKustomization 判断路径是否为kustomization：包含kustomization.yaml的目录或kustomization文件本身
+func IsKustomization(path string) bool {
+	names := konfig.RecognizedKustomizationFileNames()
+	if slices.Contains(names, filepath.Base(path)) {
+		return true
+	}
+	info, err := os.Stat(path)
+	if err != nil || !info.IsDir() {
+		return false
+	}
+	for _, name := range names {
+		if _, err := os.Stat(filepath.Join(path, name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseKustomization 构建kustomization并从最终输出中提取镜像
+// 构建过程与 kustomize build 相同，images 中对名称、标签和摘要的替换已经生效。
+func ParseKustomization(path string, opts ParseOptions) ([]FoundImage, error) {
+	dir := path
+	if info, err := os.Stat(path); err == nil && !info.IsDir() {
+		dir = filepath.Dir(path)
+	}
+
+	kustomizer := krusty.MakeKustomizer(krusty.MakeDefaultOptions())
+	resources, err := kustomizer.Run(filesys.MakeFsOnDisk(), dir)
+	if err != nil {
+		return nil, fmt.Errorf("构建kustomization %s 失败: %w", dir, err)
+	}
+
+	content, err := resources.AsYaml()
+	if err != nil {
+		return nil, fmt.Errorf("输出kustomization %s 的构建结果失败: %w", dir, err)
+	}
+	if len(content) == 0 {
+		return []FoundImage{}, nil
+	}
+
+	images, err := ParseK8sContentWithOptions(string(content), opts)
+	return renderedImages(images, path), err
+}
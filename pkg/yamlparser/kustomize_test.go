@@ -0,0 +1,79 @@
+package yamlparser
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseKustomization(t *testing.T) {
+	base := filepath.Join("testdata", "kustomize", "base")
+	prod := filepath.Join("testdata", "kustomize", "overlays", "prod")
+	digest := "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+
+	tests := []struct {
+		name string
+		path string
+		want []renderedImage
+	}{
+		{
+			name: "base",
+			path: base,
+			want: []renderedImage{
+				{Image: "nginx:1.25", Kind: "Deployment", Name: "web", Container: "web"},
+				{Image: "prom/nginx-exporter:1.1", Kind: "Deployment", Name: "web", Container: "metrics"},
+			},
+		},
+		{
+			// images 中的替换对overlay自己的资源和base中的资源都生效
+			name: "overlay",
+			path: prod,
+			want: []renderedImage{
+				{Image: "registry.example.com/nginx:1.27", Kind: "Deployment", Name: "prod-web", Container: "web"},
+				{Image: "prom/nginx-exporter@" + digest, Kind: "Deployment", Name: "prod-web", Container: "metrics"},
+				{Image: "registry.example.com/nginx:1.27", Kind: "Job", Name: "prod-migrate", Container: "migrate"},
+			},
+		},
+		{
+			// 指定kustomization文件时按所在目录构建，出处保留文件路径
+			name: "kustomization file",
+			path: filepath.Join(base, "kustomization.yaml"),
+			want: []renderedImage{
+				{Image: "nginx:1.25", Kind: "Deployment", Name: "web", Container: "web"},
+				{Image: "prom/nginx-exporter:1.1", Kind: "Deployment", Name: "web", Container: "metrics"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			images, err := ParseKustomization(tt.path, ParseOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantRenderedImages(t, images, tt.path, tt.want)
+		})
+	}
+}
+
+func TestParseKustomizationErrors(t *testing.T) {
+	broken := filepath.Join("testdata", "kustomize", "overlays", "broken")
+	if _, err := ParseKustomization(broken, ParseOptions{}); err == nil || !strings.Contains(err.Error(), "构建kustomization") {
+		t.Errorf("ParseKustomization(broken) error = %v", err)
+	}
+}
+
+func TestIsKustomization(t *testing.T) {
+	tests := map[string]bool{
+		filepath.Join("testdata", "kustomize", "base"):                       true,
+		filepath.Join("testdata", "kustomize", "base", "kustomization.yaml"): true,
+		filepath.Join("testdata", "kustomize", "base", "deployment.yaml"):    false,
+		filepath.Join("testdata", "kustomize"):                               false,
+		"Kustomization":                                                      true,
+	}
+	for path, want := range tests {
+		if got := IsKustomization(path); got != want {
+			t.Errorf("IsKustomization(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
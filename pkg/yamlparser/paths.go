@@ -0,0 +1,104 @@
+package yamlparser
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// ImagePath 指定资源中镜像字段的位置
+type ImagePath struct {
+	// APIVersion 资源的API版本，只写API组（如 tekton.dev）时匹配该组的所有版本，为空时匹配所有资源
+	APIVersion string `yaml:"api_version"`
+	// Kind 资源类型，为空时匹配所有类型
+	Kind string `yaml:"kind"`
+	// Path kubectl风格的JSONPath表达式，如 {.spec.steps[*].image}，可省略外层花括号
+	Path string `yaml:"path"`
+}
+
+// knownImagePaths 镜像不在Pod规格中的常见CRD
+// 内嵌Pod模板的资源（Argo Rollouts、Knative Service、OpenKruise CloneSet等）由通用的Pod规格查找覆盖，无需在此登记。
+var knownImagePaths = []ImagePath{
+	// Tekton：步骤和边车容器不在Pod规格中，PipelineRun等可能内嵌taskSpec，使用递归查找
+	{APIVersion: "tekton.dev", Path: "{..steps[*].image}"},
+	{APIVersion: "tekton.dev", Path: "{..sidecars[*].image}"},
+	{APIVersion: "tekton.dev", Path: "{..stepTemplate.image}"},
+	// Argo Workflows：Workflow、WorkflowTemplate、CronWorkflow等模板中的container和script
+	{APIVersion: "argoproj.io", Path: "{..templates[*].container.image}"},
+	{APIVersion: "argoproj.io", Path: "{..templates[*].script.image}"},
+	// Prometheus Operator：主容器镜像通过spec.image指定
+	{APIVersion: "monitoring.coreos.com", Kind: "Prometheus", Path: "{.spec.image}"},
+	{APIVersion: "monitoring.coreos.com", Kind: "Alertmanager", Path: "{.spec.image}"},
+	{APIVersion: "monitoring.coreos.com", Kind: "ThanosRuler", Path: "{.spec.image}"},
+	// OpenKruise：预热镜像任务
+	{APIVersion: "apps.kruise.io", Kind: "ImagePullJob", Path: "{.spec.image}"},
+}
+
+// compiledImagePath 解析后的镜像路径
+type compiledImagePath struct {
+	ImagePath
+	expr *jsonpath.JSONPath
+}
+
+// compileImagePaths 解析所有镜像路径的JSONPath表达式
+func compileImagePaths(paths []ImagePath) ([]compiledImagePath, error) {
+	compiled := make([]compiledImagePath, 0, len(paths))
+	for _, path := range paths {
+		text := strings.TrimSpace(path.Path)
+		if !strings.HasPrefix(text, "{") {
+			text = "{" + text + "}"
+		}
+		expr := jsonpath.New(path.Kind).AllowMissingKeys(true)
+		if err := expr.Parse(text); err != nil {
+			return nil, fmt.Errorf("无效的镜像路径 %q: %w", path.Path, err)
+		}
+		compiled = append(compiled, compiledImagePath{ImagePath: path, expr: expr})
+	}
+	return compiled, nil
+}
+
+// matches 判断路径是否适用于指定的资源
+func (p compiledImagePath) matches(apiVersion, kind string) bool {
+	if p.Kind != "" && p.Kind != kind {
+		return false
+	}
+	if p.APIVersion == "" || p.APIVersion == apiVersion {
+		return true
+	}
+	// 只写API组时匹配该组的所有版本
+	return !strings.Contains(p.APIVersion, "/") && strings.HasPrefix(apiVersion, p.APIVersion+"/")
+}
+
+// find 在解码后的资源中查找镜像，结果为字符串列表时每一项都视为一个镜像
+func (p compiledImagePath) find(data interface{}) ([]string, error) {
+	results, err := p.expr.FindResults(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var images []string
+	var collect func(value reflect.Value)
+	collect = func(value reflect.Value) {
+		if value.Kind() == reflect.Interface {
+			value = value.Elem()
+		}
+		switch value.Kind() {
+		case reflect.String:
+			if value.String() != "" {
+				images = append(images, value.String())
+			}
+		case reflect.Slice:
+			for i := 0; i < value.Len(); i++ {
+				collect(value.Index(i))
+			}
+		}
+	}
+	for _, group := range results {
+		for _, value := range group {
+			collect(value)
+		}
+	}
+	return images, nil
+}
@@ -0,0 +1,134 @@
+package yamlparser
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// StdinPath 表示从标准输入读取清单的路径
+	StdinPath = "-"
+	// stdinName 记录镜像出处时标准输入使用的名称
+	stdinName = "<stdin>"
+	// maxRemoteSize 从标准输入或URL读取的内容大小上限
+	maxRemoteSize = 64 << 20
+	// fetchTimeout 下载清单的超时时间
+	fetchTimeout = 60 * time.Second
+)
+
+// IsRemotePath 判断 -f 的参数是标准输入（-）或 http(s) URL
+func IsRemotePath(p string) bool {
+	return p == StdinPath || isURL(p)
+}
+
+// isURL 判断路径是否为 http(s) URL
+func isURL(p string) bool {
+	return strings.HasPrefix(p, "http://") || strings.HasPrefix(p, "https://")
+}
+
+// parseRemote 读取标准输入或URL中的清单并提取镜像
+// 类型按内容判断而不是按名称；URL指向打包的Helm Chart（.tgz）或指定了 --type helm 时下载后渲染。
+func parseRemote(p string, opts ParseOptions) ([]FoundImage, error) {
+	if name := urlPath(p); isURL(p) && (opts.Type == FileTypeHelm || strings.HasSuffix(name, ".tgz") || strings.HasSuffix(name, ".tar.gz")) {
+		reportDetection(p, Detection{FileTypeHelm, ConfidenceMedium, "打包的Chart"}, opts)
+		return parseRemoteChart(p, opts)
+	}
+
+	content, err := readRemote(p)
+	if err != nil {
+		return nil, err
+	}
+
+	detection := detectContent(content, opts)
+	reportDetection(remoteName(p), detection, opts)
+	if detection.Type == FileTypeUnknown {
+		return nil, fmt.Errorf("%s: 无法判断内容类型（%s），请使用 --type 指定", remoteName(p), detection.Reason)
+	}
+
+	images, err := ParseContentWithOptions(string(content), detection.Type, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", remoteName(p), err)
+	}
+	// Compose文件中构建用的Dockerfile保留自己的路径
+	for i := range images {
+		if images[i].File == "" {
+			images[i].File = remoteName(p)
+		}
+	}
+	return images, nil
+}
+
+// parseRemoteChart 下载打包的Helm Chart到临时文件后渲染
+func parseRemoteChart(url string, opts ParseOptions) ([]FoundImage, error) {
+	content, err := readRemote(url)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.CreateTemp("", "image-shipper-chart-*.tgz")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err := file.Close(); err != nil {
+		return nil, err
+	}
+
+	images, err := ParseHelmChart(file.Name(), opts)
+	for i := range images {
+		images[i].File = url
+	}
+	return images, err
+}
+
+// readRemote 读取标准输入或下载URL的内容
+func readRemote(p string) ([]byte, error) {
+	var reader io.Reader
+	if p == StdinPath {
+		reader = os.Stdin
+	} else {
+		client := &http.Client{Timeout: fetchTimeout}
+		resp, err := client.Get(p)
+		if err != nil {
+			return nil, fmt.Errorf("下载 %s 失败: %w", p, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("下载 %s 失败: HTTP %d", p, resp.StatusCode)
+		}
+		reader = resp.Body
+	}
+
+	content, err := io.ReadAll(io.LimitReader(reader, maxRemoteSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("读取 %s 失败: %w", remoteName(p), err)
+	}
+	if len(content) > maxRemoteSize {
+		return nil, fmt.Errorf("%s 超过 %d MB", remoteName(p), maxRemoteSize>>20)
+	}
+	return content, nil
+}
+
+// remoteName 返回记录镜像出处时使用的名称
+func remoteName(p string) string {
+	if p == StdinPath {
+		return stdinName
+	}
+	return p
+}
+
+// urlPath 去掉URL中的查询参数和片段，用于按扩展名判断类型
+func urlPath(url string) string {
+	if i := strings.IndexAny(url, "?#"); i >= 0 {
+		return url[:i]
+	}
+	return url
+}
@@ -0,0 +1,172 @@
+package yamlparser
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// remoteManifests 进程内HTTP服务提供的清单，键为路径
+var remoteManifests = map[string]string{
+	"/deploy.yaml": "apiVersion: v1\nkind: Pod\nmetadata:\n  name: web\nspec:\n  containers:\n    - name: nginx\n      image: nginx:1.25\n",
+	"/raw":         "services:\n  db:\n    image: postgres:16\n  debug:\n    image: busybox:1.36\n    profiles: [debug]\n",
+	"/build":       "# syntax=docker/dockerfile:1\nFROM golang:1.24\n",
+	"/notes.txt":   "just some notes\n",
+}
+
+// newManifestServer 启动提供remoteManifests的HTTP服务，其他路径返回404
+func newManifestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, ok := remoteManifests[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(content))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestParseRemoteURL(t *testing.T) {
+	server := newManifestServer(t)
+
+	tests := []struct {
+		name string
+		path string
+		opts ParseOptions
+		// want 期望的镜像，出处均为URL
+		want     []string
+		wantType FileType
+		wantErr  string
+	}{
+		{
+			name:     "kubernetes",
+			path:     "/deploy.yaml",
+			want:     []string{"nginx:1.25"},
+			wantType: FileTypeK8s,
+		},
+		{
+			// 没有扩展名时按内容判断类型
+			name:     "compose by content",
+			path:     "/raw?token=abc",
+			want:     []string{"postgres:16"},
+			wantType: FileTypeCompose,
+		},
+		{
+			name:     "compose profile",
+			path:     "/raw",
+			opts:     ParseOptions{Profiles: []string{"debug"}},
+			want:     []string{"postgres:16", "busybox:1.36"},
+			wantType: FileTypeCompose,
+		},
+		{
+			name:     "dockerfile",
+			path:     "/build",
+			want:     []string{"docker/dockerfile:1", "golang:1.24"},
+			wantType: FileTypeDockerfile,
+		},
+		{
+			name:     "forced type",
+			path:     "/deploy.yaml",
+			opts:     ParseOptions{Type: FileTypeCompose},
+			wantType: FileTypeCompose,
+			wantErr:  "解析YAML内容失败",
+		},
+		{
+			name:     "unknown content",
+			path:     "/notes.txt",
+			wantType: FileTypeUnknown,
+			wantErr:  "无法判断内容类型",
+		},
+		{
+			// 下载失败时不判断类型
+			name:     "not found",
+			path:     "/missing.yaml",
+			wantType: FileTypeUnknown,
+			wantErr:  "HTTP 404",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("COMPOSE_PROFILES", "")
+			url := server.URL + tt.path
+			detected := FileTypeUnknown
+			tt.opts.OnDetect = func(name string, detection Detection) {
+				if name != url {
+					t.Errorf("OnDetect name = %q, want %q", name, url)
+				}
+				detected = detection.Type
+			}
+
+			images, err := ParseFileWithOptions(url, tt.opts)
+			if detected != tt.wantType {
+				t.Errorf("detected %s, want %s", detected, tt.wantType)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if names := ImageNames(images); strings.Join(names, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("images = %q, want %q", names, tt.want)
+			}
+			for _, image := range images {
+				if image.File != url {
+					t.Errorf("%s has file %q, want %q", image.Image, image.File, url)
+				}
+			}
+		})
+	}
+}
+
+func TestParseRemoteStdin(t *testing.T) {
+	stdin, err := os.Create(filepath.Join(t.TempDir(), "stdin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := "---\napiVersion: v1\nkind: Pod\nmetadata:\n  name: web\nspec:\n  containers:\n    - name: app\n      image: alpine:3.19\n"
+	if _, err := stdin.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stdin.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+	original := os.Stdin
+	os.Stdin = stdin
+	t.Cleanup(func() { os.Stdin = original })
+
+	images, err := ParseFilesWithOptions([]string{StdinPath}, ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 1 || images[0].Image != "alpine:3.19" || images[0].Source() != "<stdin>:9 (文档 1, Pod/web, 容器 app)" {
+		t.Errorf("images =\n%s", formatImages(images))
+	}
+}
+
+func TestIsRemotePath(t *testing.T) {
+	tests := map[string]bool{
+		"-":                                true,
+		"https://example.com/deploy.yaml":  true,
+		"http://example.com/chart.tgz?x=1": true,
+		"deploy.yaml":                      false,
+		"./-":                              false,
+		"ftp://example.com/deploy.yaml":    false,
+	}
+	for path, want := range tests {
+		if got := IsRemotePath(path); got != want {
+			t.Errorf("IsRemotePath(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,369 @@
+package yamlparser
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+	"sigs.k8s.io/kustomize/api/konfig"
+
+	"github.com/keevingness/image-shipper/pkg/docker"
+)
+
+// RewriteFunc 返回镜像改写后的地址，不需要改写时返回false
+type RewriteFunc func(image string) (string, bool)
+
+// ImageEdit 文件中的一处镜像改写
+type ImageEdit struct {
+	FoundImage
+	// NewImage 改写后的镜像地址
+	NewImage string
+}
+
+// RewriteResult 改写单个文件的结果
+type RewriteResult struct {
+	// File 被改写的文件，kustomization为其中的kustomization.yaml
+	File string
+	// Original 改写前的文件内容
+	Original []byte
+	// Content 改写后的文件内容
+	Content []byte
+	// Edits 实际完成的改写
+	Edits []ImageEdit
+}
+
+// Changed 判断文件内容是否有变化
+func (r *RewriteResult) Changed() bool {
+	return len(r.Edits) > 0
+}
+
+// textEdit 对原始内容的一次文本替换，Start和End为字节偏移
+type textEdit struct {
+	Start int
+	End   int
+	Text  string
+}
+
+// RewriteFile 改写文件中的镜像地址，只替换镜像字段所在的文本，注释和格式保持不变
+// 支持Kubernetes、Compose文件、Dockerfile和kustomization；kustomization通过其中的 images 改写，不修改引用的资源文件。
+// Dockerfile中通过ARG指定的镜像无法原样替换，会给出警告后跳过。
+// Helm Chart中的镜像由values决定，不支持直接改写。
+func RewriteFile(filePath string, opts ParseOptions, rewrite RewriteFunc) (*RewriteResult, error) {
+	if IsRemotePath(filePath) {
+		return nil, fmt.Errorf("只能改写本地文件，不支持 %s", remoteName(filePath))
+	}
+
+	detection := detectFile(filePath, opts)
+	switch detection.Type {
+	case FileTypeHelm:
+		return nil, fmt.Errorf("不支持改写Helm Chart %s，请在values文件中修改镜像地址", filePath)
+	case FileTypeKustomize:
+		return rewriteKustomization(filePath, opts, rewrite)
+	case FileTypeUnknown:
+		return nil, fmt.Errorf("无法判断 %s 的类型（%s），请使用 --type 指定", filePath, detection.Reason)
+	}
+	reportDetection(filePath, detection, opts)
+
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("无法读取文件 %s: %w", filePath, err)
+	}
+
+	var images []FoundImage
+	switch detection.Type {
+	case FileTypeCompose:
+		images = composeRewriteImages(content)
+	case FileTypeDockerfile:
+		images, err = ParseDockerfileContent(string(content))
+	default:
+		images, err = ParseK8sContentWithOptions(string(content), opts)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解析文件 %s 失败: %w", filePath, err)
+	}
+
+	var edits []textEdit
+	edited := map[int]bool{}
+	result := &RewriteResult{File: filePath, Original: content}
+	for _, image := range images {
+		image.File = filePath
+		newImage, ok := rewrite(image.Image)
+		if !ok || newImage == image.Image {
+			continue
+		}
+		if image.Line == 0 {
+			fmt.Printf("警告: %s 无法确定镜像 %s 的位置，跳过\n", image.Source(), image.Image)
+			continue
+		}
+		edit, err := scalarEdit(content, image.Line, image.Column, image.Image, newImage)
+		if err != nil {
+			fmt.Printf("警告: %s: %v，跳过\n", image.Source(), err)
+			continue
+		}
+		// Pod规格和镜像路径可能找到同一个字段
+		if edited[edit.Start] {
+			continue
+		}
+		edited[edit.Start] = true
+		edits = append(edits, edit)
+		result.Edits = append(result.Edits, ImageEdit{FoundImage: image, NewImage: newImage})
+	}
+
+	result.Content = applyTextEdits(content, edits)
+	return result, nil
+}
+
+// composeRewriteImages 返回Compose文件中可以改写的镜像
+// 设置了build的服务中image是构建结果的名称，不改写；包含变量的镜像地址在插值前无法确定，跳过。
+func composeRewriteImages(content []byte) []FoundImage {
+	var images []FoundImage
+	for _, service := range composeServiceNodes(content) {
+		image := mappingValue(service.Node, "image")
+		if image == nil || image.Kind != yaml.ScalarNode || image.Value == "" || mappingValue(service.Node, "build") != nil {
+			continue
+		}
+		if strings.Contains(image.Value, "$") {
+			fmt.Printf("警告: 服务 %s 的镜像 %s 包含变量，跳过\n", service.Name, image.Value)
+			continue
+		}
+		images = append(images, FoundImage{
+			Image:     image.Value,
+			Name:      service.Name,
+			Container: scalarValue(mappingValue(service.Node, "container_name")),
+			Line:      image.Line,
+			Column:    image.Column,
+		})
+	}
+	return images
+}
+
+// rewriteKustomization 通过kustomization中的 images 改写构建结果中的镜像
+// 已有的条目修改或补充newName，没有条目的镜像在 images 开头新增条目；标签和摘要保持不变。
+func rewriteKustomization(path string, opts ParseOptions, rewrite RewriteFunc) (*RewriteResult, error) {
+	file, err := kustomizationFile(path)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("无法读取文件 %s: %w", file, err)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(content, &root); err != nil {
+		return nil, fmt.Errorf("解析文件 %s 失败: %w", file, err)
+	}
+	if len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s 不是有效的kustomization", file)
+	}
+	imagesNode := mappingValue(root.Content[0], "images")
+
+	// 构建结果中的镜像名称对应的已有条目
+	entries := map[string]*yaml.Node{}
+	if imagesNode != nil && imagesNode.Kind == yaml.SequenceNode {
+		for _, entry := range imagesNode.Content {
+			name := scalarValue(mappingValue(entry, "newName"))
+			if name == "" {
+				name = scalarValue(mappingValue(entry, "name"))
+			}
+			if name != "" {
+				entries[name] = entry
+			}
+		}
+	}
+
+	built, err := ParseKustomization(path, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var edits []textEdit
+	var added []string
+	handled := map[string]bool{}
+	result := &RewriteResult{File: file, Original: content}
+	for _, image := range DedupImages(built) {
+		newImage, ok := rewrite(image.Image)
+		if !ok {
+			continue
+		}
+		ref, err := docker.ParseReference(image.Image)
+		if err != nil {
+			continue
+		}
+		newRef, err := docker.ParseReference(newImage)
+		if err != nil || newRef.Name() == ref.Name() || handled[ref.Name()] {
+			continue
+		}
+		// 同一名称的不同标签共用一个条目
+		handled[ref.Name()] = true
+		record := FoundImage{Image: image.Image, File: file, Kind: image.Kind, Name: image.Name, Container: image.Container}
+
+		entry, ok := entries[ref.Name()]
+		if !ok {
+			added = append(added, fmt.Sprintf("name: %s\nnewName: %s\n", ref.Name(), newRef.Name()))
+			result.Edits = append(result.Edits, ImageEdit{FoundImage: record, NewImage: newImage})
+			continue
+		}
+
+		var edit textEdit
+		if newName := mappingValue(entry, "newName"); newName != nil {
+			record.Line, record.Column = newName.Line, newName.Column
+			edit, err = scalarEdit(content, newName.Line, newName.Column, newName.Value, newRef.Name())
+		} else {
+			record.Line, record.Column = entry.Line, entry.Column
+			edit, err = insertMappingKey(content, entry, "newName: "+newRef.Name())
+		}
+		if err != nil {
+			fmt.Printf("警告: %s: %v，跳过\n", record.Source(), err)
+			continue
+		}
+		edits = append(edits, edit)
+		result.Edits = append(result.Edits, ImageEdit{FoundImage: record, NewImage: newImage})
+	}
+
+	if len(added) > 0 {
+		edit, err := insertSequenceItems(content, imagesNode, "images", added)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		edits = append(edits, edit)
+	}
+
+	result.Content = applyTextEdits(content, edits)
+	return result, nil
+}
+
+// kustomizationFile 返回kustomization目录中的kustomization文件
+func kustomizationFile(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return path, nil
+	}
+	for _, name := range konfig.RecognizedKustomizationFileNames() {
+		file := filepath.Join(path, name)
+		if _, err := os.Stat(file); err == nil {
+			return file, nil
+		}
+	}
+	return "", fmt.Errorf("%s 中没有kustomization文件", path)
+}
+
+// scalarEdit 将line、column处的标量old替换为value，保留原有的引号
+func scalarEdit(content []byte, line, column int, old, value string) (textEdit, error) {
+	offset, ok := offsetOf(content, line, column)
+	if !ok || offset >= len(content) {
+		return textEdit{}, fmt.Errorf("第%d行第%d列超出文件范围", line, column)
+	}
+	if c := content[offset]; c == '"' || c == '\'' {
+		offset++
+	}
+	if !strings.HasPrefix(string(content[offset:]), old) {
+		return textEdit{}, fmt.Errorf("第%d行的内容不是 %s，无法原样替换", line, old)
+	}
+	return textEdit{Start: offset, End: offset + len(old), Text: value}, nil
+}
+
+// insertMappingKey 在块映射第一个键所在行之后插入一行，缩进与该键一致
+func insertMappingKey(content []byte, mapping *yaml.Node, text string) (textEdit, error) {
+	if mapping.Kind != yaml.MappingNode || mapping.Style&yaml.FlowStyle != 0 || len(mapping.Content) == 0 {
+		return textEdit{}, fmt.Errorf("第%d行不是块映射，无法插入字段", mapping.Line)
+	}
+	key := mapping.Content[0]
+	start, ok := offsetOf(content, key.Line+1, 1)
+	if !ok {
+		start = len(content)
+	}
+	prefix := ""
+	if start == len(content) && !strings.HasSuffix(string(content), "\n") {
+		prefix = "\n"
+	}
+	return textEdit{Start: start, End: start, Text: prefix + strings.Repeat(" ", key.Column-1) + text + "\n"}, nil
+}
+
+// insertSequenceItems 在块序列开头插入若干映射条目，序列不存在时在文件末尾新增
+// 每个条目为多行的 key: value 文本，缩进与序列中已有的条目一致。
+func insertSequenceItems(content []byte, sequence *yaml.Node, key string, items []string) (textEdit, error) {
+	if sequence == nil {
+		var sb strings.Builder
+		if len(content) > 0 && !strings.HasSuffix(string(content), "\n") {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(key + ":\n")
+		for _, item := range items {
+			sb.WriteString(indentItem(item, "- ", "  "))
+		}
+		return textEdit{Start: len(content), End: len(content), Text: sb.String()}, nil
+	}
+	if sequence.Kind != yaml.SequenceNode || sequence.Style&yaml.FlowStyle != 0 || len(sequence.Content) == 0 {
+		return textEdit{}, fmt.Errorf("%s 不是非空的块序列，请手动添加条目", key)
+	}
+
+	// 第一个条目之前的 "- " 决定缩进
+	first := sequence.Content[0]
+	lineStart, _ := offsetOf(content, first.Line, 1)
+	itemStart, _ := offsetOf(content, first.Line, first.Column)
+	head := string(content[lineStart:itemStart])
+	dash := strings.LastIndex(head, "-")
+	if dash < 0 || strings.TrimSpace(head[:dash]) != "" {
+		return textEdit{}, fmt.Errorf("无法确定 %s 的缩进，请手动添加条目", key)
+	}
+
+	var sb strings.Builder
+	for _, item := range items {
+		sb.WriteString(indentItem(item, head, strings.Repeat(" ", len(head))))
+	}
+	return textEdit{Start: lineStart, End: lineStart, Text: sb.String()}, nil
+}
+
+// indentItem 将多行的映射文本格式化为序列条目，首行使用first作为前缀，其余行使用rest
+func indentItem(item, first, rest string) string {
+	var sb strings.Builder
+	for i, line := range strings.Split(strings.TrimSuffix(item, "\n"), "\n") {
+		if i == 0 {
+			sb.WriteString(first + line + "\n")
+		} else {
+			sb.WriteString(rest + line + "\n")
+		}
+	}
+	return sb.String()
+}
+
+// offsetOf 将从1开始的行号和列号（按字符计）转换为字节偏移
+func offsetOf(content []byte, line, column int) (int, bool) {
+	offset := 0
+	for l := 1; l < line; l++ {
+		i := strings.IndexByte(string(content[offset:]), '\n')
+		if i < 0 {
+			return 0, false
+		}
+		offset += i + 1
+	}
+	for c := 1; c < column; c++ {
+		if offset >= len(content) || content[offset] == '\n' {
+			return 0, false
+		}
+		_, size := utf8.DecodeRune(content[offset:])
+		offset += size
+	}
+	if offset > len(content) {
+		return 0, false
+	}
+	return offset, true
+}
+
+// applyTextEdits 按偏移从后向前应用所有替换，返回新的内容
+func applyTextEdits(content []byte, edits []textEdit) []byte {
+	sort.SliceStable(edits, func(i, j int) bool { return edits[i].Start > edits[j].Start })
+	result := string(content)
+	for _, edit := range edits {
+		result = result[:edit.Start] + edit.Text + result[edit.End:]
+	}
+	return []byte(result)
+}
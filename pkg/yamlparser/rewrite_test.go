@@ -0,0 +1,162 @@
+package yamlparser
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// mirrorRewrite 将镜像改写到 mirror.example.com，已经在该仓库中的镜像不改写
+func mirrorRewrite(image string) (string, bool) {
+	if strings.HasPrefix(image, "mirror.example.com/") {
+		return "", false
+	}
+	return "mirror.example.com/" + image, true
+}
+
+func TestRewriteFile(t *testing.T) {
+	tests := []struct {
+		name string
+		// path 相对于 testdata/rewrite 的路径
+		path string
+		// file 被改写的文件，为空时与path相同
+		file string
+		// want 期望的改写结果，相对于 testdata/rewrite
+		want string
+		// edits 期望改写的镜像
+		edits []string
+	}{
+		{
+			name:  "quoted and plain scalars",
+			path:  "scalars.yaml",
+			want:  "scalars.yaml.golden",
+			edits: []string{"registry.example.com/web/migrate:1.0", "nginx:1.25", "redis:7"},
+		},
+		{
+			name:  "multiple documents",
+			path:  "multidoc.yaml",
+			want:  "multidoc.yaml.golden",
+			edits: []string{"alpine:3.19", "busybox:1.36", "ghcr.io/example/backup:2.1"},
+		},
+		{
+			name:  "flow mappings",
+			path:  "flow.yaml",
+			want:  "flow.yaml.golden",
+			edits: []string{"nginx:1.25", "busybox:1.36", "alpine:3.19"},
+		},
+		{
+			// 设置了build的服务和包含变量的镜像保持不变
+			name:  "compose",
+			path:  "compose.yaml",
+			want:  "compose.yaml.golden",
+			edits: []string{"postgres:16", "python:3.12-alpine"},
+		},
+		{
+			// 通过ARG指定的基础镜像无法原样替换，跳过
+			name:  "dockerfile",
+			path:  "Dockerfile",
+			want:  "Dockerfile.golden",
+			edits: []string{"docker/dockerfile:1.7", "gcr.io/distroless/static:nonroot", "alpine:3.19"},
+		},
+		{
+			name:  "kustomization edits newName",
+			path:  "kustomize-edit",
+			file:  "kustomize-edit/kustomization.yaml",
+			want:  "kustomize-edit/kustomization.yaml.golden",
+			edits: []string{"registry.internal/nginx:1.26", "registry.internal/redis:7"},
+		},
+		{
+			name:  "kustomization inserts newName",
+			path:  "kustomize-insert",
+			file:  "kustomize-insert/kustomization.yaml",
+			want:  "kustomize-insert/kustomization.yaml.golden",
+			edits: []string{"nginx:1.26", "redis@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"},
+		},
+		{
+			name:  "kustomization adds entry",
+			path:  "kustomize-append",
+			file:  "kustomize-append/kustomization.yaml",
+			want:  "kustomize-append/kustomization.yaml.golden",
+			edits: []string{"redis:7"},
+		},
+		{
+			name:  "kustomization adds images",
+			path:  "kustomize-new/kustomization.yaml",
+			want:  "kustomize-new/kustomization.yaml.golden",
+			edits: []string{"nginx:1.25", "redis:7"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join("testdata", "rewrite", tt.path)
+			file := path
+			if tt.file != "" {
+				file = filepath.Join("testdata", "rewrite", tt.file)
+			}
+			original, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := os.ReadFile(filepath.Join("testdata", "rewrite", tt.want))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := RewriteFile(path, ParseOptions{}, mirrorRewrite)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.File != file {
+				t.Errorf("File = %s, want %s", result.File, file)
+			}
+			if string(result.Original) != string(original) {
+				t.Errorf("Original does not match %s", file)
+			}
+			if string(result.Content) != string(want) {
+				t.Errorf("content mismatch\n--- got ---\n%s\n--- want ---\n%s", result.Content, want)
+			}
+
+			var edits []string
+			for _, edit := range result.Edits {
+				edits = append(edits, edit.Image)
+				if edit.NewImage != "mirror.example.com/"+edit.Image {
+					t.Errorf("NewImage = %s for %s", edit.NewImage, edit.Image)
+				}
+			}
+			if strings.Join(edits, "\n") != strings.Join(tt.edits, "\n") {
+				t.Errorf("edits = %q, want %q", edits, tt.edits)
+			}
+		})
+	}
+}
+
+func TestRewriteFileErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		opts ParseOptions
+		want string
+	}{
+		{
+			name: "remote",
+			path: "https://example.com/deploy.yaml",
+			want: "只能改写本地文件",
+		},
+		{
+			name: "helm",
+			path: "deploy.yaml",
+			opts: ParseOptions{Type: FileTypeHelm},
+			want: "不支持改写Helm Chart",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := RewriteFile(tt.path, tt.opts, mirrorRewrite)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,347 @@
+package yamlparser
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chartutil"
+	"sigs.k8s.io/kustomize/api/konfig"
+)
+
+// defaultIncludes 扫描目录时默认包含的文件
+var defaultIncludes = []string{"*.yaml", "*.yml", "Dockerfile", "Dockerfile.*", "*.Dockerfile", "Containerfile"}
+
+// IsScanPath 判断 -f 的参数是否需要展开：不是Helm Chart或kustomization的目录，或包含通配符的路径
+func IsScanPath(p string) bool {
+	if IsRemotePath(p) {
+		return false
+	}
+	if info, err := os.Stat(p); err == nil {
+		if !info.IsDir() {
+			return false
+		}
+		fileType := DetectFileType(p)
+		return fileType != FileTypeHelm && fileType != FileTypeKustomize
+	}
+	return hasGlobMeta(p)
+}
+
+// ExpandPaths 将 -f 的参数展开为要解析的文件列表，保持参数的顺序并去掉重复的文件
+// 目录会被递归扫描，通配符支持 ** 匹配任意层目录；Helm Chart和kustomization目录作为整体保留，不会进入其中扫描。
+// 扫描时遵循.gitignore，并按opts.Include和opts.Exclude过滤；直接指定的文件不受过滤影响。
+func ExpandPaths(paths []string, opts ParseOptions) ([]string, error) {
+	var result []string
+	seen := map[string]bool{}
+	add := func(p string) {
+		key := filepath.Clean(p)
+		if !seen[key] {
+			seen[key] = true
+			result = append(result, p)
+		}
+	}
+
+	for _, p := range paths {
+		if !IsScanPath(p) {
+			add(p)
+			continue
+		}
+		files, err := scanPath(p, opts)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			fmt.Printf("警告: %s 中没有找到可解析的文件\n", p)
+		}
+		for _, file := range files {
+			add(file)
+		}
+	}
+	return result, nil
+}
+
+// scanPath 展开单个目录或通配符
+func scanPath(p string, opts ParseOptions) ([]string, error) {
+	root, pattern := p, ""
+	if hasGlobMeta(p) {
+		root, pattern = globRoot(p), filepath.ToSlash(filepath.Clean(p))
+	}
+
+	info, err := os.Stat(root)
+	if err != nil {
+		if pattern != "" && os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, nil
+	}
+
+	includes := opts.Include
+	if len(includes) == 0 {
+		includes = defaultIncludes
+	}
+	ignore := loadParentGitIgnores(root)
+
+	var files []string
+	err = filepath.WalkDir(root, func(current string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, current)
+		rel = filepath.ToSlash(rel)
+
+		if entry.IsDir() {
+			if current == root {
+				ignore.load(current)
+				return nil
+			}
+			if entry.Name() == ".git" || ignore.ignored(current, true) || matchAny(opts.Exclude, rel) {
+				return filepath.SkipDir
+			}
+			// Helm Chart和kustomization作为整体解析
+			if fileType := DetectFileType(current); fileType == FileTypeHelm || fileType == FileTypeKustomize {
+				if pattern == "" || unitMatches(pattern, current) {
+					files = append(files, current)
+				}
+				return filepath.SkipDir
+			}
+			ignore.load(current)
+			return nil
+		}
+
+		if ignore.ignored(current, false) || matchAny(opts.Exclude, rel) {
+			return nil
+		}
+		if pattern != "" && !matchGlob(pattern, filepath.ToSlash(filepath.Clean(current))) {
+			return nil
+		}
+		// 通配符已经限定了文件时，只有显式指定的--include才继续过滤
+		if (pattern == "" || len(opts.Include) > 0) && !matchAny(includes, rel) {
+			return nil
+		}
+		files = append(files, current)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("扫描 %s 失败: %w", p, err)
+	}
+
+	return files, nil
+}
+
+// unitMatches 判断Helm Chart或kustomization目录是否匹配通配符：目录本身或其中的Chart.yaml、kustomization文件匹配即可
+func unitMatches(pattern, dir string) bool {
+	names := append([]string{""}, konfig.RecognizedKustomizationFileNames()...)
+	names = append(names, chartutil.ChartfileName)
+	for _, name := range names {
+		candidate := filepath.Join(dir, name)
+		if name != "" {
+			if _, err := os.Stat(candidate); err != nil {
+				continue
+			}
+		}
+		if matchGlob(pattern, filepath.ToSlash(filepath.Clean(candidate))) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasGlobMeta 判断路径中是否包含通配符
+func hasGlobMeta(p string) bool {
+	return strings.ContainsAny(p, "*?[")
+}
+
+// globRoot 返回通配符之前的目录部分，作为扫描的起点
+func globRoot(pattern string) string {
+	parts := strings.Split(filepath.ToSlash(pattern), "/")
+	for i, part := range parts {
+		if hasGlobMeta(part) {
+			root := strings.Join(parts[:i], "/")
+			if root == "" {
+				if strings.HasPrefix(pattern, "/") {
+					return "/"
+				}
+				return "."
+			}
+			return filepath.FromSlash(root)
+		}
+	}
+	return pattern
+}
+
+// matchAny 判断相对路径是否匹配任意一个模式
+// 不含 '/' 的模式只匹配文件名，例如 *.yaml；含 '/' 的模式匹配相对于扫描目录的完整路径，支持 **。
+func matchAny(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		if !strings.Contains(pattern, "/") {
+			if ok, _ := path.Match(pattern, path.Base(rel)); ok {
+				return true
+			}
+			continue
+		}
+		if matchGlob(strings.TrimPrefix(pattern, "/"), rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob 按 '/' 分段匹配路径，** 匹配零个或多个目录
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+// matchSegments 逐段匹配模式和路径
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// 连续的 ** 等价于一个
+			for len(pattern) > 0 && pattern[0] == "**" {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := range name {
+				if matchSegments(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// ignoreRule .gitignore中的一条规则
+type ignoreRule struct {
+	// base .gitignore所在的目录，规则只作用于该目录下的路径
+	base     string
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// gitIgnore 扫描过程中累积的.gitignore规则，后加载的规则优先
+type gitIgnore struct {
+	rules []ignoreRule
+}
+
+// loadParentGitIgnores 加载从仓库根目录到dir的上级目录中的.gitignore
+// 仓库根目录为包含.git的最近的上级目录，不在仓库中时不加载上级目录的规则。
+func loadParentGitIgnores(dir string) *gitIgnore {
+	ignore := &gitIgnore{}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return ignore
+	}
+	if _, err := os.Stat(filepath.Join(abs, ".git")); err == nil {
+		return ignore
+	}
+
+	var parents []string
+	for current := filepath.Dir(abs); ; current = filepath.Dir(current) {
+		if current == abs {
+			break
+		}
+		parents = append([]string{current}, parents...)
+		if _, err := os.Stat(filepath.Join(current, ".git")); err == nil {
+			break
+		}
+		if current == filepath.Dir(current) {
+			// 到达文件系统根目录仍未找到仓库
+			return ignore
+		}
+	}
+	for _, parent := range parents {
+		ignore.load(parent)
+	}
+	return ignore
+}
+
+// load 读取目录中的.gitignore并追加其中的规则
+func (g *gitIgnore) load(dir string) {
+	file, err := os.Open(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	base, err := filepath.Abs(dir)
+	if err != nil {
+		return
+	}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := ignoreRule{base: base}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		line = strings.TrimPrefix(line, `\`)
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		// 开头或中间带 '/' 的规则相对于.gitignore所在目录
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		rule.pattern = line
+		g.rules = append(g.rules, rule)
+	}
+}
+
+// ignored 判断路径是否被忽略，最后一条匹配的规则生效
+func (g *gitIgnore) ignored(p string, isDir bool) bool {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return false
+	}
+
+	ignored := false
+	for _, rule := range g.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		rel, err := filepath.Rel(rule.base, abs)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+
+		matched := false
+		if rule.anchored {
+			matched = matchGlob(rule.pattern, rel)
+		} else {
+			matched, _ = path.Match(rule.pattern, path.Base(rel))
+		}
+		if matched {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
@@ -0,0 +1,287 @@
+package yamlparser
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// scanTree 扫描测试使用的目录结构，键为相对路径，以 / 结尾的键为空目录
+var scanTree = map[string]string{
+	".git/":      "",
+	".gitignore": "# 根目录规则\n*.tmp.yaml\n!keep.tmp.yaml\nbuild/\n/rootonly.yaml\ngenerated/**/*.yaml\n",
+
+	"app.yaml":       "kind: Pod\n",
+	"rootonly.yaml":  "kind: Pod\n",
+	"a.tmp.yaml":     "kind: Pod\n",
+	"keep.tmp.yaml":  "kind: Pod\n",
+	"Dockerfile":     "FROM alpine\n",
+	"notes.txt":      "not a manifest\n",
+	".git/HEAD.yaml": "kind: Pod\n",
+
+	"build/out.yaml":             "kind: Pod\n",
+	"generated/top.yaml":         "kind: Pod\n",
+	"generated/x/y/deep.yaml":    "kind: Pod\n",
+	"generated/x/y/Dockerfile":   "FROM alpine\n",
+	"deploy/.gitignore":          "secret.yaml\n/local/\n",
+	"deploy/rootonly.yaml":       "kind: Pod\n",
+	"deploy/secret.yaml":         "kind: Secret\n",
+	"deploy/b.tmp.yaml":          "kind: Pod\n",
+	"deploy/web.yml":             "kind: Pod\n",
+	"deploy/local/x.yaml":        "kind: Pod\n",
+	"deploy/nested/local/y.yaml": "kind: Pod\n",
+	"deploy/nested/build":        "a file named build\n",
+	"deploy/api/Containerfile":   "FROM alpine\n",
+
+	"charts/myapp/Chart.yaml":            "apiVersion: v2\nname: myapp\nversion: 0.1.0\n",
+	"charts/myapp/templates/deploy.yaml": "kind: Deployment\n",
+	"overlays/prod/kustomization.yaml":   "resources:\n  - deploy.yaml\n",
+	"overlays/prod/deploy.yaml":          "kind: Deployment\n",
+}
+
+// newScanTree 在临时目录中创建scanTree，返回根目录
+func newScanTree(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range scanTree {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if strings.HasSuffix(name, "/") {
+			if err := os.MkdirAll(path, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// relPaths 将扫描结果转换为相对于root的路径
+func relPaths(t *testing.T, root string, paths []string) []string {
+	t.Helper()
+	rels := []string{}
+	for _, p := range paths {
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rels = append(rels, filepath.ToSlash(rel))
+	}
+	return rels
+}
+
+func TestScanPath(t *testing.T) {
+	root := newScanTree(t)
+
+	tests := []struct {
+		name string
+		// path 相对于root的目录或通配符
+		path string
+		opts ParseOptions
+		want []string
+	}{
+		{
+			name: "directory",
+			path: ".",
+			want: []string{
+				"Dockerfile",
+				"app.yaml",
+				"charts/myapp",
+				"deploy/api/Containerfile",
+				"deploy/nested/local/y.yaml",
+				"deploy/rootonly.yaml",
+				"deploy/web.yml",
+				"generated/x/y/Dockerfile",
+				"keep.tmp.yaml",
+				"overlays/prod",
+			},
+		},
+		{
+			// 子目录同样遵循仓库根目录的.gitignore
+			name: "subdirectory",
+			path: "deploy",
+			want: []string{"deploy/api/Containerfile", "deploy/nested/local/y.yaml", "deploy/rootonly.yaml", "deploy/web.yml"},
+		},
+		{
+			name: "include",
+			path: ".",
+			opts: ParseOptions{Include: []string{"*.yml", "deploy/**/Containerfile"}},
+			want: []string{"charts/myapp", "deploy/api/Containerfile", "deploy/web.yml", "overlays/prod"},
+		},
+		{
+			// 不含 '/' 的排除模式匹配任意层的文件或目录名，含 '/' 的模式相对于扫描目录
+			name: "exclude",
+			path: ".",
+			opts: ParseOptions{Exclude: []string{"nested", "Dockerfile", "/charts/**", "deploy/*.yml"}},
+			want: []string{
+				"app.yaml",
+				"deploy/api/Containerfile",
+				"deploy/rootonly.yaml",
+				"keep.tmp.yaml",
+				"overlays/prod",
+			},
+		},
+		{
+			name: "exclude unit",
+			path: ".",
+			opts: ParseOptions{Exclude: []string{"overlays/prod"}, Include: []string{"app.yaml"}},
+			want: []string{"app.yaml", "charts/myapp"},
+		},
+		{
+			// 通配符匹配Chart.yaml或kustomization文件时保留整个目录
+			name: "recursive glob",
+			path: "**/*.yaml",
+			want: []string{
+				"app.yaml",
+				"charts/myapp",
+				"deploy/nested/local/y.yaml",
+				"deploy/rootonly.yaml",
+				"keep.tmp.yaml",
+				"overlays/prod",
+			},
+		},
+		{
+			name: "single level glob",
+			path: "deploy/*.y*ml",
+			want: []string{"deploy/rootonly.yaml", "deploy/web.yml"},
+		},
+		{
+			name: "glob with include",
+			path: "deploy/**",
+			opts: ParseOptions{Include: []string{"*.yml"}},
+			want: []string{"deploy/web.yml"},
+		},
+		{
+			name: "glob matching a unit directory",
+			path: "*/prod",
+			want: []string{"overlays/prod"},
+		},
+		{
+			name: "glob without matches",
+			path: "missing/*.yaml",
+			want: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := scanPath(filepath.Join(root, tt.path), tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rels := relPaths(t, root, got); strings.Join(rels, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("scanPath(%s) =\n%s\nwant\n%s", tt.path, strings.Join(rels, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestExpandPaths(t *testing.T) {
+	root := newScanTree(t)
+	paths := []string{
+		filepath.Join(root, "charts", "myapp"),
+		filepath.Join(root, "deploy", "secret.yaml"),
+		filepath.Join(root, "deploy", "web.yml"),
+		filepath.Join(root, "deploy", "*.yml"),
+		"https://example.com/deploy.yaml",
+		"-",
+	}
+
+	got, err := ExpandPaths(paths, ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 直接指定的文件不受.gitignore影响，重复的文件只保留第一次出现的位置
+	want := []string{
+		filepath.Join(root, "charts", "myapp"),
+		filepath.Join(root, "deploy", "secret.yaml"),
+		filepath.Join(root, "deploy", "web.yml"),
+		"https://example.com/deploy.yaml",
+		"-",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("ExpandPaths() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"**", "a/b/c.yaml", true},
+		{"**/*.yaml", "c.yaml", true},
+		{"**/*.yaml", "a/b/c.yaml", true},
+		{"**/*.yaml", "a/b/c.yml", false},
+		{"a/**/c.yaml", "a/c.yaml", true},
+		{"a/**/c.yaml", "a/x/y/c.yaml", true},
+		{"a/**/c.yaml", "b/x/c.yaml", false},
+		{"a/**/**/c.yaml", "a/x/c.yaml", true},
+		{"a/**", "a/x/y", true},
+		{"a/**", "b/x", false},
+		{"a/*", "a/x/y", false},
+		{"a/*.yaml", "a/c.yaml", true},
+		{"a/[bc].yaml", "a/c.yaml", true},
+		{"a/?.yaml", "a/cd.yaml", false},
+		{"a/b", "a/b/c", false},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGitIgnore(t *testing.T) {
+	root := t.TempDir()
+	content := strings.Join([]string{
+		"*.log",
+		"!important.log",
+		"tmp/",
+		"/vendor",
+		"docs/**/draft.yaml",
+		`\!bang.yaml`,
+		"# comment",
+		"",
+	}, "\n")
+	if err := os.WriteFile(filepath.Join(root, ".gitignore"), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ignore := &gitIgnore{}
+	ignore.load(root)
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"debug.log", false, true},
+		{"sub/debug.log", false, true},
+		{"sub/important.log", false, false},
+		{"tmp", true, true},
+		{"sub/tmp", true, true},
+		// 只匹配目录的规则不匹配同名文件
+		{"tmp", false, false},
+		{"vendor", true, true},
+		{"sub/vendor", true, false},
+		{"docs/draft.yaml", false, true},
+		{"docs/a/b/draft.yaml", false, true},
+		{"other/draft.yaml", false, false},
+		{"!bang.yaml", false, true},
+		{"app.yaml", false, false},
+		// .gitignore所在目录之外的路径不受影响
+		{"../debug.log", false, false},
+	}
+	for _, tt := range tests {
+		if got := ignore.ignored(filepath.Join(root, tt.path), tt.isDir); got != tt.want {
+			t.Errorf("ignored(%q, dir=%v) = %v, want %v", tt.path, tt.isDir, got, tt.want)
+		}
+	}
+}